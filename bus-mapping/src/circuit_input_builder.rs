@@ -1427,12 +1427,22 @@ fn get_step_reported_error(op: &OpcodeId, error: &str) -> ExecError {
             _ => OogError::Constant,
         };
         ExecError::OutOfGas(oog_err)
-    } else if error.starts_with(GETH_ERR_STACK_OVERFLOW) {
-        ExecError::StackOverflow
-    } else if error.starts_with(GETH_ERR_STACK_UNDERFLOW) {
-        ExecError::StackUnderflow
     } else {
-        panic!("Unknown GethExecStep.error: {}", error);
+        match error {
+            GETH_ERR_STACK_OVERFLOW => ExecError::StackOverflow,
+            GETH_ERR_STACK_UNDERFLOW => ExecError::StackUnderflow,
+            GETH_ERR_INVALID_OPCODE => ExecError::InvalidOpcode,
+            GETH_ERR_WRITE_PROTECTION => ExecError::WriteProtection,
+            GETH_ERR_INVALID_JUMP => ExecError::InvalidJump,
+            GETH_ERR_RETURN_DATA_OUT_OF_BOUNDS => ExecError::ReturnDataOutOfBounds,
+            GETH_ERR_DEPTH => ExecError::Depth,
+            GETH_ERR_INSUFFICIENT_BALANCE => ExecError::InsufficientBalance,
+            GETH_ERR_CONTRACT_ADDRESS_COLLISION => ExecError::ContractAddressCollision,
+            GETH_ERR_INVALID_CREATION_CODE => ExecError::InvalidCreationCode,
+            GETH_ERR_CODE_STORE_OUT_OF_GAS => ExecError::CodeStoreOutOfGas,
+            GETH_ERR_MAX_CODE_SIZE_EXCEEDED => ExecError::MaxCodeSizeExceeded,
+            _ => panic!("Unknown GethExecStep.error: {}", error),
+        }
     }
 }
 /// Retrieve the init_code from memory for {CREATE, CREATE2}
@@ -2848,10 +2858,7 @@ mod tracer_tests {
         let index = block.geth_traces[0].struct_logs.len() - 1; // PUSH2
         let step = &block.geth_traces[0].struct_logs[index];
         let next_step = block.geth_traces[0].struct_logs.get(index + 1);
-        assert_eq!(
-            step.error,
-            Some(format!("{} 1024 (1023)", GETH_ERR_STACK_OVERFLOW))
-        );
+        assert_eq!(step.error, Some(GETH_ERR_STACK_OVERFLOW.to_string()));
 
         let mut builder = CircuitInputBuilderTx::new(&block, step);
         assert_eq!(
@@ -2871,10 +2878,7 @@ mod tracer_tests {
         let index = 0; // SWAP5
         let step = &block.geth_traces[0].struct_logs[index];
         let next_step = block.geth_traces[0].struct_logs.get(index + 1);
-        assert_eq!(
-            step.error,
-            Some(format!("{} (0 <=> 6)", GETH_ERR_STACK_UNDERFLOW))
-        );
+        assert_eq!(step.error, Some(GETH_ERR_STACK_UNDERFLOW.to_string()));
 
         let mut builder = CircuitInputBuilderTx::new(&block, step);
         assert_eq!(
@@ -1,8 +1,43 @@
-/// Geth error message for stack overflow
+// Code generated by `gethutil errors -format rust`. DO NOT EDIT.
+
+/// Geth error message `stack limit reached`
 pub const GETH_ERR_STACK_OVERFLOW: &str = "stack limit reached";
-/// Geth error message for stack underflow
+
+/// Geth error message `stack underflow`
 pub const GETH_ERR_STACK_UNDERFLOW: &str = "stack underflow";
-/// Geth error message for out of gas
+
+/// Geth error message `invalid opcode`
+pub const GETH_ERR_INVALID_OPCODE: &str = "invalid opcode";
+
+/// Geth error message `out of gas`
 pub const GETH_ERR_OUT_OF_GAS: &str = "out of gas";
-/// Geth error message for gas uint64 overflow
+
+/// Geth error message `gas uint64 overflow`
 pub const GETH_ERR_GAS_UINT_OVERFLOW: &str = "gas uint64 overflow";
+
+/// Geth error message `write protection`
+pub const GETH_ERR_WRITE_PROTECTION: &str = "write protection";
+
+/// Geth error message `invalid jump destination`
+pub const GETH_ERR_INVALID_JUMP: &str = "invalid jump destination";
+
+/// Geth error message `return data out of bounds`
+pub const GETH_ERR_RETURN_DATA_OUT_OF_BOUNDS: &str = "return data out of bounds";
+
+/// Geth error message `max call depth exceeded`
+pub const GETH_ERR_DEPTH: &str = "max call depth exceeded";
+
+/// Geth error message `insufficient balance for transfer`
+pub const GETH_ERR_INSUFFICIENT_BALANCE: &str = "insufficient balance for transfer";
+
+/// Geth error message `contract address collision`
+pub const GETH_ERR_CONTRACT_ADDRESS_COLLISION: &str = "contract address collision";
+
+/// Geth error message `invalid code: must not begin with 0xef`
+pub const GETH_ERR_INVALID_CREATION_CODE: &str = "invalid code: must not begin with 0xef";
+
+/// Geth error message `contract creation code storage out of gas`
+pub const GETH_ERR_CODE_STORE_OUT_OF_GAS: &str = "contract creation code storage out of gas";
+
+/// Geth error message `max code size exceeded`
+pub const GETH_ERR_MAX_CODE_SIZE_EXCEEDED: &str = "max code size exceeded";
@@ -29,6 +29,10 @@ pub fn trace(config: &TraceConfig) -> Result<Vec<GethExecTrace>, Error> {
     let trace_string = geth_utils::trace(&serde_json::to_string(config).unwrap()).map_err(
         |error| match error {
             geth_utils::Error::TracingError(error) => Error::TracingError(error),
+            geth_utils::Error::TraceError { message, .. } => Error::TracingError(message),
+            error @ geth_utils::Error::SchemaVersionMismatch { .. } => {
+                Error::TracingError(error.to_string())
+            }
         },
     )?;
 
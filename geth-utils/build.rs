@@ -25,9 +25,71 @@ fn main() {
 
     // Files the lib depends on that should recompile the lib
     let dep_files = vec![
+        "./gethutil/accountfiles.go",
         "./gethutil/asm.go",
+        "./gethutil/block.go",
+        "./gethutil/blockhash.go",
+        "./gethutil/blocktest.go",
+        "./gethutil/bundle.go",
+        "./gethutil/bytecodes.go",
+        "./gethutil/cache.go",
+        "./gethutil/call.go",
+        "./gethutil/chaindata.go",
+        "./gethutil/chunk.go",
+        "./gethutil/coinbase.go",
+        "./gethutil/compare.go",
+        "./gethutil/compress.go",
+        "./gethutil/decode.go",
+        "./gethutil/defaults.go",
+        "./gethutil/deploy.go",
+        "./gethutil/differential.go",
+        "./gethutil/doc.go",
+        "./gethutil/dump.go",
+        "./gethutil/encodelogs.go",
+        "./gethutil/errors.go",
+        "./gethutil/estimate.go",
+        "./gethutil/execerror.go",
+        "./gethutil/fees.go",
+        "./gethutil/fixtures.go",
+        "./gethutil/forks.go",
+        "./gethutil/gas.go",
+        "./gethutil/genesis.go",
+        "./gethutil/geth.go",
+        "./gethutil/golden.go",
+        "./gethutil/handle.go",
+        "./gethutil/header.go",
+        "./gethutil/jumptable.go",
+        "./gethutil/l1fee.go",
+        "./gethutil/logger.go",
+        "./gethutil/logs.go",
+        "./gethutil/override.go",
+        "./gethutil/pack.go",
+        "./gethutil/parity.go",
+        "./gethutil/preimages.go",
+        "./gethutil/pretty.go",
+        "./gethutil/revert.go",
+        "./gethutil/rlp.go",
+        "./gethutil/roots.go",
+        "./gethutil/rows.go",
+        "./gethutil/rpcstate.go",
+        "./gethutil/rw.go",
+        "./gethutil/service.go",
+        "./gethutil/setcode.go",
+        "./gethutil/sign.go",
+        "./gethutil/solc.go",
+        "./gethutil/statedb.go",
+        "./gethutil/statediff.go",
+        "./gethutil/statetest.go",
+        "./gethutil/steperrors.go",
+        "./gethutil/summary.go",
+        "./gethutil/touched.go",
         "./gethutil/trace.go",
+        "./gethutil/tracers.go",
+        "./gethutil/transfers.go",
+        "./gethutil/trieupdates.go",
+        "./gethutil/txtest.go",
         "./gethutil/util.go",
+        "./gethutil/validate.go",
         "./go.mod",
     ];
     for file in dep_files {
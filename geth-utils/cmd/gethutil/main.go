@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/appliedzkp/zkevm-circuits/geth-utils/gethutil"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const usage = `Usage: gethutil <command> [flags]
+
+Commands:
+  trace    trace a TraceConfig read from a file or stdin
+  asm      assemble mnemonics read from a file or stdin into bytecode
+  differential
+           diff the trace of a transaction by a geth node against the local one
+  diff     diff two traces read from files
+  pretty   print a trace read from a file or stdin as a call tree
+  errors   write the table of the errors of the steps as JSON or Rust
+  statetest
+           run GeneralStateTests fixture files
+  blocktest
+           run BlockchainTests fixture files
+  txtest   run TransactionTests fixture files
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "trace":
+		err = traceCmd(os.Args[2:])
+	case "asm":
+		err = asmCmd(os.Args[2:])
+	case "differential":
+		err = differentialCmd(os.Args[2:])
+	case "diff":
+		err = diffCmd(os.Args[2:])
+	case "pretty":
+		err = prettyCmd(os.Args[2:])
+	case "errors":
+		err = errorsCmd(os.Args[2:])
+	case "statetest":
+		err = stateTestCmd(os.Args[2:])
+	case "blocktest":
+		err = blockTestCmd(os.Args[2:])
+	case "txtest":
+		err = txTestCmd(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed, err: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func traceCmd(args []string) error {
+	flags := flag.NewFlagSet("trace", flag.ExitOnError)
+	input := flags.String("config", "-", "TraceConfig JSON file, - for stdin")
+	genesis := flags.String("genesis", "", "geth genesis.json whose alloc and chain config the config is applied on top of")
+	output := flags.String("out", "-", "output file, - for stdout")
+	format := flags.String("format", "json", "output format: json or compact")
+	disableMemory := flags.Bool("disable-memory", false, "disable the memory capture")
+	memoryOnWrite := flags.Bool("memory-on-write", false, "capture the memory only at memory-writing opcodes")
+	memoryLimit := flags.Uint64("memory-limit", 0, "cap the captured memory per step in bytes (0 = unlimited)")
+	stackTopN := flags.Int("stack-top-n", 0, "capture only the top N stack elements (0 = whole stack)")
+	maxSteps := flags.Int("max-steps", 0, "stop capturing steps after N steps (0 = unlimited)")
+	summary := flags.Bool("summary", false, "add the summary of the steps to the results")
+	timeout := flags.Duration("timeout", 0, "abort the tracing after the timeout, marking the result as interrupted (0 = no timeout)")
+	opcodes := flags.String("opcodes", "", "capture only the steps of these comma-separated opcodes (empty = all)")
+	startStep := flags.Int("start-step", 0, "capture only the steps from this index")
+	endStep := flags.Int("end-step", 0, "capture only the steps before this index (0 = no end)")
+	chunkSize := flags.Int("chunk-size", 0, "split the steps into chunks of N steps with their continuations (0 = no chunks)")
+	flags.Parse(args)
+
+	var config gethutil.TraceConfig
+	if *genesis != "" {
+		g, err := gethutil.LoadGenesis(*genesis)
+		if err != nil {
+			return err
+		}
+		if config, err = gethutil.GenesisTraceConfig(g); err != nil {
+			return fmt.Errorf("failed to convert genesis: %w", err)
+		}
+	}
+	// The fields of the config override the ones of the genesis, and its
+	// accounts are added to the alloc.
+	if err := readJSON(*input, &config); err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	// Flags only override the options given in the config when set.
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "disable-memory":
+			config.TracerOptions.DisableMemory = *disableMemory
+		case "memory-on-write":
+			config.TracerOptions.MemoryOnWrite = *memoryOnWrite
+		case "memory-limit":
+			config.TracerOptions.MemoryLimit = *memoryLimit
+		case "stack-top-n":
+			config.TracerOptions.StackTopN = *stackTopN
+		case "max-steps":
+			config.TracerOptions.MaxSteps = *maxSteps
+		case "summary":
+			config.TracerOptions.Summary = *summary
+		case "opcodes":
+			config.TracerOptions.Opcodes = nil
+			if *opcodes != "" {
+				config.TracerOptions.Opcodes = strings.Split(*opcodes, ",")
+			}
+		case "start-step":
+			config.TracerOptions.StartStep = *startStep
+		case "end-step":
+			config.TracerOptions.EndStep = *endStep
+		case "chunk-size":
+			config.TracerOptions.ChunkSize = *chunkSize
+		}
+	})
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	results, err := gethutil.TraceContext(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(*output, func(w io.Writer) error {
+		indent := ""
+		switch *format {
+		case "json":
+			indent = "  "
+		case "compact":
+		default:
+			return fmt.Errorf("unknown format %q", *format)
+		}
+		if err := gethutil.WriteResults(w, results, indent); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "\n")
+		return err
+	})
+}
+
+func asmCmd(args []string) error {
+	flags := flag.NewFlagSet("asm", flag.ExitOnError)
+	input := flags.String("in", "-", "mnemonics file, - for stdin")
+	output := flags.String("out", "-", "output file, - for stdout")
+	flags.Parse(args)
+
+	src, err := readAll(*input)
+	if err != nil {
+		return fmt.Errorf("failed to read mnemonics: %w", err)
+	}
+	bytecode, err := gethutil.Assemble(string(src))
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(*output, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "0x%x\n", bytecode)
+		return err
+	})
+}
+
+func differentialCmd(args []string) error {
+	flags := flag.NewFlagSet("differential", flag.ExitOnError)
+	url := flags.String("rpc", "http://127.0.0.1:8545", "RPC endpoint of a geth node with the debug API")
+	tx := flags.String("tx", "", "hash of the transaction")
+	flags.Parse(args)
+
+	diff, err := gethutil.DiffAgainstGeth(context.Background(), *url, common.HexToHash(*tx))
+	if err != nil {
+		return err
+	}
+	if diff.Equal() {
+		fmt.Println("no divergence")
+		return nil
+	}
+	if err := writeJSON(os.Stdout, diff); err != nil {
+		return err
+	}
+	return fmt.Errorf("traces diverge")
+}
+
+func diffCmd(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	pathA := flags.String("a", "", "[]ExecutionResult JSON file")
+	pathB := flags.String("b", "", "[]ExecutionResult JSON file")
+	flags.Parse(args)
+
+	var a, b []*gethutil.ExecutionResult
+	if err := readJSON(*pathA, &a); err != nil {
+		return fmt.Errorf("failed to read %s: %w", *pathA, err)
+	}
+	if err := readJSON(*pathB, &b); err != nil {
+		return fmt.Errorf("failed to read %s: %w", *pathB, err)
+	}
+	if len(a) != len(b) {
+		return fmt.Errorf("traces of %d and %d transactions", len(a), len(b))
+	}
+
+	equal := true
+	diffs := make([]*gethutil.TraceDiff, len(a))
+	for i := range a {
+		diffs[i] = gethutil.CompareTraces(a[i], b[i])
+		equal = equal && diffs[i].Equal()
+	}
+	if equal {
+		fmt.Println("no difference")
+		return nil
+	}
+	if err := writeJSON(os.Stdout, diffs); err != nil {
+		return err
+	}
+	return fmt.Errorf("traces differ")
+}
+
+func prettyCmd(args []string) error {
+	flags := flag.NewFlagSet("pretty", flag.ExitOnError)
+	input := flags.String("trace", "-", "[]ExecutionResult JSON file, - for stdin")
+	output := flags.String("out", "-", "output file, - for stdout")
+	stackItems := flags.Int("stack", 4, "number of stack elements printed from the top (-1 = all)")
+	labelsFile := flags.String("labels", "", "JSON file of labels by address, printed in place of the addresses")
+	flags.Parse(args)
+
+	var results []*gethutil.ExecutionResult
+	if err := readJSON(*input, &results); err != nil {
+		return fmt.Errorf("failed to read trace: %w", err)
+	}
+	var labels map[common.Address]string
+	if *labelsFile != "" {
+		if err := readJSON(*labelsFile, &labels); err != nil {
+			return fmt.Errorf("failed to read labels: %w", err)
+		}
+	}
+
+	return writeOutput(*output, func(w io.Writer) error {
+		for i, result := range results {
+			if _, err := fmt.Fprintf(w, "transaction %d\n", i); err != nil {
+				return err
+			}
+			if err := gethutil.PrettyPrintWithLabels(w, result, *stackItems, labels); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func errorsCmd(args []string) error {
+	flags := flag.NewFlagSet("errors", flag.ExitOnError)
+	output := flags.String("out", "-", "output file, - for stdout")
+	format := flags.String("format", "json", "output format: json or rust")
+	flags.Parse(args)
+
+	switch *format {
+	case "json":
+		return writeOutput(*output, gethutil.WriteStepErrorsJSON)
+	case "rust":
+		return writeOutput(*output, gethutil.WriteStepErrorsRust)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+}
+
+func stateTestCmd(args []string) error {
+	flags := flag.NewFlagSet("statetest", flag.ExitOnError)
+	only := flags.String("fork", "", "only run the post states of this fork")
+	flags.Parse(args)
+
+	supported := make(map[string]bool)
+	for _, name := range gethutil.Forks() {
+		supported[name] = true
+	}
+
+	var passed, failed int
+	for _, path := range flags.Args() {
+		tests, err := gethutil.LoadStateTests(path)
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(tests))
+		for name := range tests {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			test := tests[name]
+			forks := make([]string, 0, len(test.Post))
+			for fork := range test.Post {
+				if supported[fork] && (*only == "" || fork == *only) {
+					forks = append(forks, fork)
+				}
+			}
+			sort.Strings(forks)
+
+			for _, fork := range forks {
+				for i := range test.Post[fork] {
+					if _, err := test.Run(fork, i); err != nil {
+						failed++
+						fmt.Printf("FAIL %s %s/%d: %v\n", name, fork, i, err)
+					} else {
+						passed++
+					}
+				}
+			}
+		}
+	}
+
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d state tests failed", failed)
+	}
+	return nil
+}
+
+func blockTestCmd(args []string) error {
+	flags := flag.NewFlagSet("blocktest", flag.ExitOnError)
+	only := flags.String("fork", "", "only run the tests of this fork")
+	traces := flags.String("traces", "", "output file of the traces of the blocks by test, - for stdout")
+	flags.Parse(args)
+
+	supported := make(map[string]bool)
+	for _, name := range gethutil.Forks() {
+		supported[name] = true
+	}
+
+	var passed, failed int
+	blockResults := make(map[string][]*gethutil.BlockResult)
+	for _, path := range flags.Args() {
+		tests, err := gethutil.LoadBlockTests(path)
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(tests))
+		for name, test := range tests {
+			if supported[test.Network] && (*only == "" || test.Network == *only) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			results, err := tests[name].Run(*traces != "")
+			if err != nil {
+				failed++
+				fmt.Printf("FAIL %s: %v\n", name, err)
+				continue
+			}
+			passed++
+			blockResults[name] = results
+		}
+	}
+
+	if *traces != "" {
+		if err := writeOutput(*traces, func(w io.Writer) error { return writeJSON(w, blockResults) }); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d block tests failed", failed)
+	}
+	return nil
+}
+
+func txTestCmd(args []string) error {
+	flags := flag.NewFlagSet("txtest", flag.ExitOnError)
+	only := flags.String("fork", "", "only check the results of this fork")
+	flags.Parse(args)
+
+	supported := make(map[string]bool)
+	for _, name := range gethutil.Forks() {
+		supported[name] = true
+	}
+
+	var passed, failed int
+	for _, path := range flags.Args() {
+		tests, err := gethutil.LoadTransactionTests(path)
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(tests))
+		for name := range tests {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			test := tests[name]
+			forks := make([]string, 0, len(test.Result))
+			for fork := range test.Result {
+				if supported[fork] && (*only == "" || fork == *only) {
+					forks = append(forks, fork)
+				}
+			}
+			sort.Strings(forks)
+
+			for _, fork := range forks {
+				if err := test.Run(fork); err != nil {
+					failed++
+					fmt.Printf("FAIL %s %s: %v\n", name, fork, err)
+				} else {
+					passed++
+				}
+			}
+		}
+	}
+
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d transaction tests failed", failed)
+	}
+	return nil
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func readAll(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func readJSON(path string, v interface{}) error {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+	return json.NewDecoder(r).Decode(v)
+}
+
+func writeOutput(path string, write func(w io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
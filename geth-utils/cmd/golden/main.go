@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/appliedzkp/zkevm-circuits/geth-utils/gethutil"
+)
+
+// Writes the config and the serialized trace of every golden case into the
+// output directory, as `<name>.config.json` and `<name>.trace.json`. The
+// trace bytes are serialized exactly as they are returned through the FFI.
+// With -check, the traces are instead compared byte for byte with the ones
+// in the directory, and with the traces of a second run.
+func main() {
+	out := flag.String("out", "golden", "output directory")
+	check := flag.Bool("check", false, "compare with the traces in the output directory instead of writing them")
+	flag.Parse()
+
+	if *check {
+		if failed := checkGolden(*out); failed > 0 {
+			fmt.Fprintf(os.Stderr, "%d golden cases differ\n", failed)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create output directory, err: %v\n", err)
+		os.Exit(1)
+	}
+
+	names := make([]string, 0)
+	for _, c := range gethutil.GoldenCases() {
+		result, err := gethutil.Trace(c.Config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to trace golden case %s, err: %v\n", c.Name, err)
+			os.Exit(1)
+		}
+
+		if err := writeJSON(filepath.Join(*out, c.Name+".config.json"), c.Config); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write config of %s, err: %v\n", c.Name, err)
+			os.Exit(1)
+		}
+		if err := writeJSON(filepath.Join(*out, c.Name+".trace.json"), result); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write trace of %s, err: %v\n", c.Name, err)
+			os.Exit(1)
+		}
+		names = append(names, c.Name)
+	}
+
+	if err := writeJSON(filepath.Join(*out, "cases.json"), names); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write case index, err: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// checkGolden traces every golden case twice, and returns the number of
+// cases whose traces differ from each other or from the one in dir.
+func checkGolden(dir string) int {
+	failed := 0
+	for _, c := range gethutil.GoldenCases() {
+		var traces [2][]byte
+		for i := range traces {
+			result, err := gethutil.Trace(c.Config)
+			if err == nil {
+				traces[i], err = json.MarshalIndent(result, "", "  ")
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to trace golden case %s, err: %v\n", c.Name, err)
+				os.Exit(1)
+			}
+		}
+		if !bytes.Equal(traces[0], traces[1]) {
+			fmt.Printf("%s: trace is not byte-stable\n", c.Name)
+			failed++
+			continue
+		}
+
+		golden, err := os.ReadFile(filepath.Join(dir, c.Name+".trace.json"))
+		if err != nil {
+			fmt.Printf("%s: %v\n", c.Name, err)
+			failed++
+		} else if !bytes.Equal(golden, traces[0]) {
+			fmt.Printf("%s: trace differs from the golden one\n", c.Name)
+			failed++
+		}
+	}
+	return failed
+}
+
+func writeJSON(path string, v interface{}) error {
+	bytes, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, bytes, 0644)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/appliedzkp/zkevm-circuits/geth-utils/gethutil"
+	"github.com/appliedzkp/zkevm-circuits/geth-utils/tracergrpc"
+)
+
+// Serves the gethutil JSON-RPC API (e.g. "gethutil_trace", "debug_traceCall")
+// on a unix socket or a TCP address, one JSON-RPC stream per connection, or
+// over HTTP. The debug methods trace on the block of the TraceConfig in the
+// -chain file, or an empty one. With -grpc, the gRPC API of tracergrpc is
+// served on the socket instead.
+func main() {
+	network := flag.String("network", "unix", "listener network, unix or tcp")
+	addr := flag.String("addr", "gethutil.ipc", "socket path or host:port to listen on")
+	httpAddr := flag.String("http", "", "host:port to serve JSON-RPC over HTTP on, instead of the socket")
+	serveGRPC := flag.Bool("grpc", false, "serve the gRPC API of tracergrpc/tracer.proto on the socket, instead of JSON-RPC")
+	chainPath := flag.String("chain", "", "TraceConfig JSON file of the block and accounts of the debug methods")
+	flag.Parse()
+
+	var chain gethutil.TraceConfig
+	if *chainPath != "" {
+		data, err := os.ReadFile(*chainPath)
+		if err == nil {
+			err = json.Unmarshal(data, &chain)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read chain %s, err: %v\n", *chainPath, err)
+			os.Exit(1)
+		}
+	}
+
+	server, err := gethutil.NewRPCServer(chain)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create server, err: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *httpAddr != "" {
+		fmt.Fprintf(os.Stderr, "serving on http://%s\n", *httpAddr)
+		if err := http.ListenAndServe(*httpAddr, server); err != nil {
+			fmt.Fprintf(os.Stderr, "server stopped, err: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *network == "unix" {
+		// Remove a stale socket left by a previous run.
+		os.Remove(*addr)
+	}
+	listener, err := net.Listen(*network, *addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to listen on %s, err: %v\n", *addr, err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "serving on %s://%s\n", *network, listener.Addr())
+
+	if *serveGRPC {
+		if err := tracergrpc.NewServer(tracergrpc.Tracer{}).Serve(listener); err != nil {
+			fmt.Fprintf(os.Stderr, "server stopped, err: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := server.ServeListener(listener); err != nil {
+		fmt.Fprintf(os.Stderr, "server stopped, err: %v\n", err)
+		os.Exit(1)
+	}
+}
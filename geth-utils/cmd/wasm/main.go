@@ -0,0 +1,58 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"encoding/json"
+	"syscall/js"
+
+	"github.com/appliedzkp/zkevm-circuits/geth-utils/gethutil"
+)
+
+// Exposes the tracer to JavaScript as the global function traceTx, which
+// takes a TraceConfig as a JSON string or an object and returns the same JSON
+// as CreateTrace of the library: the results, or an error envelope
+// {"error": {"code": <code>, "message": <message>}} on failure.
+func main() {
+	js.Global().Set("traceTx", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) != 1 {
+			return errorEnvelope(gethutil.NewTraceError(gethutil.ErrCodeInvalidConfig, nil, "Expected a config, got %d arguments", len(args)))
+		}
+		configStr := args[0]
+		if configStr.Type() != js.TypeString {
+			configStr = js.Global().Get("JSON").Call("stringify", configStr)
+		}
+		return traceTx(configStr.String())
+	}))
+	// Keep the functions callable.
+	select {}
+}
+
+// traceTx traces the JSON config, like createTrace of the library without the
+// cache and the block hash callback.
+func traceTx(configStr string) string {
+	var config gethutil.TraceConfig
+	if err := json.Unmarshal([]byte(configStr), &config); err != nil {
+		return errorEnvelope(gethutil.NewTraceError(gethutil.ErrCodeInvalidConfig, err, "Failed to unmarshal config, err: %v", err))
+	}
+
+	results, err := gethutil.Trace(config)
+	if err != nil {
+		traceErr := gethutil.AsTraceError(err)
+		return errorEnvelope(gethutil.NewTraceError(traceErr.Code, err, "Failed to run Trace, err: %v", err))
+	}
+
+	bytes, err := json.MarshalIndent(gethutil.FormatResults(config, results), "", "  ")
+	if err != nil {
+		return errorEnvelope(gethutil.NewTraceError(gethutil.ErrCodeInternal, err, "Failed to marshal []ExecutionResult, err: %v", err))
+	}
+	return string(bytes)
+}
+
+func errorEnvelope(err *gethutil.TraceError) string {
+	bytes, _ := json.Marshal(struct {
+		Error *gethutil.TraceError `json:"error"`
+	}{err})
+	return string(bytes)
+}
@@ -7,7 +7,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 
-	"main/gethutil"
+	"github.com/appliedzkp/zkevm-circuits/geth-utils/gethutil"
 )
 
 func main() {
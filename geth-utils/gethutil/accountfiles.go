@@ -0,0 +1,52 @@
+package gethutil
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// readCodeFile reads the code of the file at path, in hex with an optional
+// 0x prefix.
+func readCodeFile(path string) ([]byte, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimSpace(string(bytes))
+	text = strings.TrimPrefix(strings.TrimPrefix(text, "0x"), "0X")
+	code, err := hex.DecodeString(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid hex code: %w", path, err)
+	}
+	return code, nil
+}
+
+// readStorageFile reads the storage of the file at path, a JSON object from
+// slot to value like Account.Storage.
+func readStorageFile(path string) (map[common.Hash]common.Hash, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var storage map[common.Hash]common.Hash
+	if err := json.Unmarshal(bytes, &storage); err != nil {
+		return nil, fmt.Errorf("%s: invalid storage: %w", path, err)
+	}
+	return storage, nil
+}
+
+// hasAccountFiles returns whether an account of config loads its code or
+// its storage from a file.
+func (config *TraceConfig) hasAccountFiles() bool {
+	for _, account := range config.Accounts {
+		if account.CodeFile != "" || account.StorageFile != "" {
+			return true
+		}
+	}
+	return false
+}
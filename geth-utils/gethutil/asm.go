@@ -13,12 +13,14 @@ type Asm struct {
 	bytecode         []byte
 	labelMap         map[string]int
 	pendingLabelsMap map[string][]int
+	markerMap        map[string]int
 }
 
 func NewAssembly() *Asm {
 	return &Asm{
 		labelMap:         make(map[string]int),
 		pendingLabelsMap: make(map[string][]int),
+		markerMap:        make(map[string]int),
 	}
 }
 
@@ -47,6 +49,37 @@ func (a *Asm) PrintMnemonics(out io.Writer) {
 	}
 }
 
+// Op appends any opcode, without pushing inputs.
+func (a *Asm) Op(op vm.OpCode) *Asm { return a.appendByte(op) }
+
+// Raw appends raw bytes, such as data or an invalid opcode.
+func (a *Asm) Raw(b []byte) *Asm {
+	a.bytecode = append(a.bytecode, b...)
+	return a
+}
+
+// Mark records the current position as marker, like #[marker] of the
+// bytecode! macro.
+func (a *Asm) Mark(marker string) *Asm {
+	if _, ok := a.markerMap[marker]; ok {
+		panic("marker already defined")
+	}
+	a.markerMap[marker] = len(a.bytecode)
+	return a
+}
+
+// Marker returns the position recorded by Mark.
+func (a *Asm) Marker(marker string) int {
+	pos, ok := a.markerMap[marker]
+	if !ok {
+		panic(fmt.Sprintf("marker is not defined: %s", marker))
+	}
+	return pos
+}
+
+// Len returns the current length of the bytecode.
+func (a *Asm) Len() int { return len(a.bytecode) }
+
 // 0x0 range
 func (a *Asm) Stop() *Asm                       { return a.appendByte(vm.STOP) }
 func (a *Asm) Add(v ...interface{}) *Asm        { return a.opWithPush(vm.ADD, v...) }
@@ -123,6 +156,15 @@ func (a *Asm) JumpDest(label ...string) *Asm { return a.jumpDest(label...) }
 
 // 0x60 range
 func (a *Asm) PushX(val interface{}) *Asm { return a.push(val) }
+
+// PushN pushes val with PUSHn, left-padding it to n bytes.
+func (a *Asm) PushN(n int, val interface{}) *Asm {
+	rangeCheck(n, 1, 32, "N")
+	bytes := toBytes(val)
+	rangeCheck(len(bytes), 1, n, "len(bytes)")
+	a.appendByte(int(vm.PUSH1) + n - 1)
+	return a.Raw(append(make([]byte, n-len(bytes)), bytes...))
+}
 func (a *Asm) DupX(x int) *Asm {
 	rangeCheck(x, 1, 16, "X")
 	return a.appendByte(int(vm.DUP1) + x - 1)
@@ -147,6 +189,7 @@ func (a *Asm) DelegateCall(v ...interface{}) *Asm { return a.opWithPush(vm.DELEG
 func (a *Asm) Create2(v ...interface{}) *Asm      { return a.opWithPush(vm.CREATE2, v...) }
 func (a *Asm) StaticCall(v ...interface{}) *Asm   { return a.opWithPush(vm.STATICCALL, v...) }
 func (a *Asm) Revert(v ...interface{}) *Asm       { return a.opWithPush(vm.REVERT, v...) }
+func (a *Asm) Invalid() *Asm                      { return a.appendByte(0xfe) }
 func (a *Asm) SelfDestruct() *Asm                 { return a.appendByte(vm.SELFDESTRUCT) }
 
 func (a *Asm) jump(op vm.OpCode, label ...string) *Asm {
@@ -174,7 +217,7 @@ func (a *Asm) jumpDest(label ...string) *Asm {
 			panic("label already defined")
 		}
 
-		a.labelMap[label[0]] = len(a.bytecode)
+		a.labelMap[label[0]] = len(a.bytecode) - 1
 
 		pos := big.NewInt(int64(len(a.bytecode) - 1)).Bytes()
 		if len(pos) < 3 {
@@ -229,3 +272,76 @@ func (a *Asm) appendByte(v interface{}) *Asm {
 
 	return a
 }
+
+// Assemble assembles the mnemonics of src, separated by whitespace, where
+//
+//   - `PUSHn <value>` pushes value (decimal or 0x-prefixed hex) with PUSHn,
+//     and `PUSH <value>` with the smallest PUSHn
+//   - `<label>:` defines a JUMPDEST labeled label
+//   - `JUMP @<label>` and `JUMPI @<label>` jump to label
+//   - `;` starts a comment until the end of the line
+//
+// and any other word is an opcode without inputs.
+func Assemble(src string) (bytecode []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	var words []string
+	for _, line := range strings.Split(src, "\n") {
+		if i := strings.Index(line, ";"); i >= 0 {
+			line = line[:i]
+		}
+		words = append(words, strings.Fields(line)...)
+	}
+
+	a := NewAssembly()
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		operand := func() string {
+			if i+1 >= len(words) {
+				panic(fmt.Sprintf("missing operand of %s", word))
+			}
+			i++
+			return words[i]
+		}
+
+		switch upper := strings.ToUpper(word); {
+		case strings.HasSuffix(word, ":"):
+			a.JumpDest(strings.TrimSuffix(word, ":"))
+		case upper == "PUSH":
+			a.PushX(parseOperand(operand()))
+		case strings.HasPrefix(upper, "PUSH"):
+			var n int
+			if _, err := fmt.Sscanf(upper, "PUSH%d", &n); err != nil {
+				panic(fmt.Sprintf("invalid opcode %s", word))
+			}
+			a.PushN(n, parseOperand(operand()))
+		case (upper == "JUMP" || upper == "JUMPI") && i+1 < len(words) && strings.HasPrefix(words[i+1], "@"):
+			label := strings.TrimPrefix(operand(), "@")
+			if upper == "JUMP" {
+				a.Jump(label)
+			} else {
+				a.JumpI(label)
+			}
+		default:
+			op := vm.StringToOp(upper)
+			if op == 0 && upper != "STOP" {
+				panic(fmt.Sprintf("invalid opcode %s", word))
+			}
+			a.Op(op)
+		}
+	}
+	return a.Bytecode(), nil
+}
+
+// parseOperand parses a decimal or 0x-prefixed hex push operand.
+func parseOperand(operand string) *big.Int {
+	value, ok := new(big.Int).SetString(operand, 0)
+	if !ok || value.Sign() < 0 {
+		panic(fmt.Sprintf("invalid operand %s", operand))
+	}
+	return value
+}
@@ -0,0 +1,307 @@
+package gethutil
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Withdrawal is a withdrawal from the beacon chain, credited to Address after
+// the transactions of its block.
+type Withdrawal struct {
+	Index          hexutil.Uint64 `json:"index"`
+	ValidatorIndex hexutil.Uint64 `json:"validator_index"`
+	Address        common.Address `json:"address"`
+	// Amount is in Gwei.
+	Amount hexutil.Uint64 `json:"amount"`
+}
+
+// BlockTraceResult holds the traces of the transactions of a block, and the
+// state root after the block.
+type BlockTraceResult struct {
+	Results []*ExecutionResult `json:"results"`
+	// Fees are the sums of the fees of the transactions.
+	Fees *FeesRes `json:"fees"`
+	// Reward is the credit of Block.Reward to the coinbase, if any.
+	Reward    *CoinbaseRes `json:"reward,omitempty"`
+	StateRoot common.Hash  `json:"stateRoot"`
+	// GasUsed is the gas used by the transactions of the block.
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+	// TransactionsRoot and ReceiptsRoot are the roots of the tries of the
+	// transactions of the block and their receipts, see encodeTx.
+	TransactionsRoot common.Hash `json:"transactionsRoot"`
+	ReceiptsRoot     common.Hash `json:"receiptsRoot"`
+	// Blooms are the blooms of the logs of the receipts of Results, which
+	// are empty for the rejected transactions, and LogsBloom is the bloom
+	// of the block, which aggregates them.
+	Blooms    []types.Bloom `json:"blooms"`
+	LogsBloom types.Bloom   `json:"logsBloom"`
+	// Header is the RLP encoding of the header of the block, see NewHeader,
+	// and Hash is its hash.
+	Header hexutil.Bytes `json:"header"`
+	Hash   common.Hash   `json:"hash"`
+}
+
+// TraceBlock traces the transactions of config like Trace, then credits the
+// reward and the withdrawals of config.Block, and returns the state root
+// after the block.
+// As the go-ethereum in use predates Shanghai, the withdrawals are applied
+// whatever the fork, and so is the parent beacon block root of Cancun past
+// the Merge.
+func TraceBlock(config TraceConfig) (*BlockTraceResult, error) {
+	env, err := newTraceEnv(config)
+	if err != nil {
+		return nil, err
+	}
+	stateDB, err := newStateDB(config)
+	if err != nil {
+		return nil, err
+	}
+	return env.traceBlock(stateDB, config)
+}
+
+// BlocksConfig is a chain of blocks traced in sequence by TraceBlocks, on
+// the state of its TraceConfig, whose block constants and transactions are
+// ignored.
+type BlocksConfig struct {
+	TraceConfig
+	Blocks []BlocksConfigBlock `json:"blocks"`
+	// AutoBaseFee fills the base fee of a block without one past London
+	// from its parent, see CalcBaseFee. The first block of London, after a
+	// block of the config, gets params.InitialBaseFee.
+	AutoBaseFee bool `json:"auto_base_fee"`
+}
+
+// BlocksConfigBlock is a block of a BlocksConfig. A block without number
+// follows the previous one.
+type BlocksConfigBlock struct {
+	Block        Block         `json:"block_constants"`
+	Transactions []Transaction `json:"transactions"`
+}
+
+// TraceBlocks traces the blocks of config in sequence like TraceBlock, each
+// one on the state after the previous one. The hash of each block is
+// available to the BLOCKHASH of the next ones, as are the HistoryHashes of
+// the config before the first block.
+func TraceBlocks(config BlocksConfig) ([]*BlockTraceResult, error) {
+	stateDB, err := newStateDB(config.TraceConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	blockHashes := make(map[hexutil.Uint64]common.Hash, len(config.BlockHashes))
+	for number, hash := range config.BlockHashes {
+		blockHashes[number] = hash
+	}
+	var number *big.Int
+	if len(config.Blocks) > 0 {
+		number = toBigInt(config.Blocks[0].Block.Number)
+	}
+	for i, hash := range config.HistoryHashes {
+		// The last history hash is the one of the block before the first one.
+		n := new(big.Int).Sub(number, big.NewInt(int64(len(config.HistoryHashes)-i)))
+		if n.Sign() >= 0 && n.IsUint64() {
+			if _, ok := blockHashes[hexutil.Uint64(n.Uint64())]; !ok {
+				blockHashes[hexutil.Uint64(n.Uint64())] = common.BigToHash(toBigInt(hash))
+			}
+		}
+	}
+
+	blockResults := make([]*BlockTraceResult, len(config.Blocks))
+	var parent *traceEnv
+	for i, block := range config.Blocks {
+		if block.Block.Number == nil {
+			block.Block.Number = (*hexutil.Big)(new(big.Int).Set(number))
+		}
+		number = new(big.Int).Add(block.Block.Number.ToInt(), big.NewInt(1))
+		if config.AutoBaseFee && block.Block.BaseFee == nil && parent != nil {
+			block.Block.BaseFee = (*hexutil.Big)(parent.childBaseFee(uint64(blockResults[i-1].GasUsed)))
+		}
+
+		blockConfig := config.TraceConfig
+		blockConfig.Block = block.Block
+		blockConfig.Transactions = block.Transactions
+		blockConfig.HistoryHashes = nil
+		blockConfig.BlockHashes = blockHashes
+		env, err := newTraceEnv(blockConfig)
+		if err != nil {
+			return nil, fmt.Errorf("blocks[%d]: %w", i, err)
+		}
+		if blockResults[i], err = env.traceBlock(stateDB, blockConfig); err != nil {
+			return nil, fmt.Errorf("blocks[%d]: %w", i, err)
+		}
+		blockHashes[hexutil.Uint64(env.blockCtx.BlockNumber.Uint64())] = blockResults[i].Hash
+		parent = env
+	}
+	return blockResults, nil
+}
+
+// childBaseFee returns the base fee of the block after the one of env, which
+// used gasUsed gas, if it is past London.
+// Modified from github.com/ethereum/go-ethereum/consensus/misc.CalcBaseFee
+func (env *traceEnv) childBaseFee(gasUsed uint64) *big.Int {
+	number := new(big.Int).Add(env.blockCtx.BlockNumber, big.NewInt(1))
+	if !env.chainConfig.IsLondon(number) {
+		return nil
+	}
+	if !env.chainConfig.IsLondon(env.blockCtx.BlockNumber) {
+		return new(big.Int).SetUint64(params.InitialBaseFee)
+	}
+	return CalcBaseFee(gasUsed, env.blockCtx.GasLimit/params.ElasticityMultiplier, env.blockCtx.BaseFee)
+}
+
+// CalcBaseFee returns the base fee of a block by EIP-1559, given the gas
+// used by its parent, the gas target of its parent, which is half its gas
+// limit, and the base fee of its parent.
+// Modified from github.com/ethereum/go-ethereum/consensus/misc.CalcBaseFee
+func CalcBaseFee(parentGasUsed, parentGasTarget uint64, parentBaseFee *big.Int) *big.Int {
+	if parentGasUsed == parentGasTarget || parentGasTarget == 0 {
+		return new(big.Int).Set(parentBaseFee)
+	}
+	target := new(big.Int).SetUint64(parentGasTarget)
+	denominator := new(big.Int).SetUint64(params.BaseFeeChangeDenominator)
+	if parentGasUsed > parentGasTarget {
+		// The base fee increases by at least 1.
+		delta := new(big.Int).SetUint64(parentGasUsed - parentGasTarget)
+		delta.Mul(delta, parentBaseFee)
+		delta.Div(delta, target)
+		delta.Div(delta, denominator)
+		if delta.Sign() == 0 {
+			delta.SetUint64(1)
+		}
+		return delta.Add(parentBaseFee, delta)
+	}
+	delta := new(big.Int).SetUint64(parentGasTarget - parentGasUsed)
+	delta.Mul(delta, parentBaseFee)
+	delta.Div(delta, target)
+	delta.Div(delta, denominator)
+	baseFee := delta.Sub(parentBaseFee, delta)
+	if baseFee.Sign() < 0 {
+		return new(big.Int)
+	}
+	return baseFee
+}
+
+// traceBlock traces the transactions of config as a block on stateDB, see
+// TraceBlock.
+func (env *traceEnv) traceBlock(stateDB *StateDB, config TraceConfig) (*BlockTraceResult, error) {
+	env.processBeaconRoot(stateDB)
+
+	var err error
+	blockResult := &BlockTraceResult{
+		Results: make([]*ExecutionResult, len(config.Transactions)),
+		Blooms:  make([]types.Bloom, len(config.Transactions)),
+	}
+	var txs [][]byte
+	var receipts []*types.Receipt
+	var gasUsed uint64
+	for i := range env.messages {
+		tx, err := env.encodeTx(config, i)
+		if err != nil {
+			return nil, NewTraceError(ErrCodeInternal, err, "Failed to encode config.Transactions[%d]: %v", i, err)
+		}
+		// The logs of the transaction are recorded under its hash.
+		txHash := crypto.Keccak256Hash(tx)
+		stateDB.Prepare(txHash, i)
+		result, err := env.trace(context.Background(), stateDB, i, config)
+		if err != nil {
+			return nil, err
+		}
+		blockResult.Results[i] = result
+		// A rejected transaction isn't part of the block.
+		if result.Rejected {
+			continue
+		}
+
+		gasUsed += result.Gas
+		receipt := &types.Receipt{
+			Type:              encodedTxType(config.Transactions[i]),
+			CumulativeGasUsed: gasUsed,
+			Logs:              stateDB.GetLogs(txHash, common.Hash{}),
+		}
+		if env.chainConfig.IsByzantium(env.blockCtx.BlockNumber) {
+			receipt.Status = types.ReceiptStatusSuccessful
+			if result.Failed {
+				receipt.Status = types.ReceiptStatusFailed
+			}
+		} else {
+			receipt.PostState = stateDB.IntermediateRoot(env.isEIP158()).Bytes()
+		}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		blockResult.Blooms[i] = receipt.Bloom
+		txs = append(txs, tx)
+		receipts = append(receipts, receipt)
+	}
+
+	blockResult.Fees = sumFees(blockResult.Results)
+
+	if reward := config.Block.Reward; reward != nil {
+		coinbase := config.Block.Coinbase
+		stateDB.watchCoinbase(coinbase)
+		balance := new(big.Int).Set(stateDB.GetBalance(coinbase))
+		stateDB.AddBalance(coinbase, reward.ToInt())
+		blockResult.Reward = newCoinbaseRes(stateDB, balance, env.isEIP158())
+	}
+	applyWithdrawals(stateDB, config.Block.Withdrawals)
+	blockResult.StateRoot = stateDB.IntermediateRoot(env.isEIP158())
+	blockResult.GasUsed = hexutil.Uint64(gasUsed)
+	blockResult.TransactionsRoot, blockResult.ReceiptsRoot = deriveRoots(txs, receipts)
+	blockResult.LogsBloom = types.CreateBloom(receipts)
+	fields := HeaderFields{
+		StateRoot:        blockResult.StateRoot,
+		TransactionsRoot: blockResult.TransactionsRoot,
+		ReceiptsRoot:     blockResult.ReceiptsRoot,
+		Bloom:            blockResult.LogsBloom,
+		GasUsed:          gasUsed,
+	}
+	header := env.header(config, fields)
+	if blockResult.Header, err = header.RLP(); err != nil {
+		return nil, NewTraceError(ErrCodeInternal, err, "Failed to encode the header: %v", err)
+	}
+	blockResult.Hash = header.Hash()
+	return blockResult, nil
+}
+
+var (
+	// systemAddress is the caller of the system calls of EIP-4788.
+	systemAddress = common.HexToAddress("0xfffffffffffffffffffffffffffffffffffffffe")
+	// beaconRootsAddress is the beacon roots contract of EIP-4788.
+	beaconRootsAddress = common.HexToAddress("0x000F3df6D732807Ef1319fB7B8bB8522d0Beac02")
+)
+
+// beaconRootGas is the gas of the system call of EIP-4788.
+const beaconRootGas = 30_000_000
+
+// processBeaconRoot stores the parent beacon block root of the block in the
+// beacon roots contract by the system call of EIP-4788, if it is set.
+// Modified from github.com/ethereum/go-ethereum/core.ProcessBeaconBlockRoot
+func (env *traceEnv) processBeaconRoot(stateDB *StateDB) {
+	if env.beaconRoot == nil {
+		return
+	}
+	txCtx := vm.TxContext{Origin: systemAddress, GasPrice: new(big.Int)}
+	evm := vm.NewEVM(env.blockCtx, txCtx, stateDB, env.chainConfig, env.vmConfig(nil))
+	stateDB.StateDB.AddAddressToAccessList(beaconRootsAddress)
+	_, _, _ = evm.Call(vm.AccountRef(systemAddress), beaconRootsAddress, env.beaconRoot[:], beaconRootGas, new(big.Int))
+	stateDB.Finalise(true)
+	// The accesses of the system call aren't the ones of the first step.
+	stateDB.takeColdAccesses()
+	stateDB.takeRefundDelta()
+}
+
+// applyWithdrawals credits the withdrawals to stateDB.
+// Modified from github.com/ethereum/go-ethereum/consensus/beacon.Beacon.Finalize
+func applyWithdrawals(stateDB *StateDB, withdrawals []Withdrawal) {
+	for _, withdrawal := range withdrawals {
+		amount := new(big.Int).SetUint64(uint64(withdrawal.Amount))
+		amount.Mul(amount, big.NewInt(params.GWei))
+		stateDB.AddBalance(withdrawal.Address, amount)
+	}
+}
@@ -0,0 +1,43 @@
+package gethutil
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/holiman/uint256"
+)
+
+// BlockHashRes is a lookup of a block hash by a BLOCKHASH step.
+type BlockHashRes struct {
+	Number *hexutil.Big `json:"number"`
+	// Hash is the hash returned, which is 0 outside of the window of the 256
+	// blocks before the current one.
+	Hash     common.Hash `json:"hash"`
+	InWindow bool        `json:"inWindow"`
+}
+
+// recordBlockHash records the lookup of a BLOCKHASH step of op with stack.
+// Modified from github.com/ethereum/go-ethereum/core/vm.opBlockhash
+func (l *StructLogger) recordBlockHash(op vm.OpCode, stack []uint256.Int) {
+	if op != vm.BLOCKHASH || len(stack) < 1 {
+		return
+	}
+	number := stack[len(stack)-1]
+	lookup := BlockHashRes{Number: (*hexutil.Big)(number.ToBig())}
+	if num64, overflow := number.Uint64WithOverflow(); !overflow {
+		upper := l.env.Context.BlockNumber.Uint64()
+		var lower uint64
+		if upper > 256 {
+			lower = upper - 256
+		}
+		if num64 >= lower && num64 < upper {
+			lookup.Hash = l.env.Context.GetHash(num64)
+			lookup.InWindow = true
+		}
+	}
+	l.blockHashes = append(l.blockHashes, lookup)
+}
+
+// BlockHashes returns the lookups of the BLOCKHASH steps of the transaction
+// in order.
+func (l *StructLogger) BlockHashes() []BlockHashRes { return l.blockHashes }
@@ -0,0 +1,207 @@
+//go:build !js
+// +build !js
+
+package gethutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// BlockTest is a case of the BlockchainTests of the Ethereum tests.
+// Modified from github.com/ethereum/go-ethereum/tests.BlockTest
+type BlockTest struct {
+	Genesis struct {
+		Hash      common.Hash `json:"hash"`
+		StateRoot common.Hash `json:"stateRoot"`
+	} `json:"genesisBlockHeader"`
+	Pre           core.GenesisAlloc `json:"pre"`
+	Blocks        []BlockTestBlock  `json:"blocks"`
+	LastBlockHash common.Hash       `json:"lastblockhash"`
+	Network       string            `json:"network"`
+}
+
+// BlockTestBlock is a block of a BlockTest, which is invalid if an exception
+// is expected.
+type BlockTestBlock struct {
+	RLP             hexutil.Bytes `json:"rlp"`
+	ExpectException string        `json:"expectException"`
+}
+
+// BlockResult is the result of a block applied by BlockTest.Run.
+type BlockResult struct {
+	Number    uint64             `json:"number"`
+	Hash      common.Hash        `json:"hash"`
+	StateRoot common.Hash        `json:"stateRoot"`
+	Results   []*ExecutionResult `json:"results,omitempty"`
+}
+
+// LoadBlockTests loads the block tests of a BlockchainTests fixture file by
+// name.
+func LoadBlockTests(path string) (map[string]*BlockTest, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tests map[string]*BlockTest
+	if err := json.Unmarshal(bytes, &tests); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal block tests of %s: %w", path, err)
+	}
+	return tests, nil
+}
+
+// canonicalChain returns the valid blocks of t from the first one to the
+// one of t.LastBlockHash, leaving out the blocks of the other branches.
+func (t *BlockTest) canonicalChain() ([]*types.Block, error) {
+	blocks := make(map[common.Hash]*types.Block)
+	for i, block := range t.Blocks {
+		if block.ExpectException != "" {
+			continue
+		}
+		var decoded types.Block
+		if err := rlp.DecodeBytes(block.RLP, &decoded); err != nil {
+			return nil, fmt.Errorf("failed to decode block %d: %w", i, err)
+		}
+		blocks[decoded.Hash()] = &decoded
+	}
+
+	var chain []*types.Block
+	for hash := t.LastBlockHash; hash != t.Genesis.Hash; {
+		block, ok := blocks[hash]
+		if !ok {
+			return nil, fmt.Errorf("block %x of the canonical chain is missing", hash)
+		}
+		chain = append(chain, block)
+		hash = block.ParentHash()
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
+
+// Run imports the genesis of t and applies the blocks of its canonical chain
+// in order, tracing their transactions and checking the state root and the
+// gas used by each block. The traces of the transactions are only kept in
+// the results if keepTraces is set. The invalid blocks are skipped instead
+// of being checked to fail.
+func (t *BlockTest) Run(keepTraces bool) ([]*BlockResult, error) {
+	chainConfig, err := newChainConfig(big.NewInt(1), t.Network)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := t.canonicalChain()
+	if err != nil {
+		return nil, err
+	}
+
+	stateDB, err := newStateDB(TraceConfig{Accounts: genesisAccounts(t.Pre)})
+	if err != nil {
+		return nil, err
+	}
+	if root := stateDB.IntermediateRoot(false); root != t.Genesis.StateRoot {
+		return nil, fmt.Errorf("genesis state root mismatch: got %x, want %x", root, t.Genesis.StateRoot)
+	}
+
+	hashes := []common.Hash{t.Genesis.Hash}
+	blockResults := make([]*BlockResult, len(chain))
+	for i, block := range chain {
+		header := block.Header()
+		signer := types.MakeSigner(chainConfig, header.Number)
+		txs := make([]Transaction, len(block.Transactions()))
+		for j, tx := range block.Transactions() {
+			if txs[j], err = newTransaction(tx, signer); err != nil {
+				return nil, fmt.Errorf("block %d: %w", header.Number, err)
+			}
+		}
+		config := TraceConfig{
+			ChainID: (*hexutil.Big)(big.NewInt(1)),
+			Block: Block{
+				Coinbase:   header.Coinbase,
+				Timestamp:  (*hexutil.Big)(new(big.Int).SetUint64(header.Time)),
+				Number:     (*hexutil.Big)(header.Number),
+				Difficulty: (*hexutil.Big)(header.Difficulty),
+				GasLimit:   (*hexutil.Big)(new(big.Int).SetUint64(header.GasLimit)),
+				BaseFee:    (*hexutil.Big)(header.BaseFee),
+			},
+			Transactions: txs,
+			Fork:         t.Network,
+			GetHash: func(n uint64) common.Hash {
+				return hashes[n]
+			},
+		}
+		if isMerged(chainConfig) {
+			config.Block.Random = &header.MixDigest
+		}
+		env, err := newTraceEnv(config)
+		if err != nil {
+			return nil, err
+		}
+
+		blockResult := &BlockResult{Number: header.Number.Uint64(), Hash: block.Hash()}
+		var gasUsed uint64
+		for j := range env.messages {
+			result, err := env.trace(context.Background(), stateDB, j, config)
+			if err != nil {
+				return nil, fmt.Errorf("block %d: %w", header.Number, err)
+			}
+			gasUsed += result.Gas
+			if keepTraces {
+				blockResult.Results = append(blockResult.Results, result)
+			}
+		}
+		if gasUsed != header.GasUsed {
+			return nil, fmt.Errorf("block %d: gas used mismatch: got %d, want %d", header.Number, gasUsed, header.GasUsed)
+		}
+
+		if !isMerged(chainConfig) {
+			accumulateRewards(chainConfig.IsByzantium(header.Number), chainConfig.IsConstantinople(header.Number), stateDB, header, block.Uncles())
+		}
+		blockResult.StateRoot = stateDB.IntermediateRoot(env.isEIP158())
+		if blockResult.StateRoot != header.Root {
+			return nil, fmt.Errorf("block %d: state root mismatch: got %x, want %x", header.Number, blockResult.StateRoot, header.Root)
+		}
+
+		hashes = append(hashes, block.Hash())
+		blockResults[i] = blockResult
+	}
+	return blockResults, nil
+}
+
+// accumulateRewards credits the coinbase of header with the block reward and
+// the rewards for including uncles, and the coinbases of the uncles with
+// their rewards.
+// Modified from github.com/ethereum/go-ethereum/consensus/ethash.accumulateRewards
+func accumulateRewards(isByzantium, isConstantinople bool, stateDB *StateDB, header *types.Header, uncles []*types.Header) {
+	blockReward := ethash.FrontierBlockReward
+	if isByzantium {
+		blockReward = ethash.ByzantiumBlockReward
+	}
+	if isConstantinople {
+		blockReward = ethash.ConstantinopleBlockReward
+	}
+
+	reward := new(big.Int).Set(blockReward)
+	r := new(big.Int)
+	for _, uncle := range uncles {
+		r.Add(uncle.Number, big.NewInt(8))
+		r.Sub(r, header.Number)
+		r.Mul(r, blockReward)
+		r.Div(r, big.NewInt(8))
+		stateDB.AddBalance(uncle.Coinbase, r)
+
+		r.Div(blockReward, big.NewInt(32))
+		reward.Add(reward, r)
+	}
+	stateDB.AddBalance(header.Coinbase, reward)
+}
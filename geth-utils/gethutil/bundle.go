@@ -0,0 +1,60 @@
+package gethutil
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// BundleConfig is a TraceConfig whose transactions run against the same
+// evolving state, where the state changes of some of them can be discarded.
+type BundleConfig struct {
+	TraceConfig
+	// Revert[i] discards the state changes of Transactions[i] after it is
+	// traced, so the next transaction runs against the state before it.
+	Revert []bool `json:"revert"`
+}
+
+// BundleResult holds the traces of the transactions of a bundle, and the
+// state roots after each of them.
+type BundleResult struct {
+	Results    []*ExecutionResult `json:"results"`
+	StateRoots []common.Hash      `json:"stateRoots"`
+}
+
+// TraceBundle traces the transactions of config in sequence like Trace, and
+// returns the state root after each transaction, which is the one before it
+// if its state changes are discarded.
+func TraceBundle(config BundleConfig) (*BundleResult, error) {
+	env, err := newTraceEnv(config.TraceConfig)
+	if err != nil {
+		return nil, err
+	}
+	stateDB, err := newStateDB(config.TraceConfig)
+	if err != nil {
+		return nil, err
+	}
+	env.processBeaconRoot(stateDB)
+
+	bundleResult := &BundleResult{
+		Results:    make([]*ExecutionResult, len(config.Transactions)),
+		StateRoots: make([]common.Hash, len(config.Transactions)),
+	}
+	for i := range env.messages {
+		revert := i < len(config.Revert) && config.Revert[i]
+		var saved *StateDB
+		if revert {
+			saved = NewStateDB(stateDB.StateDB.Copy())
+		}
+
+		if bundleResult.Results[i], err = env.trace(context.Background(), stateDB, i, config.TraceConfig); err != nil {
+			return nil, err
+		}
+
+		if revert {
+			stateDB = saved
+		}
+		bundleResult.StateRoots[i] = stateDB.IntermediateRoot(env.isEIP158())
+	}
+	return bundleResult, nil
+}
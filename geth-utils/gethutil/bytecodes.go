@@ -0,0 +1,51 @@
+package gethutil
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+)
+
+// recordBytecodes records the code run by the current call frame on its
+// first step, as well as its hash in the frame, and the code read by an
+// EXTCODECOPY or EXTCODEHASH step of op with stack.
+func (l *StructLogger) recordBytecodes(op vm.OpCode, contract *vm.Contract, stack []uint256.Int) {
+	if n := len(l.frames); n > 0 && !l.frames[n-1].codeRecorded {
+		l.frames[n-1].codeRecorded = true
+		l.addBytecode(contract.Code)
+		codeHash := crypto.Keccak256Hash(contract.Code)
+		l.calls[l.frames[n-1].id-1].CodeHash = &codeHash
+	}
+	if (op == vm.EXTCODECOPY || op == vm.EXTCODEHASH) && len(stack) >= 1 {
+		l.addBytecode(l.env.StateDB.GetCode(common.Address(stack[len(stack)-1].Bytes20())))
+	}
+}
+
+// addBytecode records code by its hash, unless it is empty.
+func (l *StructLogger) addBytecode(code []byte) {
+	if len(code) == 0 {
+		return
+	}
+	if l.bytecodes == nil {
+		l.bytecodes = make(map[common.Hash][]byte)
+	}
+	l.bytecodes[crypto.Keccak256Hash(code)] = code
+}
+
+// Bytecodes returns the code run or read by the transaction by its hash,
+// which is the init code for the creations.
+func (l *StructLogger) Bytecodes() map[common.Hash][]byte { return l.bytecodes }
+
+// FormatBytecodes formats bytecodes for json output.
+func FormatBytecodes(bytecodes map[common.Hash][]byte) map[common.Hash]hexutil.Bytes {
+	if len(bytecodes) == 0 {
+		return nil
+	}
+	formatted := make(map[common.Hash]hexutil.Bytes, len(bytecodes))
+	for hash, code := range bytecodes {
+		formatted[hash] = code
+	}
+	return formatted
+}
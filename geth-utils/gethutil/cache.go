@@ -0,0 +1,145 @@
+//go:build !js
+// +build !js
+
+package gethutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// cacheVersion identifies the encoding of the cached results, derived from
+// TraceSchemaVersion and the shapes of TraceConfig and ExecutionResult, so
+// that a field added to either invalidates the cached results.
+var cacheVersion = encodingHash(TraceSchemaVersion, reflect.TypeOf(TraceConfig{}), reflect.TypeOf(ExecutionResult{}))
+
+// encodingHash returns the hash of version and of the shapes of types: their
+// fields with their JSON tags, recursively.
+func encodingHash(version int, types ...reflect.Type) common.Hash {
+	var shape strings.Builder
+	fmt.Fprintf(&shape, "v%d", version)
+	seen := make(map[reflect.Type]bool)
+	for _, typ := range types {
+		shape.WriteByte(';')
+		writeShape(&shape, typ, seen)
+	}
+	return crypto.Keccak256Hash([]byte(shape.String()))
+}
+
+// writeShape writes the shape of typ to shape, writing the structs already
+// in seen by name only.
+func writeShape(shape *strings.Builder, typ reflect.Type, seen map[reflect.Type]bool) {
+	switch typ.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		shape.WriteString(typ.Kind().String() + " ")
+		writeShape(shape, typ.Elem(), seen)
+	case reflect.Array:
+		fmt.Fprintf(shape, "[%d]", typ.Len())
+		writeShape(shape, typ.Elem(), seen)
+	case reflect.Map:
+		shape.WriteString("map[")
+		writeShape(shape, typ.Key(), seen)
+		shape.WriteString("]")
+		writeShape(shape, typ.Elem(), seen)
+	case reflect.Struct:
+		shape.WriteString(typ.String())
+		if seen[typ] {
+			return
+		}
+		seen[typ] = true
+		shape.WriteString("{")
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			fmt.Fprintf(shape, "%s %q ", field.Name, field.Tag.Get("json"))
+			writeShape(shape, field.Type, seen)
+			shape.WriteString(";")
+		}
+		shape.WriteString("}")
+	default:
+		shape.WriteString(typ.String())
+	}
+}
+
+// configHash returns the hash of the canonicalized config, which is its JSON
+// serialization (with sorted map keys) salted by the cache and geth versions.
+func configHash(config TraceConfig) (common.Hash, error) {
+	bytes, err := json.Marshal(config)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	salt := fmt.Sprintf("gethutil-cache-%x-geth-%s", cacheVersion, params.VersionWithMeta)
+	return crypto.Keccak256Hash([]byte(salt), bytes), nil
+}
+
+// TraceCached is Trace backed by an on-disk cache in dir. The results are
+// stored under the hash of the canonicalized config, and returned without
+// re-executing when the same config is traced again. Failed traces are not
+// cached, nor are interrupted ones.
+func TraceCached(config TraceConfig, dir string) ([]*ExecutionResult, error) {
+	// The outputs of GetHash, StepEstimators, OnStep, L1DataFee and
+	// ConfigureVM, and the contents of the files of the accounts, aren't part
+	// of the hash of the config.
+	if config.GetHash != nil || config.StepEstimators != nil || config.OnStep != nil || config.L1DataFee != nil || config.ConfigureVM != nil || config.hasAccountFiles() {
+		return Trace(config)
+	}
+
+	key, err := configHash(config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to hash config: %w", err)
+	}
+	path := filepath.Join(dir, key.Hex()[2:]+".json")
+
+	if bytes, err := os.ReadFile(path); err == nil {
+		var results []*ExecutionResult
+		if err := json.Unmarshal(bytes, &results); err == nil {
+			return results, nil
+		}
+		// Fall through to re-trace and overwrite a corrupted entry.
+	}
+
+	results, err := Trace(config)
+	if err != nil {
+		return nil, err
+	}
+	if n := len(results); n > 0 && results[n-1].Interrupted {
+		return results, nil
+	}
+
+	// An entry which can't be written only costs tracing the config again.
+	_ = writeCacheEntry(dir, path, results)
+	return results, nil
+}
+
+// writeCacheEntry writes the results into a temporary file first, so that
+// concurrent readers never observe a partial entry.
+func writeCacheEntry(dir, path string, results []*ExecutionResult) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	bytes, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bytes); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
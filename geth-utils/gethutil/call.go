@@ -0,0 +1,71 @@
+package gethutil
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// CallResult is the outcome of a transaction run without tracing.
+type CallResult struct {
+	Gas         uint64      `json:"gas"`
+	Failed      bool        `json:"failed"`
+	ReturnValue string      `json:"returnValue"`
+	Error       *TraceError `json:"error,omitempty"`
+}
+
+// CallTxs runs the transactions of config like Trace, but without the struct
+// logger, and returns only their outcomes. It is much cheaper than Trace to
+// decide whether a trace is worth generating.
+func CallTxs(config TraceConfig) ([]*CallResult, error) {
+	env, err := newTraceEnv(config)
+	if err != nil {
+		return nil, err
+	}
+	stateDB, err := newStateDB(config)
+	if err != nil {
+		return nil, err
+	}
+	env.processBeaconRoot(stateDB)
+
+	callResults := make([]*CallResult, len(env.messages))
+	for i := range env.messages {
+		env.mint(stateDB, i)
+		message := env.message(stateDB, i)
+		_, err := env.chargeL1Fee(stateDB, i, message, config)
+		var result *core.ExecutionResult
+		if err == nil {
+			result, err = env.apply(stateDB, i, message, config)
+		}
+		if err != nil {
+			return nil, NewTraceError(txErrorCode(err), err, "Failed to apply config.Transactions[%d]: %v", i, err)
+		}
+		callResults[i] = &CallResult{
+			Gas:         result.UsedGas + env.authorizationGas(i),
+			Failed:      result.Failed(),
+			ReturnValue: fmt.Sprintf("%x", result.ReturnData),
+			Error:       executionError(result),
+		}
+	}
+	return callResults, nil
+}
+
+// apply applies message, the i-th one, to stateDB without tracing, with the
+// sender checks of config.
+func (env *traceEnv) apply(stateDB *StateDB, i int, message types.Message, config TraceConfig) (*core.ExecutionResult, error) {
+	if config.SkipBalanceCheck {
+		creditShortfall(stateDB, message)
+	}
+	if _, err := env.authorize(stateDB, i, message, config); err != nil {
+		return nil, err
+	}
+	evm := vm.NewEVM(env.blockCtx, core.NewEVMTxContext(message), stateDB, env.chainConfig, env.vmConfig(nil))
+	result, err := applyMessage(evm, stateDB, message, config)
+	if err != nil {
+		return nil, err
+	}
+	stateDB.Finalise(env.isEIP158())
+	return result, nil
+}
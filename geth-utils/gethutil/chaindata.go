@@ -0,0 +1,31 @@
+package gethutil
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// chainDatas are the chaindata directories opened by openChainData by path,
+// which stay open for the lifetime of the process.
+var chainDatas = struct {
+	sync.Mutex
+	dbs map[string]ethdb.Database
+}{dbs: make(map[string]ethdb.Database)}
+
+// openChainData opens the LevelDB chaindata directory of a geth node at path
+// read-only, or returns it if it is already open.
+func openChainData(path string) (ethdb.Database, error) {
+	chainDatas.Lock()
+	defer chainDatas.Unlock()
+	if db, ok := chainDatas.dbs[path]; ok {
+		return db, nil
+	}
+	db, err := rawdb.NewLevelDBDatabase(path, 16, 16, "gethutil/chaindata/", true)
+	if err != nil {
+		return nil, err
+	}
+	chainDatas.dbs[path] = db
+	return db, nil
+}
@@ -0,0 +1,100 @@
+package gethutil
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+)
+
+// Continuation is the state of the machine before a step, from which the
+// execution can be resumed at the step.
+type Continuation struct {
+	// Step is the index of the step in the captured steps.
+	Step   int
+	Pc     uint64
+	Depth  int
+	CallID int
+	Gas    uint64
+	Refund uint64
+	// Stack is the whole stack, which isn't limited by StackTopN.
+	Stack      []uint256.Int
+	MemorySize uint64
+	MemoryHash common.Hash
+	// Storage are the current values of the storage slots accessed by the
+	// previous steps.
+	Storage map[common.Address]map[common.Hash]common.Hash
+}
+
+// continuation returns the continuation of the step about to be captured.
+func (l *StructLogger) continuation(pc, gas uint64, depth int, stack []uint256.Int, memory []byte) Continuation {
+	frame, _ := l.currentFrame()
+	// The memory is captured after its expansion by the step.
+	memory = memory[:frame.memSize]
+	c := Continuation{
+		Step:       l.captured,
+		Pc:         pc,
+		Depth:      depth,
+		CallID:     frame.id,
+		Gas:        gas,
+		Refund:     l.env.StateDB.GetRefund(),
+		Stack:      make([]uint256.Int, len(stack)),
+		MemorySize: frame.memSize,
+		MemoryHash: crypto.Keccak256Hash(memory),
+		Storage:    make(map[common.Address]map[common.Hash]common.Hash, len(l.storage)),
+	}
+	copy(c.Stack, stack)
+	for address, slots := range l.storage {
+		values := make(map[common.Hash]common.Hash, len(slots))
+		for key := range slots {
+			values[key] = l.env.StateDB.GetState(address, key)
+		}
+		c.Storage[address] = values
+	}
+	return c
+}
+
+// ChunkRes is a chunk of the steps of an ExecutionResult, from its Start-th
+// step to the one before its End-th step, with the state of the machine
+// before its first step.
+type ChunkRes struct {
+	Start      int                                            `json:"start"`
+	End        int                                            `json:"end"`
+	Pc         uint64                                         `json:"pc"`
+	Depth      int                                            `json:"depth"`
+	CallID     int                                            `json:"callId"`
+	Gas        uint64                                         `json:"gas"`
+	Refund     uint64                                         `json:"refund"`
+	Stack      []string                                       `json:"stack"`
+	MemorySize uint64                                         `json:"memorySize"`
+	MemoryHash common.Hash                                    `json:"memoryHash"`
+	Storage    map[common.Address]map[common.Hash]common.Hash `json:"storage"`
+}
+
+// FormatChunks formats the continuations of the chunks of steps steps.
+func FormatChunks(continuations []Continuation, steps int) []ChunkRes {
+	chunks := make([]ChunkRes, len(continuations))
+	for i, c := range continuations {
+		end := steps
+		if i+1 < len(continuations) {
+			end = continuations[i+1].Step
+		}
+		stack := make([]string, len(c.Stack))
+		for j := range c.Stack {
+			stack[j] = string(appendHexQuantity(nil, &c.Stack[j]))
+		}
+		chunks[i] = ChunkRes{
+			Start:      c.Step,
+			End:        end,
+			Pc:         c.Pc,
+			Depth:      c.Depth,
+			CallID:     c.CallID,
+			Gas:        c.Gas,
+			Refund:     c.Refund,
+			Stack:      stack,
+			MemorySize: c.MemorySize,
+			MemoryHash: c.MemoryHash,
+			Storage:    c.Storage,
+		}
+	}
+	return chunks
+}
@@ -0,0 +1,35 @@
+package gethutil
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// CoinbaseRes is a change of the balance of the coinbase: the fees paid by a
+// transaction, or the reward of a block.
+type CoinbaseRes struct {
+	Address common.Address `json:"address"`
+	// Amount is the amount credited to the coinbase, e.g. the priority fees
+	// of a transaction, which is paid after its execution.
+	Amount        *hexutil.Big `json:"amount"`
+	BalanceBefore *hexutil.Big `json:"balanceBefore"`
+	BalanceAfter  *hexutil.Big `json:"balanceAfter"`
+	// Created is set when the credit created the coinbase account.
+	Created bool `json:"created"`
+}
+
+// newCoinbaseRes returns the CoinbaseRes of the last credit of the coinbase
+// watched by stateDB, whose balance was balanceBefore, where deleteEmptyObjects
+// is set past EIP-158.
+func newCoinbaseRes(stateDB *StateDB, balanceBefore *big.Int, deleteEmptyObjects bool) *CoinbaseRes {
+	credit, created := stateDB.takeCoinbaseCredit(deleteEmptyObjects)
+	return &CoinbaseRes{
+		Address:       stateDB.coinbase,
+		Amount:        (*hexutil.Big)(credit),
+		BalanceBefore: (*hexutil.Big)(balanceBefore),
+		BalanceAfter:  (*hexutil.Big)(new(big.Int).Set(stateDB.GetBalance(stateDB.coinbase))),
+		Created:       created,
+	}
+}
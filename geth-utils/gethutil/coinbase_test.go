@@ -0,0 +1,47 @@
+package gethutil
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// TestCoinbaseCreated checks that a fee creates a new coinbase, except a
+// zero fee past EIP-158, which deletes the empty account it touches.
+func TestCoinbaseCreated(t *testing.T) {
+	from := common.HexToAddress("0xfe")
+	to := common.HexToAddress("0xaa")
+	for _, c := range []struct {
+		fork     string
+		gasPrice int64
+		created  bool
+	}{
+		{"London", 0x11, true},
+		{"London", 0x10, false},
+		{"Frontier", 0, true},
+	} {
+		config := TraceConfig{
+			Fork: c.fork,
+			Block: Block{
+				Coinbase: common.HexToAddress("0xc0"),
+				GasLimit: (*hexutil.Big)(hexutil.MustDecodeBig("0x1000000")),
+			},
+			Accounts: map[common.Address]Account{
+				from: {Balance: (*hexutil.Big)(hexutil.MustDecodeBig("0xffffffffffffffffff"))},
+			},
+			Transactions: []Transaction{{From: from, To: &to, GasLimit: 21000, GasPrice: (*hexutil.Big)(big.NewInt(c.gasPrice))}},
+		}
+		if c.fork == "London" {
+			config.Block.BaseFee = (*hexutil.Big)(hexutil.MustDecodeBig("0x10"))
+		}
+		results, err := Trace(config)
+		if err != nil {
+			t.Fatalf("%s, gas price %d: %v", c.fork, c.gasPrice, err)
+		}
+		if coinbase := results[0].Coinbase; coinbase.Created != c.created {
+			t.Errorf("%s, gas price %d: created %v with amount %v, want %v", c.fork, c.gasPrice, coinbase.Created, coinbase.Amount, c.created)
+		}
+	}
+}
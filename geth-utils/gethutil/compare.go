@@ -0,0 +1,128 @@
+package gethutil
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// FieldDiff is a field with different values in two traces.
+type FieldDiff struct {
+	Field string `json:"field"`
+	A     string `json:"a"`
+	B     string `json:"b"`
+}
+
+// CallGasDiff is the difference of the gas used by a call frame in two
+// traces.
+type CallGasDiff struct {
+	CallID int    `json:"callId"`
+	A      uint64 `json:"a"`
+	B      uint64 `json:"b"`
+	Delta  int64  `json:"delta"`
+}
+
+// TraceDiff is the structured difference between two traces.
+type TraceDiff struct {
+	// Step is the index of the first differing step, or -1 if the steps
+	// match.
+	Step int `json:"step"`
+	// Fields are the differing fields of the first differing step, where
+	// "steps" is the number of steps if one trace is a prefix of the other.
+	Fields []FieldDiff `json:"fields,omitempty"`
+	// Result are the differing fields of the outcome of the transactions.
+	Result []FieldDiff `json:"result,omitempty"`
+	// Calls are the call frames, matched by ID, with different gas used.
+	Calls []CallGasDiff `json:"calls,omitempty"`
+}
+
+// Equal returns whether the traces match.
+func (d *TraceDiff) Equal() bool {
+	return d.Step == -1 && len(d.Result) == 0 && len(d.Calls) == 0
+}
+
+// CompareTraces returns the difference between the traces a and b. The steps
+// are compared on the fields of geth's struct logs, so a trace from a geth
+// node can be compared to a local one.
+func CompareTraces(a, b *ExecutionResult) *TraceDiff {
+	diff := &TraceDiff{Step: -1}
+
+	aLogs, bLogs := a.StructLogs.Formatted(), b.StructLogs.Formatted()
+	steps := len(aLogs)
+	if len(bLogs) < steps {
+		steps = len(bLogs)
+	}
+	for i := 0; i < steps && diff.Step == -1; i++ {
+		if fields := compareSteps(&aLogs[i], &bLogs[i]); len(fields) > 0 {
+			diff.Step = i
+			diff.Fields = fields
+		}
+	}
+	if diff.Step == -1 && len(aLogs) != len(bLogs) {
+		diff.Step = steps
+		diff.Fields = []FieldDiff{{"steps", strconv.Itoa(len(aLogs)), strconv.Itoa(len(bLogs))}}
+	}
+
+	diff.Result = compareFields([]FieldDiff{
+		{"gas", fmt.Sprint(a.Gas), fmt.Sprint(b.Gas)},
+		{"failed", fmt.Sprint(a.Failed), fmt.Sprint(b.Failed)},
+		{"returnValue", a.ReturnValue, b.ReturnValue},
+	})
+
+	gasUsed := make(map[int]uint64, len(a.Calls))
+	for _, call := range a.Calls {
+		gasUsed[call.CallID] = uint64(call.GasUsed)
+	}
+	for _, call := range b.Calls {
+		if aGasUsed, ok := gasUsed[call.CallID]; ok && aGasUsed != uint64(call.GasUsed) {
+			diff.Calls = append(diff.Calls, CallGasDiff{
+				CallID: call.CallID,
+				A:      aGasUsed,
+				B:      uint64(call.GasUsed),
+				Delta:  int64(uint64(call.GasUsed) - aGasUsed),
+			})
+		}
+	}
+	sort.Slice(diff.Calls, func(i, j int) bool { return diff.Calls[i].CallID < diff.Calls[j].CallID })
+
+	return diff
+}
+
+func compareSteps(a, b *StructLogRes) []FieldDiff {
+	return compareFields([]FieldDiff{
+		{"pc", fmt.Sprint(a.Pc), fmt.Sprint(b.Pc)},
+		{"op", a.Op, b.Op},
+		{"gas", fmt.Sprint(a.Gas), fmt.Sprint(b.Gas)},
+		{"gasCost", fmt.Sprint(a.GasCost), fmt.Sprint(b.GasCost)},
+		{"depth", fmt.Sprint(a.Depth), fmt.Sprint(b.Depth)},
+		{"error", a.Error, b.Error},
+		{"stack", fmt.Sprint(derefStrings(a.Stack)), fmt.Sprint(derefStrings(b.Stack))},
+		{"memory", fmt.Sprint(derefStrings(a.Memory)), fmt.Sprint(derefStrings(b.Memory))},
+		{"storage", fmt.Sprint(derefStorage(a.Storage)), fmt.Sprint(derefStorage(b.Storage))},
+	})
+}
+
+// compareFields returns the fields with different values.
+func compareFields(fields []FieldDiff) []FieldDiff {
+	var diffs []FieldDiff
+	for _, field := range fields {
+		if field.A != field.B {
+			diffs = append(diffs, field)
+		}
+	}
+	return diffs
+}
+
+func derefStrings(strings *[]string) []string {
+	if strings == nil {
+		return nil
+	}
+	return *strings
+}
+
+func derefStorage(storage *map[string]string) map[string]string {
+	if storage == nil {
+		return nil
+	}
+	return *storage
+}
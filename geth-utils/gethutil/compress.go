@@ -0,0 +1,126 @@
+package gethutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the algorithm used to compress a serialized trace payload.
+type Compression uint8
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZstd
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("compression(%d)", uint8(c))
+	}
+}
+
+// A payload starts with a header of payloadHeaderLen bytes:
+//
+//	magic (4 bytes) | compression (1 byte) | uncompressed length (8 bytes, big-endian)
+//
+// followed by the (possibly compressed) data.
+var payloadMagic = [4]byte{'G', 'T', 'R', 'C'}
+
+const payloadHeaderLen = 13
+
+var ErrUnsupportedCompression = errors.New("unsupported compression")
+
+// CompressPayload compresses data with the given algorithm and prepends the
+// payload header.
+func CompressPayload(data []byte, c Compression) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(payloadMagic[:])
+	buf.WriteByte(byte(c))
+	var length [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(data)))
+	buf.Write(length[:])
+
+	switch c {
+	case CompressionNone:
+		buf.Write(data)
+	case CompressionGzip:
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case CompressionZstd:
+		w, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			w.Close()
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedCompression, c)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DecompressPayload checks the payload header and returns the decompressed
+// data.
+func DecompressPayload(payload []byte) ([]byte, error) {
+	if len(payload) < payloadHeaderLen || !bytes.Equal(payload[:4], payloadMagic[:]) {
+		return nil, errors.New("invalid payload header")
+	}
+	c := Compression(payload[4])
+	length := binary.BigEndian.Uint64(payload[5:payloadHeaderLen])
+	body := payload[payloadHeaderLen:]
+
+	var data []byte
+	switch c {
+	case CompressionNone:
+		data = body
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = io.ReadAll(r); err != nil {
+			return nil, err
+		}
+	case CompressionZstd:
+		r, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		if data, err = io.ReadAll(r); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedCompression, c)
+	}
+
+	if uint64(len(data)) != length {
+		return nil, fmt.Errorf("payload length mismatch: header says %d, got %d", length, len(data))
+	}
+	return data, nil
+}
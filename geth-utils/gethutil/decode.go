@@ -0,0 +1,207 @@
+package gethutil
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// DecodedRes annotates the call frames and the logs of an ExecutionResult
+// with the functions and events of the ABIs of TraceConfig.ABIs. Calls and
+// Logs are parallel to the Calls and the Logs of the ExecutionResult, with
+// null for the ones which couldn't be decoded.
+type DecodedRes struct {
+	Calls []*DecodedCallRes `json:"calls"`
+	Logs  []*DecodedLogRes  `json:"logs"`
+}
+
+// DecodedCallRes is a call frame decoded by the ABI of its callee, whose
+// label is Contract, see TraceConfig.Labels.
+type DecodedCallRes struct {
+	Contract string          `json:"contract,omitempty"`
+	Function string          `json:"function"`
+	Inputs   []DecodedArgRes `json:"inputs"`
+	// Outputs are set when the call frame succeeded.
+	Outputs []DecodedArgRes `json:"outputs,omitempty"`
+}
+
+// DecodedLogRes is a log decoded by the ABI of its emitter, whose label is
+// Contract.
+type DecodedLogRes struct {
+	Contract string          `json:"contract,omitempty"`
+	Event    string          `json:"event"`
+	Args     []DecodedArgRes `json:"args"`
+}
+
+// DecodedArgRes is a decoded argument. The integers are decimal strings, and
+// the indexed arguments of dynamic types are the hashes in their topics. An
+// address with a label has it in Label.
+type DecodedArgRes struct {
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+	Label string      `json:"label,omitempty"`
+}
+
+// parseABIs parses the ABIs of config by address.
+func parseABIs(config *TraceConfig) (map[common.Address]*abi.ABI, error) {
+	if len(config.ABIs) == 0 {
+		return nil, nil
+	}
+	abis := make(map[common.Address]*abi.ABI, len(config.ABIs))
+	for address, definition := range config.ABIs {
+		parsed, err := abi.JSON(bytes.NewReader(definition))
+		if err != nil {
+			return nil, fmt.Errorf("abis[%s]: %w", address.Hex(), err)
+		}
+		abis[address] = &parsed
+	}
+	return abis, nil
+}
+
+// Decode decodes the call frames and the logs of result by abis, labeling
+// the addresses by labels.
+func Decode(result *ExecutionResult, abis map[common.Address]*abi.ABI, labels map[common.Address]string) *DecodedRes {
+	decoded := &DecodedRes{
+		Calls: make([]*DecodedCallRes, len(result.Calls)),
+		Logs:  make([]*DecodedLogRes, len(result.Logs)),
+	}
+	for i := range result.Calls {
+		decoded.Calls[i] = decodeCall(&result.Calls[i], abis)
+		if call := decoded.Calls[i]; call != nil {
+			call.Contract = labels[result.Calls[i].To]
+			labelArgs(call.Inputs, labels)
+			labelArgs(call.Outputs, labels)
+		}
+	}
+	for i := range result.Logs {
+		decoded.Logs[i] = decodeLog(&result.Logs[i], abis)
+		if log := decoded.Logs[i]; log != nil {
+			log.Contract = labels[result.Logs[i].Address]
+			labelArgs(log.Args, labels)
+		}
+	}
+	return decoded
+}
+
+// decodeCall decodes call by the ABI of its callee, or returns nil.
+func decodeCall(call *CallRes, abis map[common.Address]*abi.ABI) *DecodedCallRes {
+	contractABI, ok := abis[call.To]
+	if !ok || call.CreatedAddress != nil || len(call.Input) < 4 || call.Type == vm.SELFDESTRUCT.String() {
+		return nil
+	}
+	method, err := contractABI.MethodById(call.Input[:4])
+	if err != nil {
+		return nil
+	}
+	inputs, err := decodeArgs(method.Inputs, call.Input[4:])
+	if err != nil {
+		return nil
+	}
+	decoded := &DecodedCallRes{Function: method.Sig, Inputs: inputs}
+	if call.Error == "" {
+		decoded.Outputs, _ = decodeArgs(method.Outputs, call.Output)
+	}
+	return decoded
+}
+
+// decodeLog decodes log by the ABI of its emitter, or returns nil.
+func decodeLog(log *LogRes, abis map[common.Address]*abi.ABI) *DecodedLogRes {
+	contractABI, ok := abis[log.Address]
+	if !ok || len(log.Topics) == 0 {
+		return nil
+	}
+	event, err := contractABI.EventByID(log.Topics[0])
+	if err != nil {
+		return nil
+	}
+	values, err := event.Inputs.NonIndexed().Unpack(log.Data)
+	if err != nil {
+		return nil
+	}
+
+	decoded := &DecodedLogRes{Event: event.Sig, Args: make([]DecodedArgRes, 0, len(event.Inputs))}
+	topics := log.Topics[1:]
+	for _, arg := range event.Inputs {
+		decodedArg := DecodedArgRes{Name: arg.Name, Type: arg.Type.String()}
+		if arg.Indexed {
+			if len(topics) == 0 {
+				return nil
+			}
+			topic := topics[0]
+			topics = topics[1:]
+			switch arg.Type.T {
+			case abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+				decodedArg.Value = topic
+			default:
+				value, err := abi.Arguments{{Type: arg.Type}}.Unpack(topic[:])
+				if err != nil {
+					return nil
+				}
+				decodedArg.Value = abiValue(arg.Type, reflect.ValueOf(value[0]))
+			}
+		} else {
+			decodedArg.Value = abiValue(arg.Type, reflect.ValueOf(values[0]))
+			values = values[1:]
+		}
+		decoded.Args = append(decoded.Args, decodedArg)
+	}
+	return decoded
+}
+
+// labelArgs sets the labels of the address arguments of args.
+func labelArgs(args []DecodedArgRes, labels map[common.Address]string) {
+	for i := range args {
+		if address, ok := args[i].Value.(common.Address); ok {
+			args[i].Label = labels[address]
+		}
+	}
+}
+
+// decodeArgs decodes data as args.
+func decodeArgs(args abi.Arguments, data []byte) ([]DecodedArgRes, error) {
+	values, err := args.Unpack(data)
+	if err != nil {
+		return nil, err
+	}
+	decoded := make([]DecodedArgRes, len(args))
+	for i, arg := range args {
+		decoded[i] = DecodedArgRes{Name: arg.Name, Type: arg.Type.String(), Value: abiValue(arg.Type, reflect.ValueOf(values[i]))}
+	}
+	return decoded, nil
+}
+
+// abiValue returns the value v of typ unpacked by the abi package in a form
+// which marshals without loss: the integers as decimal strings, the bytes as
+// hex, and the tuples as objects by field name.
+func abiValue(typ abi.Type, v reflect.Value) interface{} {
+	switch typ.T {
+	case abi.IntTy, abi.UintTy:
+		return fmt.Sprint(v.Interface())
+	case abi.BytesTy:
+		return hexutil.Bytes(v.Bytes())
+	case abi.FixedBytesTy, abi.FunctionTy:
+		data := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(data), v)
+		return hexutil.Bytes(data)
+	case abi.SliceTy, abi.ArrayTy:
+		elems := make([]interface{}, v.Len())
+		for i := range elems {
+			elems[i] = abiValue(*typ.Elem, v.Index(i))
+		}
+		return elems
+	case abi.TupleTy:
+		fields := make(map[string]interface{}, len(typ.TupleElems))
+		for i, elem := range typ.TupleElems {
+			fields[typ.TupleRawNames[i]] = abiValue(*elem, v.Field(i))
+		}
+		return fields
+	default:
+		return v.Interface()
+	}
+}
@@ -0,0 +1,45 @@
+package gethutil
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// applyDefaults fills the block constants omitted from config with their
+// defaults, and returns the JSON names of the filled fields:
+//   - timestamp, difficulty and base_fee default to 0, and so does random
+//     past the Merge,
+//   - gas_limit defaults to the sum of the gas limits of the transactions,
+//     also when it is 0.
+func (config *TraceConfig) applyDefaults() []string {
+	var applied []string
+	if config.Block.Timestamp == nil {
+		config.Block.Timestamp = (*hexutil.Big)(new(big.Int))
+		applied = append(applied, "block_constants.timestamp")
+	}
+	if config.Block.Difficulty == nil {
+		config.Block.Difficulty = (*hexutil.Big)(new(big.Int))
+		applied = append(applied, "block_constants.difficulty")
+	}
+	if config.Block.Random == nil {
+		if chainConfig, err := newChainConfig(toBigInt(config.ChainID), config.Fork); err == nil && isMerged(chainConfig) {
+			config.Block.Random = &common.Hash{}
+			applied = append(applied, "block_constants.random")
+		}
+	}
+	if config.Block.GasLimit == nil || config.Block.GasLimit.ToInt().Sign() == 0 {
+		gasLimit := new(big.Int)
+		for _, tx := range config.Transactions {
+			gasLimit.Add(gasLimit, new(big.Int).SetUint64(uint64(tx.GasLimit)))
+		}
+		config.Block.GasLimit = (*hexutil.Big)(gasLimit)
+		applied = append(applied, "block_constants.gas_limit")
+	}
+	if config.Block.BaseFee == nil {
+		config.Block.BaseFee = (*hexutil.Big)(new(big.Int))
+		applied = append(applied, "block_constants.base_fee")
+	}
+	return applied
+}
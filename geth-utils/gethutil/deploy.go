@@ -0,0 +1,49 @@
+package gethutil
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// DeploymentRes is the code deployed by a creation call frame, see
+// Deployments.
+type DeploymentRes struct {
+	CallID   int            `json:"callId"`
+	Address  common.Address `json:"address"`
+	Code     hexutil.Bytes  `json:"code"`
+	CodeHash common.Hash    `json:"codeHash"`
+	// DepositGas is the gas charged for storing the code, which is part of
+	// the gas used by the frame.
+	DepositGas uint64 `json:"depositGas"`
+	// Reverted is set when a caller of the frame failed, which discarded
+	// the code.
+	Reverted bool `json:"reverted,omitempty"`
+}
+
+// Deployments returns the code deployed by the successful creation frames
+// of calls, which are in the order they were entered.
+func Deployments(calls []Call) []DeploymentRes {
+	var deployments []DeploymentRes
+	for _, call := range calls {
+		if call.CreatedAddress == nil || call.Err != nil {
+			continue
+		}
+		deployment := DeploymentRes{
+			CallID:     call.ID,
+			Address:    *call.CreatedAddress,
+			Code:       call.Output,
+			CodeHash:   crypto.Keccak256Hash(call.Output),
+			DepositGas: uint64(len(call.Output)) * params.CreateDataGas,
+		}
+		for id := call.CallerID; id != 0; id = calls[id-1].CallerID {
+			if calls[id-1].Err != nil {
+				deployment.Reverted = true
+				break
+			}
+		}
+		deployments = append(deployments, deployment)
+	}
+	return deployments
+}
@@ -0,0 +1,160 @@
+package gethutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// DiffAgainstGeth traces the transaction txHash with the geth node at url
+// (through debug_traceTransaction) and locally on the same pre-state, and
+// returns their difference, see CompareTraces. The pre-state
+// is fetched with the prestateTracer, and the local EVM runs with all forks
+// up to London activated.
+func DiffAgainstGeth(ctx context.Context, url string, txHash common.Hash) (*TraceDiff, error) {
+	client, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to dial %s: %w", url, err)
+	}
+	defer client.Close()
+
+	config, err := FetchTraceConfig(ctx, client, txHash)
+	if err != nil {
+		return nil, err
+	}
+
+	var remote ExecutionResult
+	if err := client.CallContext(ctx, &remote, "debug_traceTransaction", txHash, map[string]interface{}{}); err != nil {
+		return nil, fmt.Errorf("Failed to trace %s remotely: %w", txHash.Hex(), err)
+	}
+
+	results, err := Trace(*config)
+	if err != nil {
+		return nil, err
+	}
+	return CompareTraces(&remote, results[0]), nil
+}
+
+// rpcUint64 is a uint64 encoded as a JSON number or a hex quantity, as the
+// prestateTracer of different geth versions do.
+type rpcUint64 uint64
+
+func (n *rpcUint64) UnmarshalJSON(input []byte) error {
+	var hex hexutil.Uint64
+	if err := json.Unmarshal(input, &hex); err == nil {
+		*n = rpcUint64(hex)
+		return nil
+	}
+	value, err := strconv.ParseUint(string(input), 10, 64)
+	*n = rpcUint64(value)
+	return err
+}
+
+// FetchTraceConfig returns a TraceConfig with the transaction txHash, its
+// block and the pre-state of the accounts it touches, fetched from a geth
+// node.
+func FetchTraceConfig(ctx context.Context, client *rpc.Client, txHash common.Hash) (*TraceConfig, error) {
+	var tx struct {
+		BlockNumber *hexutil.Big      `json:"blockNumber"`
+		From        common.Address    `json:"from"`
+		To          *common.Address   `json:"to"`
+		Nonce       hexutil.Uint64    `json:"nonce"`
+		Value       *hexutil.Big      `json:"value"`
+		Gas         hexutil.Uint64    `json:"gas"`
+		GasPrice    *hexutil.Big      `json:"gasPrice"`
+		GasFeeCap   *hexutil.Big      `json:"maxFeePerGas"`
+		GasTipCap   *hexutil.Big      `json:"maxPriorityFeePerGas"`
+		Input       hexutil.Bytes     `json:"input"`
+		AccessList  *types.AccessList `json:"accessList"`
+	}
+	if err := client.CallContext(ctx, &tx, "eth_getTransactionByHash", txHash); err != nil {
+		return nil, fmt.Errorf("Failed to get transaction %s: %w", txHash.Hex(), err)
+	}
+	if tx.BlockNumber == nil {
+		return nil, fmt.Errorf("Transaction %s is not mined", txHash.Hex())
+	}
+
+	var block struct {
+		Miner      common.Address `json:"miner"`
+		Timestamp  *hexutil.Big   `json:"timestamp"`
+		Number     *hexutil.Big   `json:"number"`
+		Difficulty *hexutil.Big   `json:"difficulty"`
+		GasLimit   *hexutil.Big   `json:"gasLimit"`
+		BaseFee    *hexutil.Big   `json:"baseFeePerGas"`
+	}
+	if err := client.CallContext(ctx, &block, "eth_getBlockByNumber", tx.BlockNumber, false); err != nil {
+		return nil, fmt.Errorf("Failed to get block %v: %w", tx.BlockNumber, err)
+	}
+
+	var chainID hexutil.Big
+	if err := client.CallContext(ctx, &chainID, "eth_chainId"); err != nil {
+		return nil, fmt.Errorf("Failed to get chain id: %w", err)
+	}
+
+	var prestate map[common.Address]struct {
+		Balance *hexutil.Big                `json:"balance"`
+		Nonce   rpcUint64                   `json:"nonce"`
+		Code    hexutil.Bytes               `json:"code"`
+		Storage map[common.Hash]common.Hash `json:"storage"`
+	}
+	if err := client.CallContext(ctx, &prestate, "debug_traceTransaction", txHash, map[string]interface{}{"tracer": "prestateTracer"}); err != nil {
+		return nil, fmt.Errorf("Failed to get pre-state of %s: %w", txHash.Hex(), err)
+	}
+
+	config := &TraceConfig{
+		ChainID: &chainID,
+		Block: Block{
+			Coinbase:   block.Miner,
+			Timestamp:  block.Timestamp,
+			Number:     block.Number,
+			Difficulty: block.Difficulty,
+			GasLimit:   block.GasLimit,
+			BaseFee:    block.BaseFee,
+		},
+		Accounts: make(map[common.Address]Account, len(prestate)),
+	}
+	if config.Block.BaseFee == nil {
+		config.Block.BaseFee = (*hexutil.Big)(new(big.Int))
+	}
+	for address, account := range prestate {
+		config.Accounts[address] = Account{
+			Nonce:   hexutil.Uint64(account.Nonce),
+			Balance: account.Balance,
+			Code:    account.Code,
+			Storage: account.Storage,
+		}
+	}
+
+	transaction := Transaction{
+		From:     tx.From,
+		To:       tx.To,
+		Nonce:    &tx.Nonce,
+		Value:    tx.Value,
+		GasLimit: tx.Gas,
+		CallData: tx.Input,
+	}
+	if tx.GasFeeCap != nil {
+		transaction.GasFeeCap = tx.GasFeeCap
+		transaction.GasTipCap = tx.GasTipCap
+	} else {
+		transaction.GasPrice = tx.GasPrice
+	}
+	if tx.AccessList != nil {
+		for _, tuple := range *tx.AccessList {
+			transaction.AccessList = append(transaction.AccessList, struct {
+				Address     common.Address `json:"address"`
+				StorageKeys []common.Hash  `json:"storage_keys"`
+			}{tuple.Address, tuple.StorageKeys})
+		}
+	}
+	config.Transactions = []Transaction{transaction}
+
+	return config, nil
+}
@@ -0,0 +1,12 @@
+// Package gethutil traces transactions on the EVM of go-ethereum with the
+// steps, call frames and state accesses the zkEVM circuits are checked
+// against.
+//
+// It is the public API of the module, which other projects can import to
+// embed the tracer, while the C library for the Rust crate is a thin shim in
+// lib. Its exported identifiers and the JSON of TraceConfig and
+// ExecutionResult follow semantic versioning, with the releases of the
+// module tagged geth-utils/vX.Y.Z: a minor release only adds to them, and
+// TraceSchemaVersion is bumped when their serialization changes
+// incompatibly.
+package gethutil
@@ -0,0 +1,49 @@
+package gethutil
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+)
+
+// dumpState returns the whole state of s in the format of debug_dumpBlock,
+// with the empty accounts deleted if deleteEmptyObjects is set.
+func (s *StateDB) dumpState(deleteEmptyObjects bool) *state.Dump {
+	// The dump iterates the tries, which are only updated by IntermediateRoot.
+	s.StateDB.IntermediateRoot(deleteEmptyObjects)
+	dump := s.StateDB.RawDump(&state.DumpConfig{OnlyWithAddresses: true})
+	return &dump
+}
+
+// DumpAccounts converts the accounts of dump, e.g. ExecutionResult.StateDump,
+// into the Accounts of a TraceConfig.
+func DumpAccounts(dump *state.Dump) (map[common.Address]Account, error) {
+	accounts := make(map[common.Address]Account, len(dump.Accounts))
+	for address, account := range dump.Accounts {
+		balance, ok := new(big.Int).SetString(account.Balance, 10)
+		if !ok {
+			return nil, fmt.Errorf("accounts[%s]: invalid balance %q", address.Hex(), account.Balance)
+		}
+		storage := make(map[common.Hash]common.Hash, len(account.Storage))
+		for key, value := range account.Storage {
+			// The values are the trimmed bytes of the slots, in hex without
+			// prefix.
+			bytes, err := hex.DecodeString(value)
+			if err != nil {
+				return nil, fmt.Errorf("accounts[%s].storage[%s]: %w", address.Hex(), key.Hex(), err)
+			}
+			storage[key] = common.BytesToHash(bytes)
+		}
+		accounts[address] = Account{
+			Nonce:   hexutil.Uint64(account.Nonce),
+			Balance: (*hexutil.Big)(balance),
+			Code:    hexutil.Bytes(account.Code),
+			Storage: storage,
+		}
+	}
+	return accounts, nil
+}
@@ -0,0 +1,428 @@
+package gethutil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// WriteResults writes results to w as JSON, the same as
+// json.MarshalIndent(results, "", indent), or json.Marshal(results) if indent
+// is empty. The captured steps of the results are encoded directly into a
+// buffer flushed to w, without formatting their StructLogRes and the strings
+// of their words, which dominate the cost of encoding a long trace.
+func WriteResults(w io.Writer, results []*ExecutionResult, indent string) error {
+	if results == nil {
+		_, err := io.WriteString(w, "null")
+		return err
+	}
+	a := &jsonAppender{w: w, indent: indent}
+	a.open('[')
+	for _, result := range results {
+		a.next()
+		if err := a.appendResult(result); err != nil {
+			return err
+		}
+	}
+	a.close(']')
+	if a.err != nil {
+		return a.err
+	}
+	_, err := w.Write(a.buf)
+	return err
+}
+
+// MarshalJSON encodes r like encoding/json, with the captured steps encoded
+// directly, see WriteResults.
+func (r *ExecutionResult) MarshalJSON() ([]byte, error) {
+	a := &jsonAppender{}
+	err := a.appendResult(r)
+	return a.buf, err
+}
+
+// MarshalJSON encodes the steps like the []StructLogRes of Formatted, without
+// formatting them.
+func (s StructLogs) MarshalJSON() ([]byte, error) {
+	a := &jsonAppender{}
+	err := a.appendStructLogs(&s)
+	return a.buf, err
+}
+
+// UnmarshalJSON decodes formatted steps.
+func (s *StructLogs) UnmarshalJSON(input []byte) error {
+	s.captured = nil
+	return json.Unmarshal(input, &s.formatted)
+}
+
+// jsonField is an exported field of a struct encoded by encoding/json.
+type jsonField struct {
+	index     int
+	name      string
+	omitEmpty bool
+}
+
+// resultFields are the fields of ExecutionResult in the order encoded.
+var resultFields = jsonFields(reflect.TypeOf(ExecutionResult{}))
+
+// jsonFields returns the fields of the struct type t encoded by encoding/json,
+// which must not embed structs.
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if field.PkgPath != "" || tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if comma := strings.IndexByte(tag, ','); comma >= 0 {
+			name, options = tag[:comma], tag[comma:]
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, jsonField{index: i, name: name, omitEmpty: strings.Contains(options+",", ",omitempty,")})
+	}
+	return fields
+}
+
+// isEmptyValue reports whether v is omitted by the omitempty option of
+// encoding/json.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+var structLogsType = reflect.TypeOf(StructLogs{})
+
+// appendResult appends r field by field like encoding/json, with its steps
+// appended by appendStructLogs and the other fields by encoding/json.
+func (a *jsonAppender) appendResult(r *ExecutionResult) error {
+	if r == nil {
+		a.buf = append(a.buf, "null"...)
+		return nil
+	}
+	v := reflect.ValueOf(r).Elem()
+	a.open('{')
+	for _, field := range resultFields {
+		value := v.Field(field.index)
+		if field.omitEmpty && isEmptyValue(value) {
+			continue
+		}
+		a.key(field.name)
+		if value.Type() == structLogsType {
+			if err := a.appendStructLogs(value.Addr().Interface().(*StructLogs)); err != nil {
+				return err
+			}
+			continue
+		}
+		encoded, err := marshalIndent(value.Interface(), strings.Repeat(a.indent, a.depth), a.indent)
+		if err != nil {
+			return err
+		}
+		a.buf = append(a.buf, encoded...)
+	}
+	a.close('}')
+	return a.err
+}
+
+// appendStructLogs appends the captured steps of s directly, or its
+// formatted steps with encoding/json.
+func (a *jsonAppender) appendStructLogs(s *StructLogs) error {
+	if s.captured != nil {
+		a.appendLogs(s.captured)
+		return a.err
+	}
+	encoded, err := marshalIndent(s.formatted, strings.Repeat(a.indent, a.depth), a.indent)
+	a.buf = append(a.buf, encoded...)
+	return err
+}
+
+// marshalIndent is json.MarshalIndent, or json.Marshal if indent is empty.
+func marshalIndent(v interface{}, prefix, indent string) ([]byte, error) {
+	if indent == "" {
+		return json.Marshal(v)
+	}
+	return json.MarshalIndent(v, prefix, indent)
+}
+
+// flushSize is the size of the buffer of a jsonAppender above which it is
+// flushed between the steps.
+const flushSize = 1 << 16
+
+// jsonAppender appends JSON to buf, indented like by json.MarshalIndent
+// unless indent is empty.
+type jsonAppender struct {
+	buf []byte
+	// w, if set, is where buf is flushed, and err the error of the flush.
+	w      io.Writer
+	err    error
+	indent string
+	// lines is a newline followed by indent as many times as the deepest
+	// line so far.
+	lines []byte
+	// depth is the number of objects and arrays open.
+	depth int
+	// empty is set until the first element of the object or array open.
+	empty bool
+	// keys is a scratch slice for the sorted storage keys of the steps.
+	keys []common.Hash
+}
+
+// flush writes buf to w once it exceeds flushSize.
+func (a *jsonAppender) flush() {
+	if a.w == nil || len(a.buf) < flushSize {
+		return
+	}
+	if a.err == nil {
+		_, a.err = a.w.Write(a.buf)
+	}
+	a.buf = a.buf[:0]
+}
+
+// open opens an object or an array with c.
+func (a *jsonAppender) open(c byte) {
+	a.buf = append(a.buf, c)
+	a.depth++
+	a.empty = true
+}
+
+// close closes the object or the array open with c.
+func (a *jsonAppender) close(c byte) {
+	a.depth--
+	if !a.empty {
+		a.newline()
+	}
+	a.buf = append(a.buf, c)
+	a.empty = false
+}
+
+// next starts the next element of the object or the array open.
+func (a *jsonAppender) next() {
+	if !a.empty {
+		a.buf = append(a.buf, ',')
+	}
+	a.empty = false
+	a.newline()
+}
+
+func (a *jsonAppender) newline() {
+	if a.indent == "" {
+		return
+	}
+	n := 1 + a.depth*len(a.indent)
+	if len(a.lines) == 0 {
+		a.lines = append(a.lines, '\n')
+	}
+	for len(a.lines) < n {
+		a.lines = append(a.lines, a.indent...)
+	}
+	a.buf = append(a.buf, a.lines[:n]...)
+}
+
+// key starts the next field of the object open, whose name needs no
+// escaping.
+func (a *jsonAppender) key(name string) {
+	a.next()
+	a.buf = append(a.buf, '"')
+	a.buf = append(a.buf, name...)
+	a.colon()
+}
+
+// colon closes the key open with a colon.
+func (a *jsonAppender) colon() {
+	if a.indent == "" {
+		a.buf = append(a.buf, `":`...)
+	} else {
+		a.buf = append(a.buf, `": `...)
+	}
+}
+
+func (a *jsonAppender) uintField(name string, v uint64) {
+	a.key(name)
+	a.buf = strconv.AppendUint(a.buf, v, 10)
+}
+
+func (a *jsonAppender) intField(name string, v int64) {
+	a.key(name)
+	a.buf = strconv.AppendInt(a.buf, v, 10)
+}
+
+func (a *jsonAppender) boolField(name string, v bool) {
+	a.key(name)
+	a.buf = strconv.AppendBool(a.buf, v)
+}
+
+// str appends s as a JSON string, escaped like by encoding/json.
+func (a *jsonAppender) str(s string) {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c >= 0x7f || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			encoded, _ := json.Marshal(s)
+			a.buf = append(a.buf, encoded...)
+			return
+		}
+	}
+	a.buf = append(a.buf, '"')
+	a.buf = append(a.buf, s...)
+	a.buf = append(a.buf, '"')
+}
+
+// hexStr appends b, of at most 32 bytes, as a JSON string of its hex
+// encoding, prefixed by 0x like the one of a common.Hash if prefixed is set.
+// It leaves the string open for a key.
+func (a *jsonAppender) hexStr(b []byte, prefixed bool) {
+	var encoded [64]byte
+	n := hex.Encode(encoded[:], b)
+	a.buf = append(a.buf, '"')
+	if prefixed {
+		a.buf = append(a.buf, "0x"...)
+	}
+	a.buf = append(a.buf, encoded[:n]...)
+}
+
+func (a *jsonAppender) hexField(name string, b []byte) {
+	a.key(name)
+	a.hexStr(b, true)
+	a.buf = append(a.buf, '"')
+}
+
+// appendLogs appends the JSON of FormatLogs(logs).
+func (a *jsonAppender) appendLogs(logs []StructLog) {
+	a.open('[')
+	for i := range logs {
+		a.next()
+		a.appendLog(&logs[i])
+		a.flush()
+	}
+	a.close(']')
+}
+
+// appendLog appends the JSON of the StructLogRes of trace, with the fields
+// in the order of StructLogRes.
+func (a *jsonAppender) appendLog(trace *StructLog) {
+	a.open('{')
+	a.uintField("pc", trace.Pc)
+	a.key("op")
+	a.str(trace.Op.String())
+	a.uintField("gas", trace.Gas)
+	a.uintField("gasCost", trace.GasCost)
+	a.intField("depth", int64(trace.Depth))
+	if message := StepErrorMessage(trace.Err); message != "" {
+		a.key("error")
+		a.str(message)
+	}
+	if trace.Stack != nil {
+		a.key("stack")
+		a.open('[')
+		for i := range trace.Stack {
+			a.next()
+			a.buf = append(a.buf, '"')
+			a.buf = appendHexQuantity(a.buf, &trace.Stack[i])
+			a.buf = append(a.buf, '"')
+		}
+		a.close(']')
+	}
+	a.intField("stackSize", int64(trace.StackSize))
+	if trace.Memory != nil {
+		a.key("memory")
+		a.open('[')
+		for i := 0; i+32 <= len(trace.Memory); i += 32 {
+			a.next()
+			a.hexStr(trace.Memory[i:i+32], false)
+			a.buf = append(a.buf, '"')
+		}
+		a.close(']')
+	}
+	a.intField("memorySize", int64(trace.MemorySize))
+	a.intField("returnDataSize", int64(trace.ReturnDataSize))
+	if trace.Storage != nil {
+		// The keys are sorted like the ones of a map by encoding/json, which
+		// is the order of their hex encodings.
+		a.keys = a.keys[:0]
+		for key := range trace.Storage {
+			a.keys = append(a.keys, key)
+		}
+		keys := a.keys
+		sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+		a.key("storage")
+		a.open('{')
+		for _, key := range keys {
+			value := trace.Storage[key]
+			a.next()
+			a.hexStr(key[:], false)
+			a.colon()
+			a.hexStr(value[:], false)
+			a.buf = append(a.buf, '"')
+		}
+		a.close('}')
+	}
+	if access := trace.Access; access != nil {
+		a.key("access")
+		a.open('{')
+		a.hexField("address", access.Address[:])
+		if access.Slot != nil {
+			a.hexField("slot", access.Slot[:])
+		}
+		a.boolField("warm", access.Warm)
+		a.uintField("gas", access.Gas)
+		a.close('}')
+	}
+	a.intField("callId", int64(trace.CallID))
+	a.intField("callerId", int64(trace.CallerID))
+	a.boolField("isStatic", trace.IsStatic)
+	a.boolField("isCreate", trace.IsCreate)
+	if gasCosts := trace.GasCosts; gasCosts != nil {
+		a.key("gasCosts")
+		a.open('{')
+		a.uintField("constant", gasCosts.Constant)
+		a.uintField("memoryExpansion", gasCosts.MemoryExpansion)
+		a.uintField("copy", gasCosts.Copy)
+		a.uintField("access", gasCosts.Access)
+		a.uintField("other", gasCosts.Other)
+		a.close('}')
+	}
+	if access := trace.StorageAccess; access != nil {
+		a.key("storageAccess")
+		a.open('{')
+		a.hexField("address", access.Address[:])
+		a.hexField("key", access.Key[:])
+		a.hexField("originalValue", access.Original[:])
+		a.hexField("currentValue", access.Current[:])
+		a.hexField("newValue", access.New[:])
+		a.uintField("gasCost", access.GasCost)
+		a.intField("refundDelta", access.RefundDelta)
+		a.close('}')
+	}
+	if callGas := trace.CallGas; callGas != nil {
+		a.key("callGas")
+		a.open('{')
+		a.uintField("requested", callGas.Requested)
+		a.uintField("forwarded", callGas.Forwarded)
+		a.uintField("stipend", callGas.Stipend)
+		if callGas.Returned != nil {
+			a.uintField("returned", *callGas.Returned)
+		}
+		a.close('}')
+	}
+	a.close('}')
+}
@@ -0,0 +1,83 @@
+package gethutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// TestWriteResults checks that the results of the golden cases are written
+// like by encoding/json, which encodes the steps of decoded results through
+// their StructLogRes and the other fields through the struct tags.
+func TestWriteResults(t *testing.T) {
+	for _, c := range GoldenCases() {
+		results, err := Trace(c.Config)
+		if err != nil {
+			t.Fatalf("%s: %v", c.Name, err)
+		}
+		for _, indent := range []string{"", "  "} {
+			var got bytes.Buffer
+			if err := WriteResults(&got, results, indent); err != nil {
+				t.Fatal(err)
+			}
+			var decoded []*ExecutionResult
+			if err := json.Unmarshal(got.Bytes(), &decoded); err != nil {
+				t.Fatalf("%s: %v", c.Name, err)
+			}
+			type executionResult ExecutionResult
+			plain := make([]*executionResult, len(decoded))
+			for i, result := range decoded {
+				plain[i] = (*executionResult)(result)
+			}
+			want, err := marshalIndent(plain, "", indent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want) {
+				t.Fatalf("%s, indent %q:\ngot  %s\nwant %s", c.Name, indent, got.Bytes(), want)
+			}
+		}
+	}
+}
+
+// TestExecutionResultMarshalJSON checks that MarshalJSON encodes a traced
+// result like WriteResults.
+func TestExecutionResultMarshalJSON(t *testing.T) {
+	results, err := Trace(GoldenCases()[0].Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	if err := WriteResults(&want, results, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Fatalf("got  %s\nwant %s", got, want.Bytes())
+	}
+}
+
+// TestStructLogsFormatted checks that the changes to the formatted steps of a
+// traced result are encoded.
+func TestStructLogsFormatted(t *testing.T) {
+	results, err := Trace(GoldenCases()[0].Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := results[0].StructLogs.Formatted()
+	logs[0].Op = "EDITED"
+	encoded, err := json.Marshal(results[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ExecutionResult
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if got := decoded.StructLogs.Formatted(); len(got) != len(logs) || got[0].Op != "EDITED" {
+		t.Fatalf("got %d steps starting with %q, want %d starting with EDITED", len(got), got[0].Op, len(logs))
+	}
+}
@@ -0,0 +1,114 @@
+package gethutil
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// ErrorCode is a stable numeric code classifying a failure, so that callers
+// across the FFI boundary don't have to match on error messages.
+type ErrorCode int
+
+// The values are part of the FFI and must never be changed or reused.
+const (
+	ErrCodeInvalidConfig      ErrorCode = 1
+	ErrCodeIntrinsicGas       ErrorCode = 2
+	ErrCodeNonceMismatch      ErrorCode = 3
+	ErrCodeExecutionReverted  ErrorCode = 4
+	ErrCodeInternal           ErrorCode = 5
+	ErrCodeInvalidTransaction ErrorCode = 6
+	ErrCodeExecutionHalted    ErrorCode = 7
+	ErrCodeInsufficientFunds  ErrorCode = 8
+	ErrCodeFeeCapTooLow       ErrorCode = 9
+)
+
+func (c ErrorCode) String() string {
+	switch c {
+	case ErrCodeInvalidConfig:
+		return "invalid config"
+	case ErrCodeIntrinsicGas:
+		return "intrinsic gas"
+	case ErrCodeNonceMismatch:
+		return "nonce mismatch"
+	case ErrCodeExecutionReverted:
+		return "execution reverted"
+	case ErrCodeInternal:
+		return "internal"
+	case ErrCodeInvalidTransaction:
+		return "invalid transaction"
+	case ErrCodeExecutionHalted:
+		return "execution halted"
+	case ErrCodeInsufficientFunds:
+		return "insufficient funds"
+	case ErrCodeFeeCapTooLow:
+		return "fee cap too low"
+	default:
+		return fmt.Sprintf("error code %d", int(c))
+	}
+}
+
+// TraceError is an error with a stable code, serialized as
+// {"code": <code>, "message": <message>}.
+type TraceError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+
+	err error
+}
+
+func (e *TraceError) Error() string { return e.Message }
+
+func (e *TraceError) Unwrap() error { return e.err }
+
+// NewTraceError returns a TraceError with the given code and message, which
+// wraps err.
+func NewTraceError(code ErrorCode, err error, format string, args ...interface{}) *TraceError {
+	return &TraceError{Code: code, Message: fmt.Sprintf(format, args...), err: err}
+}
+
+// AsTraceError returns err if it is (or wraps) a TraceError, or err wrapped
+// in a TraceError with code ErrCodeInternal otherwise.
+func AsTraceError(err error) *TraceError {
+	var traceErr *TraceError
+	if errors.As(err, &traceErr) {
+		return traceErr
+	}
+	return &TraceError{Code: ErrCodeInternal, Message: err.Error(), err: err}
+}
+
+// ErrMaxInitCodeSizeExceeded rejects a contract creation whose init code is
+// above TraceConfig.MaxInitCodeSize.
+var ErrMaxInitCodeSizeExceeded = errors.New("max initcode size exceeded")
+
+// txErrorCode classifies an error returned by core.ApplyMessage, which
+// rejects the tx before its execution.
+func txErrorCode(err error) ErrorCode {
+	switch {
+	case errors.Is(err, core.ErrIntrinsicGas):
+		return ErrCodeIntrinsicGas
+	case errors.Is(err, core.ErrNonceTooLow), errors.Is(err, core.ErrNonceTooHigh):
+		return ErrCodeNonceMismatch
+	case errors.Is(err, core.ErrInsufficientFunds), errors.Is(err, core.ErrInsufficientFundsForTransfer):
+		return ErrCodeInsufficientFunds
+	case errors.Is(err, core.ErrFeeCapTooLow):
+		return ErrCodeFeeCapTooLow
+	default:
+		return ErrCodeInvalidTransaction
+	}
+}
+
+// executionError returns the TraceError of a failed execution, or nil if the
+// execution succeeded.
+func executionError(result *core.ExecutionResult) *TraceError {
+	if !result.Failed() {
+		return nil
+	}
+	code := ErrCodeExecutionHalted
+	if errors.Is(result.Err, vm.ErrExecutionReverted) {
+		code = ErrCodeExecutionReverted
+	}
+	return &TraceError{Code: code, Message: result.Err.Error(), err: result.Err}
+}
@@ -0,0 +1,100 @@
+package gethutil
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// EstimateGas returns the minimal gas limit for the last transaction of
+// config to execute successfully, after the previous ones are applied. It
+// binary-searches the gas limit in [params.TxGas, gas limit of the last
+// transaction], running the transaction without tracing.
+// Modified from github.com/ethereum/go-ethereum/internal/ethapi.DoEstimateGas
+func EstimateGas(config TraceConfig) (uint64, error) {
+	if len(config.Transactions) == 0 {
+		return 0, NewTraceError(ErrCodeInvalidConfig, nil, "Failed to estimate gas: no transactions")
+	}
+	env, err := newTraceEnv(config)
+	if err != nil {
+		return 0, err
+	}
+
+	// Apply the transactions before the last one once, and run the last one
+	// on a copy of the resulting state for each gas limit.
+	stateDB, err := newStateDB(config)
+	if err != nil {
+		return 0, err
+	}
+	env.processBeaconRoot(stateDB)
+	last := len(env.messages) - 1
+	for i := range env.messages[:last] {
+		env.mint(stateDB, i)
+		message := env.message(stateDB, i)
+		_, err := env.chargeL1Fee(stateDB, i, message, config)
+		if err == nil {
+			_, err = env.apply(stateDB, i, message, config)
+		}
+		if err != nil {
+			return 0, NewTraceError(txErrorCode(err), err, "Failed to apply config.Transactions[%d]: %v", i, err)
+		}
+	}
+
+	env.mint(stateDB, last)
+	message := env.message(stateDB, last)
+	// The L1 data fee is charged once, for the gas limit of the transaction.
+	if _, err := env.chargeL1Fee(stateDB, last, message, config); err != nil {
+		return 0, NewTraceError(txErrorCode(err), err, "Failed to apply config.Transactions[%d]: %v", last, err)
+	}
+	// executable returns whether the last transaction succeeds with gas.
+	executable := func(gas uint64) (bool, error) {
+		msg := types.NewMessage(
+			message.From(),
+			message.To(),
+			message.Nonce(),
+			message.Value(),
+			gas,
+			message.GasPrice(),
+			message.GasFeeCap(),
+			message.GasTipCap(),
+			message.Data(),
+			message.AccessList(),
+			message.IsFake(),
+		)
+		result, err := env.apply(NewStateDB(stateDB.StateDB.Copy()), last, msg, config)
+		if err != nil {
+			if errors.Is(err, core.ErrIntrinsicGas) {
+				return false, nil
+			}
+			return false, err
+		}
+		return !result.Failed(), nil
+	}
+
+	lo, hi := params.TxGas-1, message.Gas()
+	if hi <= lo {
+		return 0, NewTraceError(ErrCodeIntrinsicGas, core.ErrIntrinsicGas, "Failed to estimate gas: gas limit %d below %d", hi, params.TxGas)
+	}
+	ok, err := executable(hi)
+	if err != nil {
+		return 0, NewTraceError(txErrorCode(err), err, "Failed to apply config.Transactions[%d]: %v", last, err)
+	}
+	if !ok {
+		return 0, NewTraceError(ErrCodeExecutionHalted, nil, "Failed to estimate gas: gas required exceeds allowance (%d)", hi)
+	}
+	for lo+1 < hi {
+		mid := lo + (hi-lo)/2
+		ok, err := executable(mid)
+		if err != nil {
+			return 0, NewTraceError(txErrorCode(err), err, "Failed to apply config.Transactions[%d]: %v", last, err)
+		}
+		if ok {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return hi + env.authorizationGas(last), nil
+}
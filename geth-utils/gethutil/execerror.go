@@ -0,0 +1,187 @@
+package gethutil
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+// ExecErrorKind is the kind of the error of a step, named after the
+// ExecError of the bus-mapping.
+type ExecErrorKind string
+
+const (
+	ExecErrorInvalidOpcode            ExecErrorKind = "InvalidOpcode"
+	ExecErrorStackOverflow            ExecErrorKind = "StackOverflow"
+	ExecErrorStackUnderflow           ExecErrorKind = "StackUnderflow"
+	ExecErrorOutOfGas                 ExecErrorKind = "OutOfGas"
+	ExecErrorWriteProtection          ExecErrorKind = "WriteProtection"
+	ExecErrorDepth                    ExecErrorKind = "Depth"
+	ExecErrorInsufficientBalance      ExecErrorKind = "InsufficientBalance"
+	ExecErrorContractAddressCollision ExecErrorKind = "ContractAddressCollision"
+	ExecErrorInvalidCreationCode      ExecErrorKind = "InvalidCreationCode"
+	ExecErrorInvalidJump              ExecErrorKind = "InvalidJump"
+	ExecErrorReturnDataOutOfBounds    ExecErrorKind = "ReturnDataOutOfBounds"
+	ExecErrorCodeStoreOutOfGas        ExecErrorKind = "CodeStoreOutOfGas"
+	ExecErrorMaxCodeSizeExceeded      ExecErrorKind = "MaxCodeSizeExceeded"
+	// ExecErrorUnknown is the kind of the errors unknown to the bus-mapping.
+	ExecErrorUnknown ExecErrorKind = "Unknown"
+)
+
+// OogErrorKind is the kind of an ExecErrorOutOfGas, named after the
+// OogError of the bus-mapping.
+type OogErrorKind string
+
+const (
+	OogErrorConstant               OogErrorKind = "Constant"
+	OogErrorStaticMemoryExpansion  OogErrorKind = "StaticMemoryExpansion"
+	OogErrorDynamicMemoryExpansion OogErrorKind = "DynamicMemoryExpansion"
+	OogErrorMemoryCopy             OogErrorKind = "MemoryCopy"
+	OogErrorAccountAccess          OogErrorKind = "AccountAccess"
+	OogErrorLog                    OogErrorKind = "Log"
+	OogErrorExp                    OogErrorKind = "Exp"
+	OogErrorSha3                   OogErrorKind = "Sha3"
+	OogErrorExtCodeCopy            OogErrorKind = "ExtCodeCopy"
+	OogErrorSload                  OogErrorKind = "Sload"
+	OogErrorSstore                 OogErrorKind = "Sstore"
+	OogErrorCall                   OogErrorKind = "Call"
+	OogErrorCallCode               OogErrorKind = "CallCode"
+	OogErrorDelegateCall           OogErrorKind = "DelegateCall"
+	OogErrorCreate2                OogErrorKind = "Create2"
+	OogErrorStaticCall             OogErrorKind = "StaticCall"
+	OogErrorSelfDestruct           OogErrorKind = "SelfDestruct"
+)
+
+// ExecError is the error of a step.
+type ExecError struct {
+	// Step is the index of the step among all the steps, which is its index
+	// in the captured steps unless TracerOptions filters them.
+	Step int
+	Kind ExecErrorKind
+	// Oog is set when Kind is ExecErrorOutOfGas.
+	Oog OogErrorKind
+	Err error
+}
+
+// classifyExecError returns the kinds of the error err of a step of op, or
+// "" if err isn't an error of the step.
+func classifyExecError(op vm.OpCode, err error) (ExecErrorKind, OogErrorKind) {
+	if err == nil || errors.Is(err, vm.ErrExecutionReverted) {
+		return "", ""
+	}
+	entry := lookupStepError(err)
+	switch {
+	case entry == nil:
+		return ExecErrorUnknown, ""
+	case entry.Kind == ExecErrorOutOfGas:
+		return ExecErrorOutOfGas, oogErrorKind(op)
+	default:
+		return entry.Kind, ""
+	}
+}
+
+// oogErrorKind returns the kind of the out of gas of a step of op.
+func oogErrorKind(op vm.OpCode) OogErrorKind {
+	switch op {
+	case vm.MLOAD, vm.MSTORE, vm.MSTORE8:
+		return OogErrorStaticMemoryExpansion
+	case vm.CREATE, vm.RETURN, vm.REVERT:
+		return OogErrorDynamicMemoryExpansion
+	case vm.CALLDATACOPY, vm.CODECOPY, vm.RETURNDATACOPY:
+		return OogErrorMemoryCopy
+	case vm.BALANCE, vm.EXTCODESIZE, vm.EXTCODEHASH:
+		return OogErrorAccountAccess
+	case vm.LOG0, vm.LOG1, vm.LOG2, vm.LOG3, vm.LOG4:
+		return OogErrorLog
+	case vm.EXP:
+		return OogErrorExp
+	case vm.KECCAK256:
+		return OogErrorSha3
+	case vm.EXTCODECOPY:
+		return OogErrorExtCodeCopy
+	case vm.SLOAD:
+		return OogErrorSload
+	case vm.SSTORE:
+		return OogErrorSstore
+	case vm.CALL:
+		return OogErrorCall
+	case vm.CALLCODE:
+		return OogErrorCallCode
+	case vm.DELEGATECALL:
+		return OogErrorDelegateCall
+	case vm.CREATE2:
+		return OogErrorCreate2
+	case vm.STATICCALL:
+		return OogErrorStaticCall
+	case vm.SELFDESTRUCT:
+		return OogErrorSelfDestruct
+	default:
+		return OogErrorConstant
+	}
+}
+
+// callFailure returns the error failing a CALL*/CREATE* step before the
+// callee is entered, which the EVM doesn't report to the tracer, or nil.
+// The step is at depth in contract, with stack and memory before its
+// execution.
+func callFailure(statedb vm.StateDB, op vm.OpCode, depth int, contract common.Address, stack []uint256.Int, memory []byte) error {
+	peek := func(n int) *uint256.Int { return &stack[len(stack)-1-n] }
+	var value *uint256.Int
+	switch op {
+	case vm.CALL, vm.CALLCODE:
+		if len(stack) < 7 {
+			return nil
+		}
+		value = peek(2)
+	case vm.DELEGATECALL, vm.STATICCALL:
+		if len(stack) < 6 {
+			return nil
+		}
+	case vm.CREATE:
+		if len(stack) < 3 {
+			return nil
+		}
+		value = peek(0)
+	case vm.CREATE2:
+		if len(stack) < 4 {
+			return nil
+		}
+		value = peek(0)
+	default:
+		return nil
+	}
+
+	if depth > int(params.CallCreateDepth) {
+		return vm.ErrDepth
+	}
+	if value != nil && statedb.GetBalance(contract).Cmp(value.ToBig()) < 0 {
+		return vm.ErrInsufficientBalance
+	}
+
+	var address common.Address
+	switch op {
+	case vm.CREATE:
+		address = ContractAddress(contract, statedb.GetNonce(contract))
+	case vm.CREATE2:
+		// The memory is expanded to the init code by the step.
+		var initCode []byte
+		if size := peek(2).Uint64(); size > 0 {
+			offset := peek(1).Uint64()
+			initCode = memory[offset : offset+size]
+		}
+		address = Create2Address(contract, peek(3).Bytes32(), crypto.Keccak256Hash(initCode))
+	default:
+		return nil
+	}
+	codeHash := statedb.GetCodeHash(address)
+	if statedb.GetNonce(address) != 0 || (codeHash != (common.Hash{}) && codeHash != emptyCodeHash) {
+		return vm.ErrContractAddressCollision
+	}
+	return nil
+}
+
+var emptyCodeHash = crypto.Keccak256Hash(nil)
@@ -0,0 +1,69 @@
+package gethutil
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// FeesRes splits the fees of a transaction, or the sum of the fees of the
+// transactions of a block, between what is burned, paid to the coinbase and
+// refunded to the sender.
+type FeesRes struct {
+	// GasPrice is the effective gas price of a transaction.
+	GasPrice *hexutil.Big `json:"gasPrice,omitempty"`
+	// Burned is the base fee of the gas used, which is paid by the sender
+	// but not credited to anyone.
+	Burned *hexutil.Big `json:"burned"`
+	// PriorityFee is the fee credited to the coinbase.
+	PriorityFee *hexutil.Big `json:"priorityFee"`
+	// SenderRefund is the price of the gas left, which the sender bought
+	// before the execution and gets back after it.
+	SenderRefund *hexutil.Big `json:"senderRefund"`
+	// L1Fee is the L1 data fee charged before the execution, see
+	// TraceConfig.L1Fee.
+	L1Fee *hexutil.Big `json:"l1Fee,omitempty"`
+}
+
+// newFeesRes returns the fees of message which used gasUsed, given the
+// priority fee credited to the coinbase and the L1 data fee, if any. The burned fee is what the sender
+// paid minus the priority fee, so that the split stays exact whatever the
+// base fee rules of the EVM.
+func newFeesRes(message types.Message, gasUsed uint64, priorityFee, l1Fee *big.Int) *FeesRes {
+	paid := new(big.Int).Mul(new(big.Int).SetUint64(gasUsed), message.GasPrice())
+	refund := new(big.Int).Mul(new(big.Int).SetUint64(message.Gas()-gasUsed), message.GasPrice())
+	return &FeesRes{
+		GasPrice:     (*hexutil.Big)(new(big.Int).Set(message.GasPrice())),
+		Burned:       (*hexutil.Big)(paid.Sub(paid, priorityFee)),
+		PriorityFee:  (*hexutil.Big)(new(big.Int).Set(priorityFee)),
+		SenderRefund: (*hexutil.Big)(refund),
+		L1Fee:        (*hexutil.Big)(l1Fee),
+	}
+}
+
+// sumFees returns the sum of the fees of results, leaving out the gas
+// prices.
+func sumFees(results []*ExecutionResult) *FeesRes {
+	burned, priorityFee, senderRefund, l1Fee := new(big.Int), new(big.Int), new(big.Int), new(big.Int)
+	for _, result := range results {
+		if result.Fees == nil {
+			continue
+		}
+		burned.Add(burned, result.Fees.Burned.ToInt())
+		priorityFee.Add(priorityFee, result.Fees.PriorityFee.ToInt())
+		senderRefund.Add(senderRefund, result.Fees.SenderRefund.ToInt())
+		if result.Fees.L1Fee != nil {
+			l1Fee.Add(l1Fee, result.Fees.L1Fee.ToInt())
+		}
+	}
+	fees := &FeesRes{
+		Burned:       (*hexutil.Big)(burned),
+		PriorityFee:  (*hexutil.Big)(priorityFee),
+		SenderRefund: (*hexutil.Big)(senderRefund),
+	}
+	if l1Fee.Sign() != 0 {
+		fees.L1Fee = (*hexutil.Big)(l1Fee)
+	}
+	return fees
+}
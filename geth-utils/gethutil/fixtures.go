@@ -0,0 +1,53 @@
+//go:build !js
+// +build !js
+
+package gethutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/core"
+)
+
+// LoadStateTests loads the state tests of a GeneralStateTests fixture file by
+// name.
+func LoadStateTests(path string) (map[string]*StateTest, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tests map[string]*StateTest
+	if err := json.Unmarshal(bytes, &tests); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal state tests of %s: %w", path, err)
+	}
+	return tests, nil
+}
+
+// LoadTransactionTests loads the transaction tests of a TransactionTests
+// fixture file by name.
+func LoadTransactionTests(path string) (map[string]*TransactionTest, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tests map[string]*TransactionTest
+	if err := json.Unmarshal(bytes, &tests); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal transaction tests of %s: %w", path, err)
+	}
+	return tests, nil
+}
+
+// LoadGenesis loads a geth genesis.json, see GenesisTraceConfig.
+func LoadGenesis(path string) (*core.Genesis, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	genesis := new(core.Genesis)
+	if err := json.Unmarshal(bytes, genesis); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal genesis of %s: %w", path, err)
+	}
+	return genesis, nil
+}
@@ -0,0 +1,116 @@
+package gethutil
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// forks are the forks in the order of their activation, named as in the
+// fixtures of the Ethereum tests, with the function activating each of them
+// in a chain config.
+var forks = []struct {
+	name     string
+	activate func(c *params.ChainConfig)
+	// active returns whether the fork is active at the block number of an
+	// arbitrary chain config, see forkAt.
+	active func(c *params.ChainConfig, number *big.Int) bool
+}{
+	{"Frontier", func(c *params.ChainConfig) {}, func(c *params.ChainConfig, number *big.Int) bool {
+		return true
+	}},
+	{"Homestead", func(c *params.ChainConfig) {
+		c.HomesteadBlock = big.NewInt(0)
+	}, (*params.ChainConfig).IsHomestead},
+	{"EIP150", func(c *params.ChainConfig) {
+		c.EIP150Block = big.NewInt(0)
+	}, (*params.ChainConfig).IsEIP150},
+	{"EIP158", func(c *params.ChainConfig) {
+		c.EIP155Block = big.NewInt(0)
+		c.EIP158Block = big.NewInt(0)
+	}, func(c *params.ChainConfig, number *big.Int) bool {
+		return c.IsEIP155(number) && c.IsEIP158(number)
+	}},
+	{"Byzantium", func(c *params.ChainConfig) {
+		c.ByzantiumBlock = big.NewInt(0)
+	}, (*params.ChainConfig).IsByzantium},
+	{"Constantinople", func(c *params.ChainConfig) {
+		c.ConstantinopleBlock = big.NewInt(0)
+	}, (*params.ChainConfig).IsConstantinople},
+	{"ConstantinopleFix", func(c *params.ChainConfig) {
+		c.PetersburgBlock = big.NewInt(0)
+	}, (*params.ChainConfig).IsPetersburg},
+	{"Istanbul", func(c *params.ChainConfig) {
+		c.IstanbulBlock = big.NewInt(0)
+		c.MuirGlacierBlock = big.NewInt(0)
+	}, (*params.ChainConfig).IsIstanbul},
+	{"Berlin", func(c *params.ChainConfig) {
+		c.BerlinBlock = big.NewInt(0)
+	}, (*params.ChainConfig).IsBerlin},
+	{"London", func(c *params.ChainConfig) {
+		c.LondonBlock = big.NewInt(0)
+	}, (*params.ChainConfig).IsLondon},
+	{"Merge", func(c *params.ChainConfig) {
+		c.TerminalTotalDifficulty = big.NewInt(0)
+	}, func(c *params.ChainConfig, number *big.Int) bool {
+		// Only the chains merged from genesis are supported.
+		return c.TerminalTotalDifficulty != nil && c.TerminalTotalDifficulty.Sign() == 0
+	}},
+}
+
+// defaultFork is the fork of the configs without TraceConfig.Fork.
+const defaultFork = "London"
+
+// Forks returns the names of the supported forks in the order of their
+// activation.
+func Forks() []string {
+	names := make([]string, len(forks))
+	for i, fork := range forks {
+		names[i] = fork.name
+	}
+	return names
+}
+
+// isMerged returns whether the chain of chainConfig is past the Merge, where
+// the DIFFICULTY opcode returns the randomness of the beacon chain
+// (PREVRANDAO) and the blocks aren't rewarded.
+func isMerged(chainConfig *params.ChainConfig) bool {
+	return chainConfig.TerminalTotalDifficulty != nil
+}
+
+// newChainConfig returns the config of a chain with the forks up to fork
+// activated at genesis.
+func newChainConfig(chainID *big.Int, fork string) (*params.ChainConfig, error) {
+	if fork == "" {
+		fork = defaultFork
+	}
+	chainConfig := &params.ChainConfig{
+		ChainID:        chainID,
+		DAOForkBlock:   big.NewInt(0),
+		DAOForkSupport: true,
+	}
+	for _, f := range forks {
+		f.activate(chainConfig)
+		if f.name == fork {
+			return chainConfig, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown fork %q", fork)
+}
+
+// forkAt returns the name of the latest fork active at number in
+// chainConfig, which must activate the forks in order.
+func forkAt(chainConfig *params.ChainConfig, number *big.Int) (string, error) {
+	latest := 0
+	for i, f := range forks {
+		if !f.active(chainConfig, number) {
+			continue
+		}
+		if i > latest+1 {
+			return "", fmt.Errorf("fork %s is active at block %v before %s", f.name, number, forks[latest+1].name)
+		}
+		latest = i
+	}
+	return forks[latest].name, nil
+}
@@ -0,0 +1,142 @@
+package gethutil
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+// GasCost is the decomposition of the gas cost of a step.
+type GasCost struct {
+	// Constant is the constant gas of the opcode.
+	Constant uint64
+	// MemoryExpansion is the cost of the memory expansion by the step.
+	MemoryExpansion uint64
+	// Copy is the per-word cost of the *COPY opcodes.
+	Copy uint64
+	// Access is the EIP-2929 cold (or warm for SLOAD) access cost which is
+	// not already in Constant.
+	Access uint64
+	// Other is the remaining dynamic cost, such as the SSTORE cost, the gas
+	// sent to a callee, or the per-byte cost of EXP, SHA3 and LOG.
+	Other uint64
+}
+
+// memoryGasCost returns the cost of a memory of the given size in bytes,
+// which is a multiple of 32.
+// Modified from github.com/ethereum/go-ethereum/core/vm.memoryGasCost
+func memoryGasCost(size uint64) uint64 {
+	words := size / 32
+	return words*params.MemoryGas + words*words/params.QuadCoeffDiv
+}
+
+// toWordSize returns the number of words needed to hold size bytes.
+func toWordSize(size uint64) uint64 {
+	if size > ^uint64(0)-31 {
+		return ^uint64(0)/32 + 1
+	}
+	return (size + 31) / 32
+}
+
+// stepGasCost decomposes the gas cost of a successful step of op, where
+// prevMemSize and memSize are the memory sizes before and after its memory
+// expansion, and jt is the jump table of the EVM.
+func stepGasCost(jt *vm.JumpTable, op vm.OpCode, cost uint64, stack []uint256.Int, prevMemSize, memSize uint64, access *Access) *GasCost {
+	gasCost := &GasCost{Constant: tableConstantGas(jt, op)}
+	if memSize > prevMemSize {
+		gasCost.MemoryExpansion = memoryGasCost(memSize) - memoryGasCost(prevMemSize)
+	}
+
+	// The length of the copy is the 3rd item of the stack, or the 4th one for
+	// EXTCODECOPY.
+	lengthIndex := -1
+	switch op {
+	case vm.CALLDATACOPY, vm.CODECOPY, vm.RETURNDATACOPY:
+		lengthIndex = 2
+	case vm.EXTCODECOPY:
+		lengthIndex = 3
+	}
+	if lengthIndex >= 0 && len(stack) > lengthIndex {
+		if length, overflow := stack[len(stack)-1-lengthIndex].Uint64WithOverflow(); !overflow {
+			gasCost.Copy = toWordSize(length) * params.CopyGas
+		}
+	}
+
+	if access != nil {
+		gasCost.Access = access.Gas
+		switch op {
+		case vm.BALANCE, vm.EXTCODESIZE, vm.EXTCODECOPY, vm.EXTCODEHASH,
+			vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+			// The warm access cost is the constant gas of these opcodes.
+			gasCost.Access -= params.WarmStorageReadCostEIP2929
+		}
+	}
+
+	known := gasCost.Constant + gasCost.MemoryExpansion + gasCost.Copy + gasCost.Access
+	if cost > known {
+		gasCost.Other = cost - known
+	}
+	return gasCost
+}
+
+// CallGas is the gas sent by a CALL, CALLCODE, DELEGATECALL or STATICCALL
+// step to its callee.
+type CallGas struct {
+	// Requested is the gas argument of the step, capped at 2^64-1.
+	Requested uint64
+	// Forwarded is the gas sent to the callee and paid by the step, which is
+	// Requested capped by EIP-150 to all but one 64th of the gas left after
+	// the other costs of the step.
+	Forwarded uint64
+	// Stipend is the gas given to the callee on top of Forwarded when the
+	// step sends a value, which the step doesn't pay.
+	Stipend uint64
+	// Returned is the gas left by the callee out of Forwarded and Stipend,
+	// which is given back to the caller. It is set once the next step of the
+	// caller is captured, unless the steps are streamed.
+	Returned *uint64
+}
+
+// stepCallGas returns the CallGas of a successful step of op with stack and
+// the decomposition gasCost of its cost, or nil if op isn't a call, where
+// isEIP158 is whether the EVM runs the rules of EIP-158.
+// Modified from github.com/ethereum/go-ethereum/core/vm.gasCall
+func stepCallGas(statedb vm.StateDB, isEIP158 bool, op vm.OpCode, stack []uint256.Int, gasCost *GasCost) *CallGas {
+	switch op {
+	case vm.CALL, vm.CALLCODE:
+		if len(stack) < 7 {
+			return nil
+		}
+	case vm.DELEGATECALL, vm.STATICCALL:
+		if len(stack) < 6 {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	callGas := &CallGas{Requested: ^uint64(0)}
+	if requested := &stack[len(stack)-1]; requested.IsUint64() {
+		callGas.Requested = requested.Uint64()
+	}
+	// Other is the gas forwarded plus the costs of the value transfer.
+	var transferCost uint64
+	if op == vm.CALL || op == vm.CALLCODE {
+		transfersValue := !stack[len(stack)-3].IsZero()
+		if op == vm.CALL {
+			address := common.Address(stack[len(stack)-2].Bytes20())
+			if (isEIP158 && transfersValue && statedb.Empty(address)) || (!isEIP158 && !statedb.Exist(address)) {
+				transferCost += params.CallNewAccountGas
+			}
+		}
+		if transfersValue {
+			transferCost += params.CallValueTransferGas
+			callGas.Stipend = params.CallStipend
+		}
+	}
+	if gasCost.Other > transferCost {
+		callGas.Forwarded = gasCost.Other - transferCost
+	}
+	return callGas
+}
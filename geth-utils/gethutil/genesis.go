@@ -0,0 +1,43 @@
+package gethutil
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+)
+
+// GenesisTraceConfig converts the genesis of a geth genesis.json into a
+// TraceConfig without transactions, whose accounts are the alloc of genesis
+// and whose block is the one after genesis, on the chain ID and the fork of
+// genesis.Config at that block. Past the Merge, the randomness of the block
+// is the mix hash of genesis.
+func GenesisTraceConfig(genesis *core.Genesis) (TraceConfig, error) {
+	if genesis.Config == nil {
+		return TraceConfig{}, fmt.Errorf("genesis has no config")
+	}
+	number := new(big.Int).SetUint64(genesis.Number + 1)
+	fork, err := forkAt(genesis.Config, number)
+	if err != nil {
+		return TraceConfig{}, err
+	}
+	config := TraceConfig{
+		ChainID: (*hexutil.Big)(genesis.Config.ChainID),
+		Fork:    fork,
+		Block: Block{
+			Coinbase:   genesis.Coinbase,
+			Timestamp:  (*hexutil.Big)(new(big.Int).SetUint64(genesis.Timestamp)),
+			Number:     (*hexutil.Big)(number),
+			Difficulty: (*hexutil.Big)(genesis.Difficulty),
+			GasLimit:   (*hexutil.Big)(new(big.Int).SetUint64(genesis.GasLimit)),
+			BaseFee:    (*hexutil.Big)(genesis.BaseFee),
+		},
+		Accounts: genesisAccounts(genesis.Alloc),
+	}
+	if fork == "Merge" {
+		random := genesis.Mixhash
+		config.Block.Random = &random
+	}
+	return config, nil
+}
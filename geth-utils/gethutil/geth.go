@@ -0,0 +1,81 @@
+package gethutil
+
+// OutputGeth is the TraceConfig.Output of the results shaped like the
+// GethExecTrace of bus-mapping, see FormatGethExecTraces.
+const OutputGeth = "geth"
+
+// GethExecTrace is an ExecutionResult restricted to the fields of the
+// GethExecTrace of bus-mapping, so that it deserializes without adaptation.
+type GethExecTrace struct {
+	Gas        uint64         `json:"gas"`
+	Failed     bool           `json:"failed"`
+	StructLogs []GethExecStep `json:"structLogs"`
+}
+
+// GethExecStep is a StructLogRes restricted to the fields of the
+// GethExecStep of bus-mapping.
+type GethExecStep struct {
+	Pc      uint64            `json:"pc"`
+	Op      string            `json:"op"`
+	Gas     uint64            `json:"gas"`
+	GasCost uint64            `json:"gasCost"`
+	Depth   int               `json:"depth"`
+	Error   string            `json:"error,omitempty"`
+	Stack   []string          `json:"stack"`
+	Memory  []string          `json:"memory"`
+	Storage map[string]string `json:"storage"`
+}
+
+// FormatGethExecTraces formats results like the GethExecTraces of
+// bus-mapping. The stack, the memory and the storage which weren't captured
+// are empty.
+func FormatGethExecTraces(results []*ExecutionResult) []*GethExecTrace {
+	traces := make([]*GethExecTrace, len(results))
+	for i, result := range results {
+		logs := result.StructLogs.Formatted()
+		trace := &GethExecTrace{
+			Gas:        result.Gas,
+			Failed:     result.Failed,
+			StructLogs: make([]GethExecStep, len(logs)),
+		}
+		for j := range logs {
+			log := &logs[j]
+			step := GethExecStep{
+				Pc:      log.Pc,
+				Op:      log.Op,
+				Gas:     log.Gas,
+				GasCost: log.GasCost,
+				Depth:   log.Depth,
+				Error:   log.Error,
+				Stack:   []string{},
+				Memory:  []string{},
+				Storage: map[string]string{},
+			}
+			if log.Stack != nil {
+				step.Stack = *log.Stack
+			}
+			if log.Memory != nil {
+				step.Memory = *log.Memory
+			}
+			if log.Storage != nil {
+				step.Storage = *log.Storage
+			}
+			trace.StructLogs[j] = step
+		}
+		traces[i] = trace
+	}
+	return traces
+}
+
+// FormatResults returns results in the output of config, see
+// TraceConfig.Output.
+func FormatResults(config TraceConfig, results []*ExecutionResult) interface{} {
+	switch config.Output {
+	case OutputGeth:
+		return FormatGethExecTraces(results)
+	case OutputParity:
+		return FormatParityTraces(results)
+	default:
+		return results
+	}
+}
@@ -0,0 +1,113 @@
+package gethutil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// GoldenCase is a tiny canonical trace config exercising a single opcode,
+// error or precompile. The serialized traces of all cases are used as golden
+// vectors by the consumers of the trace schema.
+type GoldenCase struct {
+	Name   string
+	Config TraceConfig
+}
+
+var (
+	goldenSender   = common.BytesToAddress([]byte{0xfe})
+	goldenContract = common.BytesToAddress([]byte{0xff})
+	goldenCallee   = common.BytesToAddress([]byte{0x01, 0x00})
+)
+
+const goldenGasLimit = 1_000_000
+
+// GoldenCases returns the matrix of golden cases: one per opcode defined in
+// London, one per execution error, one writing storage out of order and one
+// per precompile.
+func GoldenCases() []GoldenCase {
+	var cases []GoldenCase
+	for i := 0; i < 256; i++ {
+		op := vm.OpCode(i)
+		if strings.Contains(op.String(), "not defined") {
+			continue
+		}
+		cases = append(cases, goldenCase("op_"+strings.ToLower(op.String()), opcodeProgram(op), goldenGasLimit))
+	}
+
+	// The stacks of the steps overflowing the stack are capped, to keep its
+	// vector small.
+	stackOverflow := goldenCase("err_stack_overflow", stackOverflowProgram(), goldenGasLimit)
+	stackOverflow.Config.TracerOptions.StackTopN = 2
+	cases = append(cases,
+		goldenCase("err_stack_underflow", NewAssembly().Add(), goldenGasLimit),
+		stackOverflow,
+		goldenCase("err_out_of_gas", NewAssembly().JumpDest().PushX(0).Jump(), 21100),
+		goldenCase("err_invalid_jump", NewAssembly().PushX(1).Jump().JumpDest(), goldenGasLimit),
+		goldenCase("err_invalid_opcode", NewAssembly().appendByte(vm.INVALID), goldenGasLimit),
+		goldenCase("err_write_protection", NewAssembly().StaticCall(0xffff, goldenCallee, 0, 0, 0, 0), goldenGasLimit),
+		goldenCase("err_return_data_out_of_bounds", NewAssembly().ReturnDataCopy(0, 0, 1), goldenGasLimit),
+		goldenCase("err_revert", NewAssembly().Revert(0, 0), goldenGasLimit),
+	)
+
+	// Storage written out of order, to catch nondeterministic ordering of
+	// the keys of the serialized maps.
+	cases = append(cases, goldenCase("storage_order", NewAssembly().SStore(3, 1).SStore(2, 1).SStore(1, 1), goldenGasLimit))
+
+	for i := 1; i <= 9; i++ {
+		precompile := common.BytesToAddress([]byte{byte(i)})
+		program := NewAssembly().MStore(0, 1).Call(0xffff, precompile, 0, 0, 32, 0, 32).Stop()
+		cases = append(cases, goldenCase(fmt.Sprintf("precompile_0x%02x", i), program, goldenGasLimit))
+	}
+
+	return cases
+}
+
+func goldenCase(name string, program *Asm, gasLimit uint64) GoldenCase {
+	contract := goldenContract
+	return GoldenCase{
+		Name: name,
+		Config: TraceConfig{
+			Accounts: map[common.Address]Account{
+				goldenContract: {Code: program.Bytecode()},
+				goldenCallee:   {Code: NewAssembly().SStore(0, 1).Bytecode()},
+			},
+			Transactions: []Transaction{{
+				From:     goldenSender,
+				To:       &contract,
+				GasLimit: hexutil.Uint64(gasLimit),
+			}},
+		},
+	}
+}
+
+// opcodeProgram returns a program that executes op once with all of its
+// stack inputs set to zero.
+func opcodeProgram(op vm.OpCode) *Asm {
+	a := NewAssembly()
+	if op.IsPush() {
+		n := int(op) - int(vm.PUSH1) + 1
+		a.appendByte(op)
+		for i := 0; i < n; i++ {
+			a.appendByte(0)
+		}
+		return a.Stop()
+	}
+
+	minStack, _, _ := opStackBounds(op)
+	for i := 0; i < minStack; i++ {
+		a.PushX(0)
+	}
+	return a.appendByte(op).Stop()
+}
+
+func stackOverflowProgram() *Asm {
+	a := NewAssembly()
+	for i := 0; i <= 1024; i++ {
+		a.PushX(0)
+	}
+	return a
+}
@@ -0,0 +1,57 @@
+package gethutil
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// StateHandle is a state set up once from the accounts of a TraceConfig, on
+// which the transactions of several TraceConfigs are traced in sequence,
+// each on the state left by the previous ones, so that a big state isn't
+// rebuilt for every transaction. It is safe for concurrent use, the traces
+// being serialized.
+type StateHandle struct {
+	mu      sync.Mutex
+	stateDB *StateDB
+}
+
+// NewStateHandle sets up a StateHandle with the accounts of config,
+// overridden by config.StateOverride. The transactions of config aren't
+// traced.
+func NewStateHandle(config TraceConfig) (*StateHandle, error) {
+	stateDB, err := newStateDB(config)
+	if err != nil {
+		return nil, err
+	}
+	return &StateHandle{stateDB: stateDB}, nil
+}
+
+// Trace traces the transactions of config on the state of h, see
+// TraceContext.
+func (h *StateHandle) Trace(config TraceConfig) ([]*ExecutionResult, error) {
+	return h.TraceContext(context.Background(), config)
+}
+
+// TraceContext traces the transactions of config like TraceContext, but on
+// the state of h, to which config.StateOverride is applied first, and which
+// keeps their changes. The Accounts of config must be empty. On failure, the
+// state keeps the changes of the transactions traced before the failed one.
+func (h *StateHandle) TraceContext(ctx context.Context, config TraceConfig) ([]*ExecutionResult, error) {
+	if len(config.Accounts) > 0 {
+		err := errors.New("accounts is set on a state handle")
+		return nil, NewTraceError(ErrCodeInvalidConfig, err, "Invalid config: %v", err)
+	}
+	env, err := newTraceEnv(config)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := config.StateOverride.Apply(h.stateDB); err != nil {
+		return nil, NewTraceError(ErrCodeInvalidConfig, err, "Failed to apply config.StateOverride: %v", err)
+	}
+	h.stateDB.Finalise(env.isEIP158())
+	return env.traceAll(ctx, h.stateDB, config)
+}
@@ -0,0 +1,140 @@
+package gethutil
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Header is a block header, RLP-encoded like types.Header.
+// As the go-ethereum in use predates Shanghai, types.Header lacks the
+// withdrawals root, and the fields of Cancun which follow it, so they are
+// added here, in the order of the later versions.
+type Header struct {
+	ParentHash  common.Hash
+	UncleHash   common.Hash
+	Coinbase    common.Address
+	Root        common.Hash
+	TxHash      common.Hash
+	ReceiptHash common.Hash
+	Bloom       types.Bloom
+	Difficulty  *big.Int
+	Number      *big.Int
+	GasLimit    uint64
+	GasUsed     uint64
+	Time        uint64
+	Extra       []byte
+	MixDigest   common.Hash
+	Nonce       types.BlockNonce
+
+	// BaseFee was added by London.
+	BaseFee *big.Int `rlp:"optional"`
+	// WithdrawalsHash was added by Shanghai.
+	WithdrawalsHash *common.Hash `rlp:"optional"`
+	// BlobGasUsed, ExcessBlobGas and ParentBeaconRoot were added by Cancun.
+	BlobGasUsed      *uint64      `rlp:"optional"`
+	ExcessBlobGas    *uint64      `rlp:"optional"`
+	ParentBeaconRoot *common.Hash `rlp:"optional"`
+}
+
+// RLP returns the RLP encoding of h.
+func (h *Header) RLP() ([]byte, error) {
+	return rlp.EncodeToBytes(h)
+}
+
+// Hash returns the hash of h, which is the keccak256 of its RLP encoding.
+func (h *Header) Hash() common.Hash {
+	// Same as github.com/ethereum/go-ethereum/core/types.rlpHash, the
+	// encoding of a header can't fail.
+	encoded, _ := h.RLP()
+	return crypto.Keccak256Hash(encoded)
+}
+
+// HeaderFields are the fields of a header which commit to the execution of
+// its block, and so aren't part of Block.
+type HeaderFields struct {
+	StateRoot        common.Hash
+	TransactionsRoot common.Hash
+	ReceiptsRoot     common.Hash
+	Bloom            types.Bloom
+	GasUsed          uint64
+}
+
+// NewHeader returns the header of the block of config with fields, whose
+// parent hash is the hash of the previous block, see TraceConfig.BlockHashes.
+func NewHeader(config TraceConfig, fields HeaderFields) (*Header, error) {
+	env, err := newTraceEnv(config)
+	if err != nil {
+		return nil, err
+	}
+	return env.header(config, fields), nil
+}
+
+// header returns the header of the block of config with fields. The
+// withdrawals root is set if the block has withdrawals, even none, or a
+// parent beacon block root, with which the blob gas fields of Cancun are 0.
+func (env *traceEnv) header(config TraceConfig, fields HeaderFields) *Header {
+	number := env.blockCtx.BlockNumber
+	header := &Header{
+		UncleHash:   types.EmptyUncleHash,
+		Coinbase:    env.blockCtx.Coinbase,
+		Root:        fields.StateRoot,
+		TxHash:      fields.TransactionsRoot,
+		ReceiptHash: fields.ReceiptsRoot,
+		Bloom:       fields.Bloom,
+		Difficulty:  toBigInt(config.Block.Difficulty),
+		Number:      new(big.Int).Set(number),
+		GasLimit:    env.blockCtx.GasLimit,
+		GasUsed:     fields.GasUsed,
+		Time:        env.blockCtx.Time.Uint64(),
+		Extra:       common.CopyBytes(config.Block.ExtraData),
+		MixDigest:   config.Block.MixHash,
+		Nonce:       config.Block.Nonce,
+	}
+	if number.Sign() > 0 {
+		header.ParentHash = env.blockCtx.GetHash(number.Uint64() - 1)
+	}
+	if isMerged(env.chainConfig) {
+		// The difficulty of the block context is the random.
+		header.Difficulty = new(big.Int)
+		header.MixDigest = common.BigToHash(env.blockCtx.Difficulty)
+		header.Nonce = types.BlockNonce{}
+	}
+	if env.chainConfig.IsLondon(number) {
+		header.BaseFee = new(big.Int).Set(env.blockCtx.BaseFee)
+	}
+	if config.Block.Withdrawals != nil || env.beaconRoot != nil {
+		withdrawalsHash := DeriveWithdrawalsRoot(config.Block.Withdrawals)
+		header.WithdrawalsHash = &withdrawalsHash
+	}
+	if env.beaconRoot != nil {
+		var blobGasUsed, excessBlobGas uint64
+		beaconRoot := *env.beaconRoot
+		header.BlobGasUsed = &blobGasUsed
+		header.ExcessBlobGas = &excessBlobGas
+		header.ParentBeaconRoot = &beaconRoot
+	}
+	return header
+}
+
+// withdrawalList is a list of withdrawals whose root is committed to by a
+// header.
+type withdrawalList []Withdrawal
+
+func (l withdrawalList) Len() int { return len(l) }
+
+func (l withdrawalList) EncodeIndex(i int, w *bytes.Buffer) {
+	// The fields of Withdrawal are in the order of the encoding of EIP-4895.
+	_ = rlp.Encode(w, &l[i])
+}
+
+// DeriveWithdrawalsRoot returns the root of the trie of withdrawals, which
+// is the withdrawals root of their header.
+func DeriveWithdrawalsRoot(withdrawals []Withdrawal) common.Hash {
+	return types.DeriveSha(withdrawalList(withdrawals), trie.NewStackTrie(nil))
+}
@@ -0,0 +1,140 @@
+package gethutil
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+//go:linkname newFrontierInstructionSet github.com/ethereum/go-ethereum/core/vm.newFrontierInstructionSet
+func newFrontierInstructionSet() vm.JumpTable
+
+//go:linkname newHomesteadInstructionSet github.com/ethereum/go-ethereum/core/vm.newHomesteadInstructionSet
+func newHomesteadInstructionSet() vm.JumpTable
+
+//go:linkname newTangerineWhistleInstructionSet github.com/ethereum/go-ethereum/core/vm.newTangerineWhistleInstructionSet
+func newTangerineWhistleInstructionSet() vm.JumpTable
+
+//go:linkname newSpuriousDragonInstructionSet github.com/ethereum/go-ethereum/core/vm.newSpuriousDragonInstructionSet
+func newSpuriousDragonInstructionSet() vm.JumpTable
+
+//go:linkname newByzantiumInstructionSet github.com/ethereum/go-ethereum/core/vm.newByzantiumInstructionSet
+func newByzantiumInstructionSet() vm.JumpTable
+
+//go:linkname newConstantinopleInstructionSet github.com/ethereum/go-ethereum/core/vm.newConstantinopleInstructionSet
+func newConstantinopleInstructionSet() vm.JumpTable
+
+//go:linkname newIstanbulInstructionSet github.com/ethereum/go-ethereum/core/vm.newIstanbulInstructionSet
+func newIstanbulInstructionSet() vm.JumpTable
+
+//go:linkname newBerlinInstructionSet github.com/ethereum/go-ethereum/core/vm.newBerlinInstructionSet
+func newBerlinInstructionSet() vm.JumpTable
+
+// newInstructionSet returns a new copy of the jump table the EVM picks for
+// rules, whose operations can be modified without affecting the other EVMs.
+// Modified from github.com/ethereum/go-ethereum/core/vm.NewEVMInterpreter
+func newInstructionSet(rules params.Rules) vm.JumpTable {
+	switch {
+	case rules.IsLondon:
+		return newLondonInstructionSet()
+	case rules.IsBerlin:
+		return newBerlinInstructionSet()
+	case rules.IsIstanbul:
+		return newIstanbulInstructionSet()
+	case rules.IsConstantinople:
+		return newConstantinopleInstructionSet()
+	case rules.IsByzantium:
+		return newByzantiumInstructionSet()
+	case rules.IsEIP158:
+		return newSpuriousDragonInstructionSet()
+	case rules.IsEIP150:
+		return newTangerineWhistleInstructionSet()
+	case rules.IsHomestead:
+		return newHomesteadInstructionSet()
+	default:
+		return newFrontierInstructionSet()
+	}
+}
+
+// activeJumpTable returns the jump table evm runs, which is the one of its
+// config, or the one it picks for its rules with its extra EIPs.
+// Modified from github.com/ethereum/go-ethereum/core/vm.NewEVMInterpreter
+func activeJumpTable(evm *vm.EVM) *vm.JumpTable {
+	if evm.Config.JumpTable != nil {
+		return evm.Config.JumpTable
+	}
+	jt := newInstructionSet(evm.ChainConfig().Rules(evm.Context.BlockNumber))
+	for _, eip := range evm.Config.ExtraEips {
+		// The EVM skips the EIPs it fails to activate.
+		_ = vm.EnableEIP(eip, &jt)
+	}
+	return &jt
+}
+
+// tableConstantGas returns the constant gas of op in jt.
+func tableConstantGas(jt *vm.JumpTable, op vm.OpCode) uint64 {
+	opPtr := unsafe.Pointer(jt[op])
+	if opPtr == nil {
+		return 0
+	}
+	return *(*uint64)(unsafe.Pointer(uintptr(opPtr) + constantGasPtrOffset))
+}
+
+// overrideConstantGas sets the constant gas of the opcodes of overrides,
+// which are opcode names, in jt.
+func overrideConstantGas(jt *vm.JumpTable, overrides map[string]uint64) error {
+	for name, gas := range overrides {
+		op := vm.StringToOp(name)
+		if op.String() != name {
+			return fmt.Errorf("unknown opcode %q", name)
+		}
+		opPtr := unsafe.Pointer(jt[op])
+		if opPtr == nil {
+			return fmt.Errorf("opcode %s is undefined", name)
+		}
+		*(*uint64)(unsafe.Pointer(uintptr(opPtr) + constantGasPtrOffset)) = gas
+	}
+	return nil
+}
+
+// undefinedOp is an opcode which is undefined in every fork.
+const undefinedOp vm.OpCode = 0x0c
+
+// disableOpcodes makes the opcodes of names, which are opcode names, invalid
+// in jt.
+func disableOpcodes(jt *vm.JumpTable, names []string) error {
+	for _, name := range names {
+		op := vm.StringToOp(name)
+		if op.String() != name {
+			return fmt.Errorf("unknown opcode %q", name)
+		}
+		// Whatever the go-ethereum in use does with the undefined opcodes,
+		// the disabled ones get the same.
+		jt[op] = jt[undefinedOp]
+	}
+	return nil
+}
+
+// newJumpTable returns the jump table of the EVMs of config, or nil to let
+// the EVM pick its own.
+func newJumpTable(config *TraceConfig, rules params.Rules) (*vm.JumpTable, error) {
+	if len(config.GasOverrides) == 0 && len(config.DisabledOpcodes) == 0 {
+		return nil, nil
+	}
+	jt := newInstructionSet(rules)
+	// The EVM only activates vm.Config.ExtraEips in the jump table it picks.
+	for _, eip := range config.ExtraEips {
+		if err := vm.EnableEIP(eip, &jt); err != nil {
+			return nil, err
+		}
+	}
+	if err := overrideConstantGas(&jt, config.GasOverrides); err != nil {
+		return nil, err
+	}
+	if err := disableOpcodes(&jt, config.DisabledOpcodes); err != nil {
+		return nil, err
+	}
+	return &jt, nil
+}
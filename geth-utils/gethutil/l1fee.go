@@ -0,0 +1,140 @@
+package gethutil
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// L1DataFeeFunc returns the L1 data fee of the txIndex-th transaction given
+// its serialization, which is the binary encoding of the unsigned
+// transaction.
+type L1DataFeeFunc func(txIndex int, data []byte) *big.Int
+
+// L1FeeParams are the parameters of the L1 data fee of a rollup like
+// Optimism Bedrock, which charges
+//
+//	(zero bytes * 4 + non-zero bytes * 16 + overhead) * base_fee * scalar / 10^6
+//
+// for the serialization of a transaction.
+type L1FeeParams struct {
+	BaseFee  *hexutil.Big   `json:"base_fee"`
+	Overhead hexutil.Uint64 `json:"overhead"`
+	Scalar   hexutil.Uint64 `json:"scalar"`
+}
+
+// dataFee returns the L1 data fee of data.
+func (p *L1FeeParams) dataFee(_ int, data []byte) *big.Int {
+	gas := uint64(p.Overhead)
+	for _, b := range data {
+		if b == 0 {
+			gas += 4
+		} else {
+			gas += 16
+		}
+	}
+	fee := new(big.Int).SetUint64(gas)
+	fee.Mul(fee, toBigInt(p.BaseFee))
+	fee.Mul(fee, new(big.Int).SetUint64(uint64(p.Scalar)))
+	return fee.Div(fee, big.NewInt(1_000_000))
+}
+
+// l1DataFee returns the L1 data fee function of config, which is
+// config.L1DataFee if set, or the one of config.L1Fee, or nil if the
+// transactions pay no L1 data fee.
+func (config *TraceConfig) l1DataFee() L1DataFeeFunc {
+	if config.L1DataFee != nil {
+		return config.L1DataFee
+	}
+	if config.L1Fee != nil {
+		return config.L1Fee.dataFee
+	}
+	return nil
+}
+
+// txType returns the type of the transaction tx is serialized as.
+func txType(tx Transaction) uint8 {
+	switch {
+	case tx.GasPrice == nil && (tx.GasFeeCap != nil || tx.GasTipCap != nil):
+		return types.DynamicFeeTxType
+	case len(tx.AccessList) > 0:
+		return types.AccessListTxType
+	default:
+		return types.LegacyTxType
+	}
+}
+
+// serializeMessage returns the binary encoding of message as an unsigned
+// transaction of txType.
+func serializeMessage(message types.Message, txType uint8, chainID *big.Int) ([]byte, error) {
+	var txData types.TxData
+	switch txType {
+	case types.DynamicFeeTxType:
+		txData = &types.DynamicFeeTx{
+			ChainID:    chainID,
+			Nonce:      message.Nonce(),
+			GasTipCap:  message.GasTipCap(),
+			GasFeeCap:  message.GasFeeCap(),
+			Gas:        message.Gas(),
+			To:         message.To(),
+			Value:      message.Value(),
+			Data:       message.Data(),
+			AccessList: message.AccessList(),
+		}
+	case types.AccessListTxType:
+		txData = &types.AccessListTx{
+			ChainID:    chainID,
+			Nonce:      message.Nonce(),
+			GasPrice:   message.GasPrice(),
+			Gas:        message.Gas(),
+			To:         message.To(),
+			Value:      message.Value(),
+			Data:       message.Data(),
+			AccessList: message.AccessList(),
+		}
+	default:
+		txData = &types.LegacyTx{
+			Nonce:    message.Nonce(),
+			GasPrice: message.GasPrice(),
+			Gas:      message.Gas(),
+			To:       message.To(),
+			Value:    message.Value(),
+			Data:     message.Data(),
+		}
+	}
+	return types.NewTx(txData).MarshalBinary()
+}
+
+// chargeL1Fee charges the sender of message, the i-th one, its L1 data fee
+// before its execution, and returns it, or nil if it pays none, like the
+// deposits. With config.SkipBalanceCheck, the sender is credited the
+// shortfall instead of failing.
+func (env *traceEnv) chargeL1Fee(stateDB *StateDB, i int, message types.Message, config TraceConfig) (*big.Int, error) {
+	if env.l1DataFee == nil || env.mints[i] != nil {
+		return nil, nil
+	}
+	data, err := serializeMessage(message, env.txTypes[i], env.chainConfig.ChainID)
+	if err != nil {
+		return nil, NewTraceError(ErrCodeInternal, err, "Failed to serialize config.Transactions[%d]: %v", i, err)
+	}
+	fee := env.l1DataFee(i, data)
+	if fee == nil || fee.Sign() == 0 {
+		return nil, nil
+	}
+
+	from := message.From()
+	if balance := stateDB.GetBalance(from); balance.Cmp(fee) < 0 {
+		if !config.SkipBalanceCheck {
+			return nil, fmt.Errorf("%w: address %v have %v want %v for the L1 data fee", core.ErrInsufficientFunds, from.Hex(), balance, fee)
+		}
+		stateDB.AddBalance(from, new(big.Int).Sub(fee, balance))
+	}
+	stateDB.SubBalance(from, fee)
+	if config.SkipBalanceCheck {
+		creditShortfall(stateDB, message)
+	}
+	return fee, nil
+}
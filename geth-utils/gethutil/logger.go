@@ -0,0 +1,634 @@
+package gethutil
+
+import (
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers/logger"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+// TracerOptions controls what is captured at each step of a trace.
+type TracerOptions struct {
+	// DisableMemory disables the memory capture.
+	DisableMemory bool `json:"disable_memory"`
+	// MemoryOnWrite captures the memory only at steps of memory-writing
+	// opcodes.
+	MemoryOnWrite bool `json:"memory_on_write"`
+	// MemoryLimit caps the captured memory of each step to its first
+	// MemoryLimit bytes, where 0 means unlimited.
+	MemoryLimit uint64 `json:"memory_limit"`
+	// StackTopN captures only the top StackTopN elements of the stack, where
+	// 0 means the whole stack.
+	StackTopN int `json:"stack_top_n"`
+	// MaxSteps stops capturing the steps after MaxSteps captured steps and
+	// marks the result as truncated, where 0 means unlimited. The execution
+	// still runs to its end, so that its outcome and state are the same.
+	MaxSteps int `json:"max_steps"`
+	// Summary adds the summary of the steps to the result, see Summarize.
+	Summary bool `json:"summary"`
+	// Opcodes, if not empty, captures only the steps of the opcodes of
+	// these names, e.g. "SSTORE".
+	Opcodes []string `json:"opcodes"`
+	// StartStep and EndStep capture only the steps of index in [StartStep,
+	// EndStep) among all the steps, where an EndStep of 0 means no end.
+	StartStep int `json:"start_step"`
+	EndStep   int `json:"end_step"`
+	// ChunkSize splits the steps into chunks of at most ChunkSize steps,
+	// each with the continuation of its first step, where 0 means no
+	// chunks.
+	ChunkSize int `json:"chunk_size"`
+}
+
+// captureStep returns whether the index-th step, of op, should be captured.
+func (opts *TracerOptions) captureStep(index int, op vm.OpCode) bool {
+	if index < opts.StartStep || (opts.EndStep != 0 && index >= opts.EndStep) {
+		return false
+	}
+	if len(opts.Opcodes) == 0 {
+		return true
+	}
+	name := op.String()
+	for _, opcode := range opts.Opcodes {
+		if opcode == name {
+			return true
+		}
+	}
+	return false
+}
+
+// captureMemory returns whether the memory should be captured at a step of op.
+func (opts *TracerOptions) captureMemory(op vm.OpCode) bool {
+	if opts.DisableMemory {
+		return false
+	}
+	if opts.MemoryOnWrite {
+		return isMemoryWriting(op)
+	}
+	return true
+}
+
+func isMemoryWriting(op vm.OpCode) bool {
+	switch op {
+	case vm.MSTORE, vm.MSTORE8, vm.CALLDATACOPY, vm.CODECOPY, vm.EXTCODECOPY, vm.RETURNDATACOPY,
+		vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		return true
+	}
+	return false
+}
+
+// Access is the access of an address, or of a storage slot of an address,
+// by a step, subject to EIP-2929.
+type Access struct {
+	Address common.Address
+	// Slot is nil for an access of an address.
+	Slot *common.Hash
+	// Warm is whether the address or slot was already in the access list.
+	Warm bool
+	// Gas is the access cost charged by EIP-2929, included in the gas cost of
+	// the step.
+	Gas uint64
+}
+
+// stepAccess returns the access of a step of op, or nil if op doesn't access
+// the state subject to EIP-2929. coldAccesses are the accesses which were
+// added to the access list by the step.
+func stepAccess(op vm.OpCode, contract common.Address, stack []uint256.Int, coldAccesses map[accessKey]struct{}) *Access {
+	peek := func(n int) *uint256.Int { return &stack[len(stack)-1-n] }
+	var key accessKey
+	switch op {
+	case vm.SLOAD, vm.SSTORE:
+		if len(stack) < 1 {
+			return nil
+		}
+		key = accessKey{address: contract, slot: common.Hash(peek(0).Bytes32()), isSlot: true}
+	case vm.BALANCE, vm.EXTCODESIZE, vm.EXTCODECOPY, vm.EXTCODEHASH, vm.SELFDESTRUCT:
+		if len(stack) < 1 {
+			return nil
+		}
+		key = accessKey{address: common.Address(peek(0).Bytes20())}
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		if len(stack) < 2 {
+			return nil
+		}
+		key = accessKey{address: common.Address(peek(1).Bytes20())}
+	default:
+		return nil
+	}
+
+	_, cold := coldAccesses[key]
+	access := &Access{Address: key.address, Warm: !cold}
+	if key.isSlot {
+		slot := key.slot
+		access.Slot = &slot
+	}
+	switch {
+	case op == vm.SSTORE:
+		if cold {
+			access.Gas = params.ColdSloadCostEIP2929
+		}
+	case op == vm.SELFDESTRUCT:
+		if cold {
+			access.Gas = params.ColdAccountAccessCostEIP2929
+		}
+	case !cold:
+		access.Gas = params.WarmStorageReadCostEIP2929
+	case op == vm.SLOAD:
+		access.Gas = params.ColdSloadCostEIP2929
+	default:
+		access.Gas = params.ColdAccountAccessCostEIP2929
+	}
+	return access
+}
+
+// StorageAccess is the access of a storage slot by an SLOAD or SSTORE step,
+// with the inputs of the EIP-2200/3529 storage gas.
+type StorageAccess struct {
+	Address common.Address
+	Key     common.Hash
+	// Original is the value at the start of the transaction.
+	Original common.Hash
+	// Current is the value before the step.
+	Current common.Hash
+	// New is the value after the step, which is Current for SLOAD.
+	New common.Hash
+	// GasCost is the gas cost of the step.
+	GasCost uint64
+	// RefundDelta is the change of the refund counter by the step.
+	RefundDelta int64
+}
+
+// StructLog is a logger.StructLog extended with the extra information
+// captured by StructLogger.
+type StructLog struct {
+	logger.StructLog
+	// StackSize is the depth of the stack, which is larger than len(Stack)
+	// when only the top of the stack is captured.
+	StackSize int
+	// ReturnDataSize is the size of the return data buffer of the last call.
+	ReturnDataSize int
+	// Access is the EIP-2929 access of the step, if any.
+	Access *Access
+	// StorageAccess is the storage access of an SLOAD or SSTORE step.
+	StorageAccess *StorageAccess
+	// GasCosts is the decomposition of GasCost, which is nil for a failed
+	// step.
+	GasCosts *GasCost
+	// CallGas is the gas sent to the callee of a successful CALL-family
+	// step.
+	CallGas *CallGas
+	// CallID is the ID of the call frame of the step, and CallerID the ID of
+	// its caller frame (0 for the root frame). IDs are assigned from 1 in
+	// the order the frames are entered.
+	CallID   int
+	CallerID int
+	// IsStatic is whether the call frame of the step is in a static context,
+	// and IsCreate whether it runs init code.
+	IsStatic bool
+	IsCreate bool
+}
+
+// Call is a call frame of a transaction, including the root one.
+type Call struct {
+	ID       int
+	CallerID int
+	// Type is CALL or CREATE for the root call frame.
+	Type  vm.OpCode
+	From  common.Address
+	To    common.Address
+	Input []byte
+	// Value is nil for DELEGATECALL and STATICCALL.
+	Value   *big.Int
+	Gas     uint64
+	GasUsed uint64
+	Output  []byte
+	Err     error
+	// RevertReason is the decoded reason of a reverted call, see
+	// DecodeRevertReason.
+	RevertReason string
+	// CreatedAddress is the address derived for a creation frame, see
+	// ContractAddress and Create2Address, which is also its To.
+	CreatedAddress *common.Address
+	// CodeHash is the hash of the code run by the call frame, which is the
+	// init code for the creations, unless it ran no step.
+	CodeHash *common.Hash
+}
+
+// callFrame is an active call frame.
+type callFrame struct {
+	id     int
+	static bool
+	create bool
+	// memSize is the memory size after the expansion of the last step.
+	memSize uint64
+	// codeRecorded is set once the code of the frame is recorded, see
+	// recordBytecodes.
+	codeRecorded bool
+	// callStep is 1 + the index in logs of the last CALL-family step of the
+	// frame, until the gas returned to it is recorded, or 0.
+	callStep int
+}
+
+// StructLogger is an EVM logger which captures the execution steps of a
+// transaction, with the granularity controlled by TracerOptions.
+// Modified from github.com/ethereum/go-ethereum/eth/tracers/logger.StructLogger
+type StructLogger struct {
+	opts TracerOptions
+
+	storage map[common.Address]logger.Storage
+	logs    []StructLog
+	env     *vm.EVM
+	// statedb is set when the EVM runs on a StateDB, which is observed for
+	// the extra information of the steps.
+	statedb *StateDB
+	// jumpTable is the jump table of the EVM, whose constant gas is the one
+	// of the steps, see TraceConfig.GasOverrides.
+	jumpTable *vm.JumpTable
+
+	steps     int
+	truncated bool
+	// captured is the number of captured steps, which are either in logs or
+	// passed to onStep, and lastOp is the opcode of the last step.
+	captured int
+	lastOp   vm.OpCode
+	// onStep, if set, is passed the captured steps in place of logs, and
+	// stepErr is the first error it returned.
+	onStep  func(step *StructLog) error
+	stepErr error
+	rw      RWEstimate
+	// continuations are the continuations of the first steps of the chunks.
+	continuations []Continuation
+	// firstError is the error of the first step which failed.
+	firstError *ExecError
+
+	// frames is the stack of the active call frames.
+	frames     []callFrame
+	nextCallID int
+	// calls are all the call frames, where the one of ID is calls[ID-1].
+	calls []Call
+	// bytecodes are the code run or read by the transaction by hash.
+	bytecodes map[common.Hash][]byte
+	// blockHashes are the lookups of the BLOCKHASH steps.
+	blockHashes []BlockHashRes
+	// eventLogs are the logs of the LOG steps, including the reverted ones.
+	eventLogs []Log
+}
+
+// NewStructLogger returns a new StructLogger capturing steps as specified by
+// opts.
+func NewStructLogger(opts TracerOptions) *StructLogger {
+	return &StructLogger{
+		opts:    opts,
+		storage: make(map[common.Address]logger.Storage),
+	}
+}
+
+// NewStreamingStructLogger returns a new StructLogger passing each captured
+// step to onStep instead of keeping it, so that its memory doesn't grow with
+// the steps. The execution is stopped at the first error returned by onStep,
+// see StepError.
+func NewStreamingStructLogger(opts TracerOptions, onStep func(step *StructLog) error) *StructLogger {
+	l := NewStructLogger(opts)
+	l.onStep = onStep
+	return l
+}
+
+// CaptureStart implements the vm.EVMLogger interface to initialize the
+// tracing operation.
+func (l *StructLogger) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	l.env = env
+	l.jumpTable = activeJumpTable(env)
+	typ := vm.CALL
+	if create {
+		typ = vm.CREATE
+	}
+	l.enterCall(typ, from, to, input, gas, value, false)
+	if statedb, ok := env.StateDB.(*StateDB); ok {
+		l.statedb = statedb
+		// Drop the accesses of the tx preparation.
+		statedb.takeColdAccesses()
+		statedb.takeRefundDelta()
+	}
+}
+
+// CaptureState logs a new structured log message and pushes it out to the
+// environment.
+func (l *StructLogger) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	// The accesses added by the dynamic gas of the step, which is computed
+	// before the step is captured.
+	var coldAccesses map[accessKey]struct{}
+	var refundDelta int64
+	if l.statedb != nil {
+		coldAccesses = l.statedb.takeColdAccesses()
+		refundDelta = l.statedb.takeRefundDelta()
+	}
+
+	if l.stepErr != nil {
+		return
+	}
+	l.steps++
+
+	memory := scope.Memory
+	stack := scope.Stack
+	contract := scope.Contract
+
+	stackData := stack.Data()
+	l.rw.addStep(op, stackData)
+	l.recordBytecodes(op, contract, stackData)
+	l.recordBlockHash(op, stackData)
+	if err == nil {
+		l.recordLog(op, contract.Address(), stackData, memory.Data())
+	}
+	l.lastOp = op
+	l.recordReturnedGas(gas)
+	capture := l.opts.captureStep(l.steps-1, op)
+	if capture && l.opts.MaxSteps != 0 && l.captured >= l.opts.MaxSteps {
+		l.truncated = true
+		capture = false
+	}
+	if !capture {
+		// Only keep track of the state the following steps depend on.
+		l.recordStorage(op, contract.Address(), stackData)
+		if n := len(l.frames); n > 0 {
+			l.frames[n-1].memSize = uint64(memory.Len())
+		}
+		if err == nil {
+			err = callFailure(l.env.StateDB, op, depth, contract.Address(), stackData, memory.Data())
+		}
+		l.recordError(op, err)
+		return
+	}
+
+	// Copy a snapshot of the current memory state to a new buffer
+	var mem []byte
+	if l.opts.captureMemory(op) {
+		data := memory.Data()
+		if l.opts.MemoryLimit != 0 && uint64(len(data)) > l.opts.MemoryLimit {
+			data = data[:l.opts.MemoryLimit]
+		}
+		mem = make([]byte, len(data))
+		copy(mem, data)
+	}
+	if l.opts.ChunkSize > 0 && l.captured%l.opts.ChunkSize == 0 {
+		l.continuations = append(l.continuations, l.continuation(pc, gas, depth, stackData, memory.Data()))
+	}
+
+	// Copy a snapshot of the current stack state to a new buffer
+	stackLen := len(stackData)
+	topN := stackLen
+	if l.opts.StackTopN > 0 && l.opts.StackTopN < stackLen {
+		topN = l.opts.StackTopN
+	}
+	stck := make([]uint256.Int, topN)
+	copy(stck, stackData[stackLen-topN:])
+	// Copy a snapshot of the current storage to a new container
+	var storage logger.Storage
+	var storageAccess *StorageAccess
+	if (op == vm.SLOAD && stackLen >= 1) || (op == vm.SSTORE && stackLen >= 2) {
+		key := common.Hash(stackData[stackLen-1].Bytes32())
+		storageAccess = &StorageAccess{
+			Address:     contract.Address(),
+			Key:         key,
+			Original:    l.env.StateDB.GetCommittedState(contract.Address(), key),
+			Current:     l.env.StateDB.GetState(contract.Address(), key),
+			GasCost:     cost,
+			RefundDelta: refundDelta,
+		}
+		storageAccess.New = storageAccess.Current
+		if op == vm.SSTORE {
+			storageAccess.New = common.Hash(stackData[stackLen-2].Bytes32())
+		}
+	}
+	if l.recordStorage(op, contract.Address(), stackData) {
+		storage = l.storage[contract.Address()].Copy()
+	}
+	frame, callerID := l.currentFrame()
+	// The memory is captured after its expansion by the step, so the size
+	// before is the size after the last step of the frame.
+	access := stepAccess(op, contract.Address(), stackData, coldAccesses)
+	var gasCosts *GasCost
+	var callGas *CallGas
+	if err == nil {
+		gasCosts = stepGasCost(l.jumpTable, op, cost, stackData, frame.memSize, uint64(memory.Len()), access)
+		callGas = stepCallGas(l.env.StateDB, l.env.ChainConfig().IsEIP158(l.env.Context.BlockNumber), op, stackData, gasCosts)
+	}
+	if n := len(l.frames); n > 0 {
+		l.frames[n-1].memSize = uint64(memory.Len())
+	}
+	// create a new snapshot of the EVM.
+	log := StructLog{
+		StructLog: logger.StructLog{
+			Pc:            pc,
+			Op:            op,
+			Gas:           gas,
+			GasCost:       cost,
+			Memory:        mem,
+			MemorySize:    memory.Len(),
+			Stack:         stck,
+			Storage:       storage,
+			Depth:         depth,
+			RefundCounter: l.env.StateDB.GetRefund(),
+			Err:           err,
+		},
+		StackSize:      stackLen,
+		ReturnDataSize: len(rData),
+		Access:         access,
+		StorageAccess:  storageAccess,
+		GasCosts:       gasCosts,
+		CallGas:        callGas,
+		CallID:         frame.id,
+		CallerID:       callerID,
+		IsStatic:       frame.static,
+		IsCreate:       frame.create,
+	}
+	l.captured++
+	if l.onStep == nil {
+		l.logs = append(l.logs, log)
+		if n := len(l.frames); n > 0 && callGas != nil {
+			l.frames[n-1].callStep = len(l.logs)
+		}
+	} else if stepErr := l.onStep(&log); stepErr != nil {
+		l.stepErr = stepErr
+		l.env.Cancel()
+	}
+	if err == nil {
+		err = callFailure(l.env.StateDB, op, depth, contract.Address(), stackData, memory.Data())
+	}
+	l.recordError(op, err)
+}
+
+// recordStorage records the entry of the storage of contract read by an SLOAD
+// or written by an SSTORE step of op with stack, and returns whether it did.
+func (l *StructLogger) recordStorage(op vm.OpCode, contract common.Address, stack []uint256.Int) bool {
+	stackLen := len(stack)
+	if (op != vm.SLOAD || stackLen < 1) && (op != vm.SSTORE || stackLen < 2) {
+		return false
+	}
+	// initialise new changed values storage container for this contract
+	// if not present.
+	if l.storage[contract] == nil {
+		l.storage[contract] = make(logger.Storage)
+	}
+	address := common.Hash(stack[stackLen-1].Bytes32())
+	if op == vm.SLOAD {
+		// capture SLOAD opcodes and record the read entry in the local storage
+		l.storage[contract][address] = l.env.StateDB.GetState(contract, address)
+	} else {
+		// capture SSTORE opcodes and record the written entry in the local storage.
+		l.storage[contract][address] = common.Hash(stack[stackLen-2].Bytes32())
+	}
+	return true
+}
+
+// recordReturnedGas records the gas returned to the last CALL-family step of
+// the current frame, if any, given the gas of the next step of the frame,
+// which is the gas left after the call step plus the gas returned.
+func (l *StructLogger) recordReturnedGas(gas uint64) {
+	n := len(l.frames)
+	if n == 0 || l.frames[n-1].callStep == 0 {
+		return
+	}
+	step := &l.logs[l.frames[n-1].callStep-1]
+	l.frames[n-1].callStep = 0
+	if left := step.Gas - step.GasCost; gas >= left {
+		returned := gas - left
+		step.CallGas.Returned = &returned
+	}
+}
+
+// CaptureFault implements the vm.EVMLogger interface to trace an execution
+// fault while running an opcode.
+func (l *StructLogger) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+	// The step failed in its execution, after it was captured.
+	l.recordError(op, err)
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (l *StructLogger) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) {
+	l.exitCall(output, gasUsed, err)
+}
+
+func (l *StructLogger) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	static := typ == vm.STATICCALL
+	if n := len(l.frames); n > 0 {
+		static = static || l.frames[n-1].static
+	}
+	l.enterCall(typ, from, to, input, gas, value, static)
+	if l.statedb != nil {
+		// Drop the access of the created address.
+		l.statedb.takeColdAccesses()
+	}
+}
+
+func (l *StructLogger) CaptureExit(output []byte, gasUsed uint64, err error) {
+	l.exitCall(output, gasUsed, err)
+}
+
+// enterCall pushes the entered call frame with the next call ID.
+func (l *StructLogger) enterCall(typ vm.OpCode, from, to common.Address, input []byte, gas uint64, value *big.Int, static bool) {
+	callerID := 0
+	if n := len(l.frames); n > 0 {
+		callerID = l.frames[n-1].id
+	}
+	l.nextCallID++
+	l.frames = append(l.frames, callFrame{
+		id:     l.nextCallID,
+		static: static,
+		create: typ == vm.CREATE || typ == vm.CREATE2,
+	})
+
+	call := Call{
+		ID:       l.nextCallID,
+		CallerID: callerID,
+		Type:     typ,
+		From:     from,
+		To:       to,
+		Input:    common.CopyBytes(input),
+		Gas:      gas,
+	}
+	if value != nil {
+		call.Value = new(big.Int).Set(value)
+	}
+	if l.frames[len(l.frames)-1].create {
+		created := to
+		call.CreatedAddress = &created
+	}
+	l.calls = append(l.calls, call)
+}
+
+// exitCall pops the exited call frame and records its outcome.
+func (l *StructLogger) exitCall(output []byte, gasUsed uint64, err error) {
+	frame := l.frames[len(l.frames)-1]
+	l.frames = l.frames[:len(l.frames)-1]
+
+	call := &l.calls[frame.id-1]
+	call.GasUsed = gasUsed
+	call.Output = common.CopyBytes(output)
+	call.Err = err
+	if errors.Is(err, vm.ErrExecutionReverted) {
+		call.RevertReason, _ = DecodeRevertReason(output)
+	}
+	// The deployment of the code returned by the last step of a creation
+	// fails after the step.
+	if frame.create && l.steps > 0 && (errors.Is(err, vm.ErrCodeStoreOutOfGas) || errors.Is(err, vm.ErrMaxCodeSizeExceeded) || errors.Is(err, vm.ErrInvalidCode)) {
+		l.recordError(l.lastOp, err)
+	}
+}
+
+// recordError records err as the error of the last step of op if it is the
+// first error.
+func (l *StructLogger) recordError(op vm.OpCode, err error) {
+	if l.firstError != nil || l.steps == 0 {
+		return
+	}
+	if kind, oog := classifyExecError(op, err); kind != "" {
+		l.firstError = &ExecError{Step: l.steps - 1, Kind: kind, Oog: oog, Err: err}
+	}
+}
+
+// currentFrame returns the current call frame and the ID of its caller
+// frame.
+func (l *StructLogger) currentFrame() (callFrame, int) {
+	var frame callFrame
+	callerID := 0
+	if n := len(l.frames); n > 0 {
+		frame = l.frames[n-1]
+		if n > 1 {
+			callerID = l.frames[n-2].id
+		}
+	}
+	return frame, callerID
+}
+
+// Calls returns the call frames in the order they were entered.
+func (l *StructLogger) Calls() []Call { return l.calls }
+
+// StructLogs returns the captured log entries.
+func (l *StructLogger) StructLogs() []StructLog { return l.logs }
+
+// Truncated returns whether steps weren't captured after reaching MaxSteps.
+func (l *StructLogger) Truncated() bool { return l.truncated }
+
+// RWEstimate returns the estimate of the read/write operations of the
+// executed steps, including the ones which weren't captured.
+func (l *StructLogger) RWEstimate() RWEstimate { return l.rw }
+
+// Continuations returns the continuations of the first steps of the chunks
+// of TracerOptions.ChunkSize steps.
+func (l *StructLogger) Continuations() []Continuation { return l.continuations }
+
+// StepError returns the first error returned by the onStep of a
+// NewStreamingStructLogger.
+func (l *StructLogger) StepError() error { return l.stepErr }
+
+// FirstError returns the error of the first step which failed, or
+// nil if none failed.
+func (l *StructLogger) FirstError() *ExecError { return l.firstError }
+
+// Steps returns the number of steps executed, including the ones which
+// weren't captured.
+func (l *StructLogger) Steps() int { return l.steps }
@@ -0,0 +1,106 @@
+package gethutil
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/holiman/uint256"
+)
+
+// Log is a log emitted by a LOG step.
+type Log struct {
+	// CallID is the ID of the call frame of the LOG step.
+	CallID  int
+	Address common.Address
+	Topics  []common.Hash
+	Data    []byte
+	// Reverted is set when the call frame of the LOG step, or one of its
+	// callers, failed.
+	Reverted bool
+}
+
+// LogRes is a log of a transaction, see Log.
+type LogRes struct {
+	CallID   int            `json:"callId"`
+	Address  common.Address `json:"address"`
+	Topics   []common.Hash  `json:"topics"`
+	Data     hexutil.Bytes  `json:"data"`
+	Reverted bool           `json:"reverted,omitempty"`
+}
+
+// recordLog records the log of a LOG step of op, run by address with stack
+// and memory.
+// Modified from github.com/ethereum/go-ethereum/core/vm.makeLog
+func (l *StructLogger) recordLog(op vm.OpCode, address common.Address, stack []uint256.Int, memory []byte) {
+	if op < vm.LOG0 || op > vm.LOG4 {
+		return
+	}
+	size := int(op - vm.LOG0)
+	if len(stack) < 2+size {
+		return
+	}
+	offset, overflow := stack[len(stack)-1].Uint64WithOverflow()
+	length, lengthOverflow := stack[len(stack)-2].Uint64WithOverflow()
+	// A LOG step reading past the memory failed its expansion.
+	if (overflow && length != 0) || lengthOverflow || length > uint64(len(memory)) {
+		return
+	}
+	log := Log{
+		Address: address,
+		Topics:  make([]common.Hash, size),
+		Data:    make([]byte, length),
+	}
+	if n := len(l.frames); n > 0 {
+		log.CallID = l.frames[n-1].id
+	}
+	for i := range log.Topics {
+		log.Topics[i] = common.Hash(stack[len(stack)-3-i].Bytes32())
+	}
+	// The memory is expanded before the step is captured.
+	if offset < uint64(len(memory)) {
+		copy(log.Data, memory[offset:])
+	}
+	l.eventLogs = append(l.eventLogs, log)
+}
+
+// Logs returns the logs of the transaction in order, marking the ones
+// reverted with their call frame or one of its callers.
+func (l *StructLogger) Logs() []Log {
+	logs := make([]Log, len(l.eventLogs))
+	for i, log := range l.eventLogs {
+		log.Reverted = l.reverted(log.CallID)
+		logs[i] = log
+	}
+	return logs
+}
+
+// reverted returns whether the call frame of ID, or one of its callers,
+// failed.
+func (l *StructLogger) reverted(id int) bool {
+	for id > 0 {
+		call := &l.calls[id-1]
+		if call.Err != nil {
+			return true
+		}
+		id = call.CallerID
+	}
+	return false
+}
+
+// FormatEventLogs formats logs for json output.
+func FormatEventLogs(logs []Log) []LogRes {
+	if len(logs) == 0 {
+		return nil
+	}
+	formatted := make([]LogRes, len(logs))
+	for i, log := range logs {
+		formatted[i] = LogRes{
+			CallID:   log.CallID,
+			Address:  log.Address,
+			Topics:   log.Topics,
+			Data:     log.Data,
+			Reverted: log.Reverted,
+		}
+	}
+	return formatted
+}
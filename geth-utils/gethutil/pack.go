@@ -0,0 +1,113 @@
+package gethutil
+
+import "fmt"
+
+// PackLimits bounds the capacity of a single prover chunk. A zero value means
+// the corresponding resource is unlimited.
+type PackLimits struct {
+	MaxGas  uint64 `json:"maxGas"`
+	MaxRows uint64 `json:"maxRows"`
+}
+
+// PackDecision records why a traced tx was packed into a chunk or deferred
+// out of it.
+type PackDecision struct {
+	TxIndex   int    `json:"txIndex"`
+	Chunk     int    `json:"chunk"`
+	Deferred  bool   `json:"deferred"`
+	Reason    string `json:"reason,omitempty"`
+	Gas       uint64 `json:"gas"`
+	Rows      uint64 `json:"rows"`
+	ChunkGas  uint64 `json:"chunkGas"`
+	ChunkRows uint64 `json:"chunkRows"`
+}
+
+// PackingReport is the auditable outcome of packing traced txs into chunks.
+// Chunks holds the tx indices of each chunk, Decisions holds every packing
+// decision in the order it was taken, and Unpacked holds the indices of txs
+// which could not be placed in any chunk.
+type PackingReport struct {
+	Chunks    [][]int        `json:"chunks"`
+	Decisions []PackDecision `json:"decisions"`
+	Unpacked  []int          `json:"unpacked,omitempty"`
+}
+
+// txRows returns the number of rows a traced tx is accounted for, which is
+// the number of executed steps, whether or not they were captured.
+func txRows(result *ExecutionResult) uint64 {
+	return uint64(result.Steps)
+}
+
+// PackChunks packs traced txs into chunks in order, starting a new chunk
+// whenever the next tx would exceed the limits of the current one. Since txs
+// depend on the state left by their predecessors, order is never changed: a
+// tx which exceeds the limits on its own can't be packed, and it is reported
+// together with all the txs after it in Unpacked.
+func PackChunks(results []*ExecutionResult, limits PackLimits) *PackingReport {
+	report := &PackingReport{Chunks: [][]int{}}
+
+	var chunk []int
+	var chunkGas, chunkRows uint64
+	for i := 0; i < len(results); i++ {
+		gas, rows := results[i].Gas, txRows(results[i])
+		decision := PackDecision{
+			TxIndex:   i,
+			Chunk:     len(report.Chunks),
+			Gas:       gas,
+			Rows:      rows,
+			ChunkGas:  chunkGas,
+			ChunkRows: chunkRows,
+		}
+
+		reason := exceededLimit(limits, chunkGas+gas, chunkRows+rows)
+		if reason == "" {
+			report.Decisions = append(report.Decisions, decision)
+			chunk = append(chunk, i)
+			chunkGas += gas
+			chunkRows += rows
+			continue
+		}
+
+		decision.Deferred = true
+		decision.Reason = reason
+		report.Decisions = append(report.Decisions, decision)
+
+		if len(chunk) == 0 {
+			// The tx doesn't fit even in an empty chunk.
+			for j := i; j < len(results); j++ {
+				report.Unpacked = append(report.Unpacked, j)
+				if j > i {
+					report.Decisions = append(report.Decisions, PackDecision{
+						TxIndex:  j,
+						Chunk:    len(report.Chunks),
+						Deferred: true,
+						Reason:   fmt.Sprintf("preceding tx %d can't be packed", i),
+						Gas:      results[j].Gas,
+						Rows:     txRows(results[j]),
+					})
+				}
+			}
+			break
+		}
+
+		// Close the current chunk and retry the tx in a fresh one.
+		report.Chunks = append(report.Chunks, chunk)
+		chunk, chunkGas, chunkRows = nil, 0, 0
+		i--
+	}
+	if len(chunk) > 0 {
+		report.Chunks = append(report.Chunks, chunk)
+	}
+
+	return report
+}
+
+func exceededLimit(limits PackLimits, gas, rows uint64) string {
+	if limits.MaxGas != 0 && gas > limits.MaxGas {
+		return fmt.Sprintf("gas limit reached: %d > %d", gas, limits.MaxGas)
+	}
+	if limits.MaxRows != 0 && rows > limits.MaxRows {
+		return fmt.Sprintf("row limit reached: %d > %d", rows, limits.MaxRows)
+	}
+	return ""
+}
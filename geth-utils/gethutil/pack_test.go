@@ -0,0 +1,85 @@
+package gethutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+// tracedTx returns the result of a traced tx which used gas in steps steps.
+func tracedTx(gas uint64, steps int) *ExecutionResult {
+	return &ExecutionResult{Gas: gas, Steps: steps}
+}
+
+func TestPackChunksExactFit(t *testing.T) {
+	results := []*ExecutionResult{tracedTx(40, 3), tracedTx(60, 2), tracedTx(1, 1)}
+	report := PackChunks(results, PackLimits{MaxGas: 100, MaxRows: 5})
+
+	if want := [][]int{{0, 1}, {2}}; !reflect.DeepEqual(report.Chunks, want) {
+		t.Fatalf("chunks: got %v, want %v", report.Chunks, want)
+	}
+	if len(report.Unpacked) != 0 {
+		t.Fatalf("unpacked: got %v, want none", report.Unpacked)
+	}
+	// The tx filling the chunk to its limits is packed, and the next one is
+	// deferred to a new chunk.
+	if len(report.Decisions) != 4 {
+		t.Fatalf("decisions: got %d, want 4", len(report.Decisions))
+	}
+	if decision := report.Decisions[1]; decision.Deferred || decision.ChunkGas != 40 || decision.ChunkRows != 3 {
+		t.Fatalf("decision of tx 1: got %+v, want packed", decision)
+	}
+	if decision := report.Decisions[2]; !decision.Deferred || decision.Reason != "gas limit reached: 101 > 100" {
+		t.Fatalf("decision of tx 2: got %+v, want deferred", decision)
+	}
+}
+
+func TestPackChunksTxAboveLimit(t *testing.T) {
+	results := []*ExecutionResult{tracedTx(10, 1), tracedTx(10, 6), tracedTx(10, 1)}
+	report := PackChunks(results, PackLimits{MaxRows: 5})
+
+	if want := [][]int{{0}}; !reflect.DeepEqual(report.Chunks, want) {
+		t.Fatalf("chunks: got %v, want %v", report.Chunks, want)
+	}
+	// The tx above the limit can't be packed even in an empty chunk, nor
+	// can the txs after it, which depend on its state.
+	if want := []int{1, 2}; !reflect.DeepEqual(report.Unpacked, want) {
+		t.Fatalf("unpacked: got %v, want %v", report.Unpacked, want)
+	}
+	last := report.Decisions[len(report.Decisions)-1]
+	if last.TxIndex != 2 || !last.Deferred || last.Reason != "preceding tx 1 can't be packed" {
+		t.Fatalf("decision of tx 2: got %+v", last)
+	}
+}
+
+func TestPackChunksSingleTxAboveLimit(t *testing.T) {
+	report := PackChunks([]*ExecutionResult{tracedTx(200, 1)}, PackLimits{MaxGas: 100})
+
+	if len(report.Chunks) != 0 {
+		t.Fatalf("chunks: got %v, want none", report.Chunks)
+	}
+	if want := []int{0}; !reflect.DeepEqual(report.Unpacked, want) {
+		t.Fatalf("unpacked: got %v, want %v", report.Unpacked, want)
+	}
+	if want := "gas limit reached: 200 > 100"; report.Decisions[0].Reason != want {
+		t.Fatalf("reason: got %q, want %q", report.Decisions[0].Reason, want)
+	}
+}
+
+// TestPackChunksUncapturedSteps checks that the txs are accounted for their
+// executed steps, including the ones past TracerOptions.MaxSteps.
+func TestPackChunksUncapturedSteps(t *testing.T) {
+	config := loopConfig()
+	config.TracerOptions.MaxSteps = 1
+	results, err := Trace(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := PackChunks(results, PackLimits{MaxRows: 130001})
+
+	if want := []int{0}; !reflect.DeepEqual(report.Unpacked, want) {
+		t.Fatalf("unpacked: got %v, want %v", report.Unpacked, want)
+	}
+	if decision := report.Decisions[0]; decision.Rows != 130002 {
+		t.Fatalf("rows: got %d, want 130002", decision.Rows)
+	}
+}
@@ -0,0 +1,402 @@
+package gethutil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// OutputParity is the TraceConfig.Output of the results shaped like the
+// replays of trace_replayTransaction of OpenEthereum with the vmTrace, trace
+// and stateDiff trace types, see FormatParityTraces.
+const OutputParity = "parity"
+
+// ParityTraceResult is the replay of a transaction by OpenEthereum.
+type ParityTraceResult struct {
+	Output    hexutil.Bytes                         `json:"output"`
+	StateDiff map[common.Address]*ParityAccountDiff `json:"stateDiff"`
+	Trace     []ParityTrace                         `json:"trace"`
+	VMTrace   *ParityVMTrace                        `json:"vmTrace"`
+}
+
+// ParityTrace is a call frame, flattened by its traceAddress, which is the
+// path of the indexes of the subtraces leading to it.
+type ParityTrace struct {
+	Action       ParityAction        `json:"action"`
+	Result       *ParityActionResult `json:"result,omitempty"`
+	Error        string              `json:"error,omitempty"`
+	Subtraces    int                 `json:"subtraces"`
+	TraceAddress []int               `json:"traceAddress"`
+	Type         string              `json:"type"`
+}
+
+// ParityAction is the action of a call, create or suicide trace, with the
+// fields of its type.
+type ParityAction struct {
+	CallType      string          `json:"callType,omitempty"`
+	From          *common.Address `json:"from,omitempty"`
+	To            *common.Address `json:"to,omitempty"`
+	Gas           *hexutil.Uint64 `json:"gas,omitempty"`
+	Input         *hexutil.Bytes  `json:"input,omitempty"`
+	Init          *hexutil.Bytes  `json:"init,omitempty"`
+	Value         *hexutil.Big    `json:"value,omitempty"`
+	Address       *common.Address `json:"address,omitempty"`
+	RefundAddress *common.Address `json:"refundAddress,omitempty"`
+	Balance       *hexutil.Big    `json:"balance,omitempty"`
+}
+
+// ParityActionResult is the result of a successful call or create trace.
+type ParityActionResult struct {
+	Address *common.Address `json:"address,omitempty"`
+	Code    *hexutil.Bytes  `json:"code,omitempty"`
+	GasUsed hexutil.Uint64  `json:"gasUsed"`
+	Output  *hexutil.Bytes  `json:"output,omitempty"`
+}
+
+// ParityVMTrace is the trace of the operations of a call frame, with the
+// traces of the frames they enter as their subs.
+type ParityVMTrace struct {
+	Code hexutil.Bytes       `json:"code"`
+	Ops  []ParityVMOperation `json:"ops"`
+}
+
+// ParityVMOperation is an operation of a ParityVMTrace, whose Ex is nil if it
+// failed.
+type ParityVMOperation struct {
+	Cost uint64            `json:"cost"`
+	Ex   *ParityVMExecuted `json:"ex"`
+	Pc   uint64            `json:"pc"`
+	Sub  *ParityVMTrace    `json:"sub"`
+	Op   string            `json:"op"`
+}
+
+// ParityVMExecuted is the outcome of an operation: the gas left, the items it
+// pushed onto the stack, and its writes to the memory and the storage.
+type ParityVMExecuted struct {
+	Mem   *ParityMemoryDiff  `json:"mem"`
+	Push  []string           `json:"push"`
+	Store *ParityStorageDiff `json:"store"`
+	Used  uint64             `json:"used"`
+}
+
+// ParityMemoryDiff is the memory written by an operation at Off.
+type ParityMemoryDiff struct {
+	Off  uint64        `json:"off"`
+	Data hexutil.Bytes `json:"data"`
+}
+
+// ParityStorageDiff is the slot written by an SSTORE operation.
+type ParityStorageDiff struct {
+	Key string `json:"key"`
+	Val string `json:"val"`
+}
+
+// ParityAccountDiff is the change of an account in a stateDiff.
+type ParityAccountDiff struct {
+	Balance ParityDiff                 `json:"balance"`
+	Code    ParityDiff                 `json:"code"`
+	Nonce   ParityDiff                 `json:"nonce"`
+	Storage map[common.Hash]ParityDiff `json:"storage"`
+}
+
+// ParityDiff is the change of a value, which is "=" if unchanged, {"+": to}
+// if born, {"-": from} if died, or {"*": {"from": from, "to": to}}.
+type ParityDiff struct {
+	Kind string
+	From interface{}
+	To   interface{}
+}
+
+// MarshalJSON marshals d like OpenEthereum.
+func (d ParityDiff) MarshalJSON() ([]byte, error) {
+	switch d.Kind {
+	case "+":
+		return json.Marshal(map[string]interface{}{"+": d.To})
+	case "-":
+		return json.Marshal(map[string]interface{}{"-": d.From})
+	case "*":
+		return json.Marshal(map[string]interface{}{"*": map[string]interface{}{"from": d.From, "to": d.To}})
+	default:
+		return json.Marshal("=")
+	}
+}
+
+// newParityDiff returns the change from from to to, either of which is nil
+// if the value doesn't exist, and which are equal if same is set.
+func newParityDiff(from, to interface{}, same bool) ParityDiff {
+	switch {
+	case from == nil:
+		return ParityDiff{Kind: "+", To: to}
+	case to == nil:
+		return ParityDiff{Kind: "-", From: from}
+	case same:
+		return ParityDiff{Kind: "="}
+	default:
+		return ParityDiff{Kind: "*", From: from, To: to}
+	}
+}
+
+// FormatParityTraces formats results like the replays of
+// trace_replayTransaction of OpenEthereum. The push, mem and store of the
+// operations are empty unless the stack and the memory were captured, and
+// the vmTrace only has the captured steps.
+func FormatParityTraces(results []*ExecutionResult) []*ParityTraceResult {
+	traces := make([]*ParityTraceResult, len(results))
+	for i, result := range results {
+		output, _ := hex.DecodeString(result.ReturnValue)
+		traces[i] = &ParityTraceResult{
+			Output:    output,
+			StateDiff: FormatParityStateDiff(result.StateDiff),
+			Trace:     FormatParityCallTraces(result.Calls),
+			VMTrace:   FormatParityVMTrace(result),
+		}
+	}
+	return traces
+}
+
+// FormatParityCallTraces formats calls as the flattened traces of
+// OpenEthereum.
+func FormatParityCallTraces(calls []CallRes) []ParityTrace {
+	traces := make([]ParityTrace, len(calls))
+	for i := range calls {
+		call := &calls[i]
+		trace := &traces[i]
+		// The call IDs are the indexes in calls plus one, and callers are
+		// entered before their subcalls.
+		if call.CallerID > 0 {
+			caller := &traces[call.CallerID-1]
+			trace.TraceAddress = append(append([]int{}, caller.TraceAddress...), caller.Subtraces)
+			caller.Subtraces++
+		} else {
+			trace.TraceAddress = []int{}
+		}
+
+		from, to := call.From, call.To
+		gas := call.Gas
+		input := call.Input
+		value := call.Value
+		if value == nil {
+			value = (*hexutil.Big)(new(big.Int))
+		}
+		switch call.Type {
+		case vm.CREATE.String(), vm.CREATE2.String():
+			trace.Type = "create"
+			trace.Action = ParityAction{From: &from, Gas: &gas, Init: &input, Value: value}
+			if call.Error == "" {
+				code := call.Output
+				trace.Result = &ParityActionResult{Address: call.CreatedAddress, Code: &code, GasUsed: call.GasUsed}
+			}
+		case vm.SELFDESTRUCT.String():
+			trace.Type = "suicide"
+			trace.Action = ParityAction{Address: &from, RefundAddress: &to, Balance: value}
+		default:
+			trace.Type = "call"
+			trace.Action = ParityAction{CallType: strings.ToLower(call.Type), From: &from, To: &to, Gas: &gas, Input: &input, Value: value}
+			if call.Error == "" {
+				output := call.Output
+				trace.Result = &ParityActionResult{GasUsed: call.GasUsed, Output: &output}
+			}
+		}
+		trace.Error = parityError(call.Error)
+	}
+	return traces
+}
+
+// parityError returns the OpenEthereum message of the error message err of
+// a call frame.
+func parityError(err string) string {
+	switch err {
+	case vm.ErrExecutionReverted.Error():
+		return "Reverted"
+	case vm.ErrOutOfGas.Error():
+		return "Out of gas"
+	default:
+		return err
+	}
+}
+
+// FormatParityVMTrace formats the steps of result as the vmTrace of
+// OpenEthereum.
+func FormatParityVMTrace(result *ExecutionResult) *ParityVMTrace {
+	if result.StructLogs.Len() == 0 {
+		var code hexutil.Bytes
+		if len(result.Calls) > 0 && result.Calls[0].CodeHash != nil {
+			code = result.Bytecodes[*result.Calls[0].CodeHash]
+		}
+		return &ParityVMTrace{Code: code, Ops: []ParityVMOperation{}}
+	}
+	trace, _ := parityVMTrace(result, 0)
+	return trace
+}
+
+// parityVMTrace returns the trace of the call frame whose first step is the
+// start-th step of result, and the index of the step after its last step.
+func parityVMTrace(result *ExecutionResult, start int) (*ParityVMTrace, int) {
+	logs := result.StructLogs.Formatted()
+	depth := logs[start].Depth
+	trace := &ParityVMTrace{Ops: []ParityVMOperation{}}
+	if id := logs[start].CallID; id > 0 && id <= len(result.Calls) && result.Calls[id-1].CodeHash != nil {
+		trace.Code = result.Bytecodes[*result.Calls[id-1].CodeHash]
+	}
+
+	i := start
+	for i < len(logs) && logs[i].Depth == depth {
+		step := &logs[i]
+		op := vm.StringToOp(step.Op)
+		operation := ParityVMOperation{Cost: step.GasCost, Pc: step.Pc, Op: step.Op}
+		next := i + 1
+		if next < len(logs) && logs[next].Depth > depth {
+			operation.Sub, next = parityVMTrace(result, next)
+		} else if isCallOp(op) && step.Error == "" {
+			// The call entered no frame with steps, e.g. of a precompile.
+			operation.Sub = &ParityVMTrace{Code: hexutil.Bytes{}, Ops: []ParityVMOperation{}}
+		}
+		if step.Error == "" {
+			var after *StructLogRes
+			if next < len(logs) && logs[next].Depth == depth {
+				after = &logs[next]
+			}
+			operation.Ex = parityExecuted(op, step, after)
+		}
+		trace.Ops = append(trace.Ops, operation)
+		i = next
+	}
+	return trace, i
+}
+
+// isCallOp returns whether op enters a call frame.
+func isCallOp(op vm.OpCode) bool {
+	switch op {
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL, vm.CREATE, vm.CREATE2:
+		return true
+	default:
+		return false
+	}
+}
+
+// parityExecuted returns the outcome of step of op, whose next step in the
+// same call frame is after, or nil if it is the last step of the frame.
+func parityExecuted(op vm.OpCode, step, after *StructLogRes) *ParityVMExecuted {
+	executed := &ParityVMExecuted{Push: []string{}}
+	if after != nil {
+		executed.Used = after.Gas
+	} else if step.Gas > step.GasCost {
+		executed.Used = step.Gas - step.GasCost
+	}
+
+	if _, pushes := opStackIO(op); after != nil && after.Stack != nil && pushes > 0 && len(*after.Stack) >= pushes {
+		stack := *after.Stack
+		executed.Push = append(executed.Push, stack[len(stack)-pushes:]...)
+	}
+	if step.Stack == nil {
+		return executed
+	}
+	stack := *step.Stack
+	if op == vm.SSTORE && len(stack) >= 2 {
+		executed.Store = &ParityStorageDiff{Key: stack[len(stack)-1], Val: stack[len(stack)-2]}
+	}
+	if after != nil && after.Memory != nil {
+		if offset, size, ok := memoryWrite(op, stack); ok && size > 0 {
+			memory, _ := hex.DecodeString(strings.Join(*after.Memory, ""))
+			end := offset + size
+			if offset > uint64(len(memory)) {
+				offset = uint64(len(memory))
+			}
+			if end > uint64(len(memory)) || end < offset {
+				end = uint64(len(memory))
+			}
+			executed.Mem = &ParityMemoryDiff{Off: offset, Data: common.CopyBytes(memory[offset:end])}
+		}
+	}
+	return executed
+}
+
+// memoryWrite returns the offset and the size of the memory written by op
+// with stack, whose items are hex quantities, and whether op writes memory.
+func memoryWrite(op vm.OpCode, stack []string) (uint64, uint64, bool) {
+	var offsetIndex, sizeIndex int
+	var size uint64
+	switch op {
+	case vm.MSTORE:
+		offsetIndex, sizeIndex, size = 0, -1, 32
+	case vm.MSTORE8:
+		offsetIndex, sizeIndex, size = 0, -1, 1
+	case vm.CALLDATACOPY, vm.CODECOPY, vm.RETURNDATACOPY:
+		offsetIndex, sizeIndex = 0, 2
+	case vm.EXTCODECOPY:
+		offsetIndex, sizeIndex = 1, 3
+	case vm.CALL, vm.CALLCODE:
+		offsetIndex, sizeIndex = 5, 6
+	case vm.DELEGATECALL, vm.STATICCALL:
+		offsetIndex, sizeIndex = 4, 5
+	default:
+		return 0, 0, false
+	}
+	offset, ok := stackUint64(stack, offsetIndex)
+	if !ok {
+		return 0, 0, false
+	}
+	if sizeIndex >= 0 {
+		if size, ok = stackUint64(stack, sizeIndex); !ok {
+			return 0, 0, false
+		}
+	}
+	return offset, size, true
+}
+
+// stackUint64 returns the n-th item from the top of stack, and whether it
+// exists and fits in a uint64.
+func stackUint64(stack []string, n int) (uint64, bool) {
+	if n >= len(stack) {
+		return 0, false
+	}
+	value, err := hexutil.DecodeBig(stack[len(stack)-1-n])
+	if err != nil || !value.IsUint64() {
+		return 0, false
+	}
+	return value.Uint64(), true
+}
+
+// FormatParityStateDiff formats diff as the stateDiff of OpenEthereum.
+func FormatParityStateDiff(diff map[common.Address]*AccountDiffRes) map[common.Address]*ParityAccountDiff {
+	formatted := make(map[common.Address]*ParityAccountDiff, len(diff))
+	for address, accountDiff := range diff {
+		pre, post := accountDiff.Pre, accountDiff.Post
+		var preBalance, postBalance, preNonce, postNonce, preCode, postCode interface{}
+		if pre != nil {
+			preBalance, preNonce, preCode = pre.Balance, pre.Nonce, pre.Code
+		}
+		if post != nil {
+			postBalance, postNonce, postCode = post.Balance, post.Nonce, post.Code
+		}
+		same := pre != nil && post != nil
+		parityDiff := &ParityAccountDiff{
+			Balance: newParityDiff(preBalance, postBalance, same && pre.Balance.ToInt().Cmp(post.Balance.ToInt()) == 0),
+			Code:    newParityDiff(preCode, postCode, same && bytes.Equal(pre.Code, post.Code)),
+			Nonce:   newParityDiff(preNonce, postNonce, same && pre.Nonce == post.Nonce),
+			Storage: make(map[common.Hash]ParityDiff),
+		}
+		switch {
+		case pre == nil && post != nil:
+			for key, value := range post.Storage {
+				parityDiff.Storage[key] = newParityDiff(nil, value, false)
+			}
+		case pre != nil && post == nil:
+			for key, value := range pre.Storage {
+				parityDiff.Storage[key] = newParityDiff(value, nil, false)
+			}
+		case pre != nil && post != nil:
+			for key, value := range post.Storage {
+				parityDiff.Storage[key] = newParityDiff(pre.Storage[key], value, false)
+			}
+		}
+		formatted[address] = parityDiff
+	}
+	return formatted
+}
@@ -0,0 +1,85 @@
+package gethutil
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// watchPreimages starts recording the preimages of the keys of the tries
+// accessed, see takePreimages.
+func (s *StateDB) watchPreimages() {
+	s.preimages = make(map[common.Hash]hexutil.Bytes)
+}
+
+// recordAccountPreimage records the preimage of the key of address in the
+// account trie.
+func (s *StateDB) recordAccountPreimage(address common.Address) {
+	if s.preimages != nil {
+		s.preimages[crypto.Keccak256Hash(address[:])] = common.CopyBytes(address[:])
+	}
+}
+
+// recordSlotPreimage records the preimages of the key of address in the
+// account trie and of key in its storage trie.
+func (s *StateDB) recordSlotPreimage(address common.Address, key common.Hash) {
+	if s.preimages != nil {
+		s.recordAccountPreimage(address)
+		s.preimages[crypto.Keccak256Hash(key[:])] = common.CopyBytes(key[:])
+	}
+}
+
+// takePreimages returns the preimages recorded since watchPreimages by hash,
+// and stops recording.
+func (s *StateDB) takePreimages() map[common.Hash]hexutil.Bytes {
+	preimages := s.preimages
+	s.preimages = nil
+	return preimages
+}
+
+// GetBalance returns the balance of address, recording its preimage.
+func (s *StateDB) GetBalance(address common.Address) *big.Int {
+	s.recordAccountPreimage(address)
+	return s.StateDB.GetBalance(address)
+}
+
+// GetNonce returns the nonce of address, recording its preimage.
+func (s *StateDB) GetNonce(address common.Address) uint64 {
+	s.recordAccountPreimage(address)
+	return s.StateDB.GetNonce(address)
+}
+
+// GetCodeSize returns the size of the code of address, recording its
+// preimage.
+func (s *StateDB) GetCodeSize(address common.Address) int {
+	s.recordAccountPreimage(address)
+	return s.StateDB.GetCodeSize(address)
+}
+
+// Exist returns whether address exists, recording its preimage.
+func (s *StateDB) Exist(address common.Address) bool {
+	s.recordAccountPreimage(address)
+	return s.StateDB.Exist(address)
+}
+
+// Empty returns whether address is empty, recording its preimage.
+func (s *StateDB) Empty(address common.Address) bool {
+	s.recordAccountPreimage(address)
+	return s.StateDB.Empty(address)
+}
+
+// GetState returns the value of the slot key of address, recording their
+// preimages.
+func (s *StateDB) GetState(address common.Address, key common.Hash) common.Hash {
+	s.recordSlotPreimage(address, key)
+	return s.StateDB.GetState(address, key)
+}
+
+// GetCommittedState returns the value of the slot key of address before
+// the transaction, recording their preimages.
+func (s *StateDB) GetCommittedState(address common.Address, key common.Hash) common.Hash {
+	s.recordSlotPreimage(address, key)
+	return s.StateDB.GetCommittedState(address, key)
+}
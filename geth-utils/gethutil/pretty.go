@@ -0,0 +1,109 @@
+package gethutil
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// PrettyPrint writes result as a call tree indented by depth, with a line
+// per step holding its opcode, the operand of PUSHn, the gas remaining and
+// the cost, and the top stackItems elements of the stack (all of them if
+// stackItems < 0). The addresses with a label in result.Labels are printed
+// as their label.
+func PrettyPrint(w io.Writer, result *ExecutionResult, stackItems int) error {
+	return PrettyPrintWithLabels(w, result, stackItems, nil)
+}
+
+// PrettyPrintWithLabels is PrettyPrint with the labels of labels, which take
+// precedence over the ones of result.Labels.
+func PrettyPrintWithLabels(w io.Writer, result *ExecutionResult, stackItems int, labels map[common.Address]string) error {
+	calls := make(map[int]*CallRes, len(result.Calls))
+	for i := range result.Calls {
+		calls[result.Calls[i].CallID] = &result.Calls[i]
+	}
+
+	label := func(address common.Address) string {
+		if name, ok := labels[address]; ok {
+			return name
+		}
+		if name, ok := result.Labels[address]; ok {
+			return name
+		}
+		return address.Hex()
+	}
+
+	p := &prettyPrinter{w: w}
+	logs := result.StructLogs.Formatted()
+	for i := range logs {
+		step := &logs[i]
+		indent := ""
+		if step.Depth > 1 {
+			indent = strings.Repeat("  ", step.Depth-1)
+		}
+		// Print the frame entered by the first step of a call frame.
+		if i == 0 || step.Depth > logs[i-1].Depth {
+			if call, ok := calls[step.CallID]; ok {
+				p.printf("%s> %s %s -> %s gas=%d (call %d)\n", indent, call.Type, label(call.From), label(call.To), uint64(call.Gas), call.CallID)
+			}
+		}
+
+		p.printf("%s%6d pc=%-5d %-14s", indent, i, step.Pc, step.Op)
+		if strings.HasPrefix(step.Op, "PUSH") && i+1 < len(logs) {
+			// The operand is the top of the stack after the step.
+			next := &logs[i+1]
+			if next.Depth == step.Depth && next.Stack != nil && len(*next.Stack) > 0 {
+				p.printf(" %-18s", (*next.Stack)[len(*next.Stack)-1])
+			}
+		}
+		p.printf(" gas=%d cost=%d", step.Gas, step.GasCost)
+		if step.Stack != nil {
+			p.printf(" stack=[%s]", formatStackTop(*step.Stack, stackItems))
+		}
+		if step.Error != "" {
+			p.printf(" error=%q", step.Error)
+		}
+		p.printf("\n")
+	}
+
+	p.printf("gas used %d, failed %t", result.Gas, result.Failed)
+	if result.RevertReason != "" {
+		p.printf(", revert reason %q", result.RevertReason)
+	}
+	if result.ReturnValue != "" {
+		p.printf(", return value 0x%s", result.ReturnValue)
+	}
+	p.printf("\n")
+	return p.err
+}
+
+// formatStackTop formats the top n elements of stack from the top, with the
+// number of omitted elements.
+func formatStackTop(stack []string, n int) string {
+	if n < 0 || n > len(stack) {
+		n = len(stack)
+	}
+	top := make([]string, 0, n+1)
+	for i := len(stack) - 1; i >= len(stack)-n; i-- {
+		top = append(top, stack[i])
+	}
+	if omitted := len(stack) - n; omitted > 0 {
+		top = append(top, fmt.Sprintf("... %d more", omitted))
+	}
+	return strings.Join(top, ", ")
+}
+
+// prettyPrinter keeps the first write error, so the printing doesn't have to
+// check every write.
+type prettyPrinter struct {
+	w   io.Writer
+	err error
+}
+
+func (p *prettyPrinter) printf(format string, args ...interface{}) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, args...)
+	}
+}
@@ -0,0 +1,77 @@
+package gethutil
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"unicode/utf8"
+)
+
+var (
+	// Selector of Error(string)
+	errorSelector = []byte{0x08, 0xc3, 0x79, 0xa0}
+	// Selector of Panic(uint256)
+	panicSelector = []byte{0x4e, 0x48, 0x7b, 0x71}
+)
+
+// panicReasons are the reasons of the panic codes defined by solidity.
+var panicReasons = map[uint64]string{
+	0x00: "generic panic",
+	0x01: "assert(false)",
+	0x11: "arithmetic underflow or overflow",
+	0x12: "division or modulo by zero",
+	0x21: "enum overflow",
+	0x22: "invalid encoded storage byte array accessed",
+	0x31: "out-of-bounds array access; popping on an empty array",
+	0x32: "out-of-bounds access of an array or bytesN",
+	0x41: "out of memory",
+	0x51: "uninitialized function",
+}
+
+// DecodeRevertReason returns the human-readable reason of revert data
+// ABI-encoded as Error(string) or Panic(uint256), or false if the data is
+// neither.
+func DecodeRevertReason(data []byte) (string, bool) {
+	if len(data) < 4+32 {
+		return "", false
+	}
+	selector, args := data[:4], data[4:]
+	switch {
+	case bytes.Equal(selector, errorSelector):
+		offset, ok := abiUint(args, 0)
+		if !ok || offset > uint64(len(args)) {
+			return "", false
+		}
+		length, ok := abiUint(args, offset)
+		if !ok || offset+32+length > uint64(len(args)) {
+			return "", false
+		}
+		reason := args[offset+32 : offset+32+length]
+		if !utf8.Valid(reason) {
+			return "", false
+		}
+		return string(reason), true
+	case bytes.Equal(selector, panicSelector):
+		code := new(big.Int).SetBytes(args[:32])
+		reason, ok := panicReasons[code.Uint64()]
+		if !code.IsUint64() || !ok {
+			reason = "unknown panic code"
+		}
+		return fmt.Sprintf("panic: 0x%x (%s)", code, reason), true
+	default:
+		return "", false
+	}
+}
+
+// abiUint returns the ABI-encoded word at offset of data as a uint64, or
+// false if it's out of bounds or doesn't fit in a uint64.
+func abiUint(data []byte, offset uint64) (uint64, bool) {
+	if offset+32 < offset || offset+32 > uint64(len(data)) {
+		return 0, false
+	}
+	word := new(big.Int).SetBytes(data[offset : offset+32])
+	if !word.IsUint64() {
+		return 0, false
+	}
+	return word.Uint64(), true
+}
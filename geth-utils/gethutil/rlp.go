@@ -0,0 +1,385 @@
+package gethutil
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// The types of the transactions which the go-ethereum in use predates.
+const (
+	blobTxType    = 0x03
+	setCodeTxType = 0x04
+	depositTxType = 0x7e
+)
+
+// encodedTxType returns the type tx is encoded as, which is tx.Type if set,
+// or else inferred from its fields.
+func encodedTxType(tx Transaction) uint8 {
+	switch {
+	case tx.Type != nil:
+		return uint8(*tx.Type)
+	case tx.Deposit:
+		return depositTxType
+	case len(tx.AuthorizationList) > 0:
+		return setCodeTxType
+	case len(tx.BlobHashes) > 0:
+		return blobTxType
+	default:
+		return txType(tx)
+	}
+}
+
+// The RLP encodings of the transactions by type, whose signature is
+// optional so that their signing payload is their encoding without it.
+type (
+	legacyTxRLP struct {
+		Nonce    uint64
+		GasPrice *big.Int
+		Gas      uint64
+		To       *common.Address `rlp:"nil"`
+		Value    *big.Int
+		Data     []byte
+		V        *big.Int `rlp:"optional"`
+		R        *big.Int `rlp:"optional"`
+		S        *big.Int `rlp:"optional"`
+	}
+	accessListTxRLP struct {
+		ChainID    *big.Int
+		Nonce      uint64
+		GasPrice   *big.Int
+		Gas        uint64
+		To         *common.Address `rlp:"nil"`
+		Value      *big.Int
+		Data       []byte
+		AccessList types.AccessList
+		V          *big.Int `rlp:"optional"`
+		R          *big.Int `rlp:"optional"`
+		S          *big.Int `rlp:"optional"`
+	}
+	dynamicFeeTxRLP struct {
+		ChainID    *big.Int
+		Nonce      uint64
+		GasTipCap  *big.Int
+		GasFeeCap  *big.Int
+		Gas        uint64
+		To         *common.Address `rlp:"nil"`
+		Value      *big.Int
+		Data       []byte
+		AccessList types.AccessList
+		V          *big.Int `rlp:"optional"`
+		R          *big.Int `rlp:"optional"`
+		S          *big.Int `rlp:"optional"`
+	}
+	blobTxRLP struct {
+		ChainID    *big.Int
+		Nonce      uint64
+		GasTipCap  *big.Int
+		GasFeeCap  *big.Int
+		Gas        uint64
+		To         common.Address
+		Value      *big.Int
+		Data       []byte
+		AccessList types.AccessList
+		BlobFeeCap *big.Int
+		BlobHashes []common.Hash
+		V          *big.Int `rlp:"optional"`
+		R          *big.Int `rlp:"optional"`
+		S          *big.Int `rlp:"optional"`
+	}
+	setCodeTxRLP struct {
+		ChainID           *big.Int
+		Nonce             uint64
+		GasTipCap         *big.Int
+		GasFeeCap         *big.Int
+		Gas               uint64
+		To                common.Address
+		Value             *big.Int
+		Data              []byte
+		AccessList        types.AccessList
+		AuthorizationList []authorizationRLP
+		V                 *big.Int `rlp:"optional"`
+		R                 *big.Int `rlp:"optional"`
+		S                 *big.Int `rlp:"optional"`
+	}
+	authorizationRLP struct {
+		ChainID *big.Int
+		Address common.Address
+		Nonce   uint64
+		YParity uint64
+		R       *big.Int
+		S       *big.Int
+	}
+	// depositTxRLP is the encoding of the deposit transactions of Optimism
+	// Bedrock, which aren't signed.
+	depositTxRLP struct {
+		SourceHash common.Hash
+		From       common.Address
+		To         *common.Address `rlp:"nil"`
+		Mint       *big.Int
+		Value      *big.Int
+		Gas        uint64
+		IsSystemTx bool
+		Data       []byte
+	}
+)
+
+// accessList returns the access list of tx.
+func (tx *Transaction) accessList() types.AccessList {
+	accessList := make(types.AccessList, len(tx.AccessList))
+	for i, tuple := range tx.AccessList {
+		accessList[i] = types.AccessTuple{Address: tuple.Address, StorageKeys: tuple.StorageKeys}
+	}
+	return accessList
+}
+
+// rlpFields returns the RLP encoding of the fields of tx, of type txType,
+// with its signature if withSignature is set. A nil nonce is 0, and so is a
+// nil signature.
+func (tx *Transaction) rlpFields(txType uint8, chainID *big.Int, withSignature bool) (interface{}, error) {
+	var nonce uint64
+	if tx.Nonce != nil {
+		nonce = uint64(*tx.Nonce)
+	}
+	var v, r, s *big.Int
+	if withSignature {
+		v, r, s = toBigInt(tx.V), toBigInt(tx.R), toBigInt(tx.S)
+	}
+	requireTo := func() (common.Address, error) {
+		if tx.To == nil {
+			return common.Address{}, fmt.Errorf("transaction of type %d can't create a contract", txType)
+		}
+		return *tx.To, nil
+	}
+
+	switch txType {
+	case types.LegacyTxType:
+		fields := &legacyTxRLP{
+			Nonce: nonce, GasPrice: toBigInt(tx.GasPrice), Gas: uint64(tx.GasLimit), To: tx.To,
+			Value: toBigInt(tx.Value), Data: tx.CallData, V: v, R: r, S: s,
+		}
+		// The signing payload of EIP-155 ends with the chain ID.
+		if !withSignature && chainID != nil && chainID.Sign() != 0 {
+			fields.V, fields.R, fields.S = chainID, new(big.Int), new(big.Int)
+		}
+		return fields, nil
+	case types.AccessListTxType:
+		return &accessListTxRLP{
+			ChainID: chainID, Nonce: nonce, GasPrice: toBigInt(tx.GasPrice), Gas: uint64(tx.GasLimit), To: tx.To,
+			Value: toBigInt(tx.Value), Data: tx.CallData, AccessList: tx.accessList(), V: v, R: r, S: s,
+		}, nil
+	case types.DynamicFeeTxType:
+		return &dynamicFeeTxRLP{
+			ChainID: chainID, Nonce: nonce, GasTipCap: toBigInt(tx.GasTipCap), GasFeeCap: toBigInt(tx.GasFeeCap),
+			Gas: uint64(tx.GasLimit), To: tx.To, Value: toBigInt(tx.Value), Data: tx.CallData,
+			AccessList: tx.accessList(), V: v, R: r, S: s,
+		}, nil
+	case blobTxType:
+		to, err := requireTo()
+		if err != nil {
+			return nil, err
+		}
+		return &blobTxRLP{
+			ChainID: chainID, Nonce: nonce, GasTipCap: toBigInt(tx.GasTipCap), GasFeeCap: toBigInt(tx.GasFeeCap),
+			Gas: uint64(tx.GasLimit), To: to, Value: toBigInt(tx.Value), Data: tx.CallData,
+			AccessList: tx.accessList(), BlobFeeCap: toBigInt(tx.BlobFeeCap), BlobHashes: tx.BlobHashes,
+			V: v, R: r, S: s,
+		}, nil
+	case setCodeTxType:
+		to, err := requireTo()
+		if err != nil {
+			return nil, err
+		}
+		authorizations := make([]authorizationRLP, len(tx.AuthorizationList))
+		for i, a := range tx.AuthorizationList {
+			authorizations[i] = authorizationRLP{
+				ChainID: toBigInt(a.ChainID), Address: a.Address, Nonce: uint64(a.Nonce),
+				YParity: uint64(a.YParity), R: toBigInt(a.R), S: toBigInt(a.S),
+			}
+		}
+		return &setCodeTxRLP{
+			ChainID: chainID, Nonce: nonce, GasTipCap: toBigInt(tx.GasTipCap), GasFeeCap: toBigInt(tx.GasFeeCap),
+			Gas: uint64(tx.GasLimit), To: to, Value: toBigInt(tx.Value), Data: tx.CallData,
+			AccessList: tx.accessList(), AuthorizationList: authorizations, V: v, R: r, S: s,
+		}, nil
+	case depositTxType:
+		if !withSignature {
+			return nil, errors.New("deposit transaction isn't signed")
+		}
+		return &depositTxRLP{
+			SourceHash: tx.SourceHash, From: tx.From, To: tx.To, Mint: toBigInt(tx.Mint),
+			Value: toBigInt(tx.Value), Gas: uint64(tx.GasLimit), Data: tx.CallData,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported transaction type %d", txType)
+	}
+}
+
+// EncodeTransaction returns the binary encoding of tx on the chain of
+// chainID, which is its RLP encoding prefixed with its type unless it is a
+// legacy transaction, with its signature, or a zero one if it has none, see
+// encodedTxType.
+func EncodeTransaction(tx Transaction, chainID *big.Int) ([]byte, error) {
+	txType := encodedTxType(tx)
+	fields, err := tx.rlpFields(txType, chainID, true)
+	if err != nil {
+		return nil, err
+	}
+	return encodeTyped(txType, fields)
+}
+
+// TransactionSigningHash returns the hash signed by the sender of tx on the
+// chain of chainID. The signing payload of a legacy transaction follows
+// EIP-155 unless chainID is nil or 0.
+func TransactionSigningHash(tx Transaction, chainID *big.Int) (common.Hash, error) {
+	txType := encodedTxType(tx)
+	fields, err := tx.rlpFields(txType, chainID, false)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	payload, err := encodeTyped(txType, fields)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(payload), nil
+}
+
+// encodeTyped returns the RLP encoding of fields prefixed with txType unless
+// it is the legacy one.
+func encodeTyped(txType uint8, fields interface{}) ([]byte, error) {
+	payload, err := rlp.EncodeToBytes(fields)
+	if err != nil {
+		return nil, err
+	}
+	if txType == types.LegacyTxType {
+		return payload, nil
+	}
+	return append([]byte{txType}, payload...), nil
+}
+
+// DecodeRawTransaction decodes the binary encoding of a transaction, and
+// returns it with its chain ID, which is nil for a legacy transaction
+// predating EIP-155. The sender of a signed transaction is recovered from
+// its signature.
+func DecodeRawTransaction(data []byte) (*Transaction, *big.Int, error) {
+	if len(data) == 0 {
+		return nil, nil, errors.New("empty transaction")
+	}
+	tx := new(Transaction)
+	var chainID *big.Int
+	var accessList types.AccessList
+	var nonce uint64
+	txType := uint8(types.LegacyTxType)
+	if data[0] < 0x80 {
+		txType, data = data[0], data[1:]
+	}
+	var err error
+	switch txType {
+	case types.LegacyTxType:
+		var fields legacyTxRLP
+		err = rlp.DecodeBytes(data, &fields)
+		nonce, tx.GasPrice, tx.GasLimit, tx.To = fields.Nonce, (*hexutil.Big)(fields.GasPrice), hexutil.Uint64(fields.Gas), fields.To
+		tx.Value, tx.CallData = (*hexutil.Big)(fields.Value), fields.Data
+		tx.V, tx.R, tx.S = (*hexutil.Big)(fields.V), (*hexutil.Big)(fields.R), (*hexutil.Big)(fields.S)
+		if v := fields.V; v != nil && v.Cmp(big.NewInt(35)) >= 0 {
+			// v is chain ID * 2 + 35 + y parity by EIP-155.
+			chainID = new(big.Int).Sub(v, big.NewInt(35))
+			chainID.Rsh(chainID, 1)
+		}
+	case types.AccessListTxType:
+		var fields accessListTxRLP
+		err = rlp.DecodeBytes(data, &fields)
+		chainID, nonce, tx.GasPrice, tx.GasLimit, tx.To = fields.ChainID, fields.Nonce, (*hexutil.Big)(fields.GasPrice), hexutil.Uint64(fields.Gas), fields.To
+		tx.Value, tx.CallData, accessList = (*hexutil.Big)(fields.Value), fields.Data, fields.AccessList
+		tx.V, tx.R, tx.S = (*hexutil.Big)(fields.V), (*hexutil.Big)(fields.R), (*hexutil.Big)(fields.S)
+	case types.DynamicFeeTxType:
+		var fields dynamicFeeTxRLP
+		err = rlp.DecodeBytes(data, &fields)
+		chainID, nonce, tx.GasLimit, tx.To = fields.ChainID, fields.Nonce, hexutil.Uint64(fields.Gas), fields.To
+		tx.GasTipCap, tx.GasFeeCap = (*hexutil.Big)(fields.GasTipCap), (*hexutil.Big)(fields.GasFeeCap)
+		tx.Value, tx.CallData, accessList = (*hexutil.Big)(fields.Value), fields.Data, fields.AccessList
+		tx.V, tx.R, tx.S = (*hexutil.Big)(fields.V), (*hexutil.Big)(fields.R), (*hexutil.Big)(fields.S)
+	case blobTxType:
+		var fields blobTxRLP
+		err = rlp.DecodeBytes(data, &fields)
+		chainID, nonce, tx.GasLimit, tx.To = fields.ChainID, fields.Nonce, hexutil.Uint64(fields.Gas), &fields.To
+		tx.GasTipCap, tx.GasFeeCap = (*hexutil.Big)(fields.GasTipCap), (*hexutil.Big)(fields.GasFeeCap)
+		tx.Value, tx.CallData, accessList = (*hexutil.Big)(fields.Value), fields.Data, fields.AccessList
+		tx.BlobFeeCap, tx.BlobHashes = (*hexutil.Big)(fields.BlobFeeCap), fields.BlobHashes
+		tx.V, tx.R, tx.S = (*hexutil.Big)(fields.V), (*hexutil.Big)(fields.R), (*hexutil.Big)(fields.S)
+	case setCodeTxType:
+		var fields setCodeTxRLP
+		err = rlp.DecodeBytes(data, &fields)
+		chainID, nonce, tx.GasLimit, tx.To = fields.ChainID, fields.Nonce, hexutil.Uint64(fields.Gas), &fields.To
+		tx.GasTipCap, tx.GasFeeCap = (*hexutil.Big)(fields.GasTipCap), (*hexutil.Big)(fields.GasFeeCap)
+		tx.Value, tx.CallData, accessList = (*hexutil.Big)(fields.Value), fields.Data, fields.AccessList
+		for _, a := range fields.AuthorizationList {
+			tx.AuthorizationList = append(tx.AuthorizationList, Authorization{
+				ChainID: (*hexutil.Big)(a.ChainID), Address: a.Address, Nonce: hexutil.Uint64(a.Nonce),
+				YParity: hexutil.Uint64(a.YParity), R: (*hexutil.Big)(a.R), S: (*hexutil.Big)(a.S),
+			})
+		}
+		tx.V, tx.R, tx.S = (*hexutil.Big)(fields.V), (*hexutil.Big)(fields.R), (*hexutil.Big)(fields.S)
+	case depositTxType:
+		var fields depositTxRLP
+		err = rlp.DecodeBytes(data, &fields)
+		tx.Deposit, tx.SourceHash, tx.From, tx.To = true, fields.SourceHash, fields.From, fields.To
+		tx.Mint, tx.Value, tx.GasLimit, tx.CallData = (*hexutil.Big)(fields.Mint), (*hexutil.Big)(fields.Value), hexutil.Uint64(fields.Gas), fields.Data
+	default:
+		return nil, nil, fmt.Errorf("unsupported transaction type %d", txType)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tx.Nonce = (*hexutil.Uint64)(&nonce)
+	typ := hexutil.Uint64(txType)
+	tx.Type = &typ
+	for _, tuple := range accessList {
+		tx.AccessList = append(tx.AccessList, struct {
+			Address     common.Address `json:"address"`
+			StorageKeys []common.Hash  `json:"storage_keys"`
+		}{tuple.Address, tuple.StorageKeys})
+	}
+	if txType != depositTxType && toBigInt(tx.R).Sign() != 0 {
+		if tx.From, err = tx.sender(chainID); err != nil {
+			return nil, nil, err
+		}
+	}
+	return tx, chainID, nil
+}
+
+// sender recovers the signer of tx on the chain of chainID from its
+// signature.
+func (tx *Transaction) sender(chainID *big.Int) (common.Address, error) {
+	yParity := toBigInt(tx.V)
+	if encodedTxType(*tx) == types.LegacyTxType {
+		if chainID != nil {
+			yParity = new(big.Int).Sub(yParity, new(big.Int).Add(new(big.Int).Lsh(chainID, 1), big.NewInt(35)))
+		} else {
+			yParity = new(big.Int).Sub(yParity, big.NewInt(27))
+		}
+	}
+	if !yParity.IsUint64() || yParity.Uint64() > 1 || !crypto.ValidateSignatureValues(byte(yParity.Uint64()), toBigInt(tx.R), toBigInt(tx.S), true) {
+		return common.Address{}, errors.New("invalid signature values")
+	}
+	hash, err := TransactionSigningHash(*tx, chainID)
+	if err != nil {
+		return common.Address{}, err
+	}
+	var sig [crypto.SignatureLength]byte
+	toBigInt(tx.R).FillBytes(sig[:32])
+	toBigInt(tx.S).FillBytes(sig[32:64])
+	sig[64] = byte(yParity.Uint64())
+	pub, err := crypto.SigToPub(hash[:], sig[:])
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
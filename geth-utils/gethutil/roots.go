@@ -0,0 +1,61 @@
+package gethutil
+
+import (
+	"bytes"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// encodeTx returns the binary encoding of the i-th transaction of config,
+// which is committed to by the transactions root of its block, with the
+// nonce of its message. An unsigned transaction is encoded with a zero
+// signature.
+func (env *traceEnv) encodeTx(config TraceConfig, i int) ([]byte, error) {
+	tx := config.Transactions[i]
+	nonce := hexutil.Uint64(env.messages[i].Nonce())
+	tx.Nonce = &nonce
+	return EncodeTransaction(tx, env.chainConfig.ChainID)
+}
+
+// encodedTxList is a list of binary encoded transactions whose root is
+// committed to by a header.
+type encodedTxList [][]byte
+
+func (l encodedTxList) Len() int { return len(l) }
+
+func (l encodedTxList) EncodeIndex(i int, w *bytes.Buffer) { w.Write(l[i]) }
+
+// receiptList is a list of receipts whose root is committed to by a header.
+// Unlike types.Receipts, it encodes the receipts of the transaction types
+// which the go-ethereum in use predates.
+type receiptList []*types.Receipt
+
+func (l receiptList) Len() int { return len(l) }
+
+// EncodeIndex encodes the i-th receipt like types.Receipts.
+// Modified from github.com/ethereum/go-ethereum/core/types.Receipts.EncodeIndex
+func (l receiptList) EncodeIndex(i int, w *bytes.Buffer) {
+	r := l[i]
+	if r.Type != types.LegacyTxType {
+		w.WriteByte(r.Type)
+	}
+	status := r.PostState
+	if len(status) == 0 {
+		status = []byte{}
+		if r.Status == types.ReceiptStatusSuccessful {
+			status = []byte{0x01}
+		}
+	}
+	_ = rlp.Encode(w, []interface{}{status, r.CumulativeGasUsed, r.Bloom, r.Logs})
+}
+
+// deriveRoots returns the transactions root and the receipts root of the
+// binary encoded transactions and their receipts.
+func deriveRoots(txs [][]byte, receipts []*types.Receipt) (common.Hash, common.Hash) {
+	return types.DeriveSha(encodedTxList(txs), trie.NewStackTrie(nil)),
+		types.DeriveSha(receiptList(receipts), trie.NewStackTrie(nil))
+}
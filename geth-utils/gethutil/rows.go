@@ -0,0 +1,53 @@
+package gethutil
+
+// StepEstimator returns the weight of a step towards an estimate, e.g. the
+// number of rows the step takes in a circuit.
+type StepEstimator func(step *StructLogRes) uint64
+
+// defaultWeightKey is the key of the weight of the opcodes missing from the
+// weights of OpcodeWeights.
+const defaultWeightKey = "*"
+
+// OpcodeWeights returns a StepEstimator weighting the steps by their opcode
+// name in weights, or by weights["*"] for the opcodes missing from it.
+func OpcodeWeights(weights map[string]uint64) StepEstimator {
+	defaultWeight := weights[defaultWeightKey]
+	return func(step *StructLogRes) uint64 {
+		if weight, ok := weights[step.Op]; ok {
+			return weight
+		}
+		return defaultWeight
+	}
+}
+
+// Estimate returns the sums of the weights of the steps of result by each of
+// estimators, by the name of the estimator. The estimates of a truncated
+// result only cover the steps in its StructLogs.
+func Estimate(result *ExecutionResult, estimators map[string]StepEstimator) map[string]uint64 {
+	logs := result.StructLogs.Formatted()
+	estimates := make(map[string]uint64, len(estimators))
+	for name, estimator := range estimators {
+		var estimate uint64
+		for i := range logs {
+			estimate += estimator(&logs[i])
+		}
+		estimates[name] = estimate
+	}
+	return estimates
+}
+
+// stepEstimators returns the estimators of RowWeights and StepEstimators of
+// config, or nil if there is none.
+func (config *TraceConfig) stepEstimators() map[string]StepEstimator {
+	if len(config.RowWeights) == 0 && len(config.StepEstimators) == 0 {
+		return nil
+	}
+	estimators := make(map[string]StepEstimator, len(config.RowWeights)+len(config.StepEstimators))
+	for name, weights := range config.RowWeights {
+		estimators[name] = OpcodeWeights(weights)
+	}
+	for name, estimator := range config.StepEstimators {
+		estimators[name] = estimator
+	}
+	return estimators
+}
@@ -0,0 +1,351 @@
+package gethutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// rpcAccount is an account fetched by eth_getProof, with the slots of its
+// storage fetched so far. It is also the format of the files of the cache.
+type rpcAccount struct {
+	Balance     *hexutil.Big                `json:"balance"`
+	Nonce       hexutil.Uint64              `json:"nonce"`
+	CodeHash    common.Hash                 `json:"codeHash"`
+	StorageHash common.Hash                 `json:"storageHash"`
+	Storage     map[common.Hash]common.Hash `json:"storage"`
+}
+
+// exists returns whether the account exists, which eth_getProof reports by
+// a zero code hash or, on some nodes, by an empty account.
+func (account *rpcAccount) exists() bool {
+	return account.CodeHash != (common.Hash{}) && !(account.CodeHash == emptyCodeHash && account.Nonce == 0 && account.Balance.ToInt().Sign() == 0 && account.StorageHash == types.EmptyRootHash)
+}
+
+// rpcState is the state after the block blockHash, fetched from a node by
+// eth_getProof and eth_getCode as it is read, and cached in dir if set: the
+// accounts in dir/<block hash>/<address>.json with the slots fetched so far,
+// and the codes in dir/codes/<code hash>.
+type rpcState struct {
+	client    *rpc.Client
+	blockHash common.Hash
+	dir       string
+
+	mu        sync.Mutex
+	accounts  map[common.Address]*rpcAccount
+	addresses map[common.Hash]common.Address
+	codes     map[common.Hash][]byte
+}
+
+// rpcStates are the states opened by openRPCState by node and block, which
+// stay in memory for the lifetime of the process.
+var rpcStates = struct {
+	sync.Mutex
+	states map[string]*rpcState
+}{states: make(map[string]*rpcState)}
+
+// openRPCState returns a state.Database of the state after the block
+// blockHash of the node at url, cached in dir if set. Its tries don't
+// compute their roots, which are the ones they were opened at.
+func openRPCState(url string, blockHash common.Hash, dir string) (state.Database, error) {
+	rpcStates.Lock()
+	defer rpcStates.Unlock()
+	key := url + "@" + blockHash.Hex()
+	s, ok := rpcStates.states[key]
+	if !ok {
+		client, err := rpc.Dial(url)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to dial %s: %w", url, err)
+		}
+		s = &rpcState{
+			client:    client,
+			blockHash: blockHash,
+			dir:       dir,
+			accounts:  make(map[common.Address]*rpcAccount),
+			addresses: make(map[common.Hash]common.Address),
+			codes:     make(map[common.Hash][]byte),
+		}
+		rpcStates.states[key] = s
+	}
+	return &rpcStateDatabase{state: s, trieDB: trie.NewDatabase(rawdb.NewMemoryDatabase())}, nil
+}
+
+// blockRef is the block of s as an EIP-1898 block parameter.
+func (s *rpcState) blockRef() interface{} {
+	return map[string]interface{}{"blockHash": s.blockHash}
+}
+
+// account returns the account of address, fetching it if needed. The lock
+// must be held.
+func (s *rpcState) account(address common.Address) (*rpcAccount, error) {
+	if account, ok := s.accounts[address]; ok {
+		return account, nil
+	}
+	account := new(rpcAccount)
+	if !s.readCache(s.accountPath(address), account) {
+		var proof struct {
+			rpcAccount
+			StorageProof []struct{} `json:"storageProof"`
+		}
+		if err := s.client.CallContext(context.Background(), &proof, "eth_getProof", address, []common.Hash{}, s.blockRef()); err != nil {
+			return nil, fmt.Errorf("Failed to get account %s: %w", address.Hex(), err)
+		}
+		*account = proof.rpcAccount
+		if err := s.writeCache(s.accountPath(address), account); err != nil {
+			return nil, err
+		}
+	}
+	if account.Balance == nil {
+		account.Balance = new(hexutil.Big)
+	}
+	if account.Storage == nil {
+		account.Storage = make(map[common.Hash]common.Hash)
+	}
+	s.accounts[address] = account
+	s.addresses[crypto.Keccak256Hash(address[:])] = address
+	return account, nil
+}
+
+// slot returns the value of the slot key of address, fetching it if needed.
+func (s *rpcState) slot(address common.Address, key common.Hash) (common.Hash, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account, err := s.account(address)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if value, ok := account.Storage[key]; ok {
+		return value, nil
+	}
+	var proof struct {
+		StorageProof []struct {
+			Value *hexutil.Big `json:"value"`
+		} `json:"storageProof"`
+	}
+	if err := s.client.CallContext(context.Background(), &proof, "eth_getProof", address, []common.Hash{key}, s.blockRef()); err != nil {
+		return common.Hash{}, fmt.Errorf("Failed to get slot %s of %s: %w", key.Hex(), address.Hex(), err)
+	}
+	if len(proof.StorageProof) != 1 {
+		return common.Hash{}, fmt.Errorf("Failed to get slot %s of %s: got %d storage proofs", key.Hex(), address.Hex(), len(proof.StorageProof))
+	}
+	value := common.BigToHash(proof.StorageProof[0].Value.ToInt())
+	account.Storage[key] = value
+	return value, s.writeCache(s.accountPath(address), account)
+}
+
+// code returns the code of hash of the account of addrHash, fetching it if
+// needed.
+func (s *rpcState) code(addrHash, hash common.Hash) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if hash == emptyCodeHash {
+		return nil, nil
+	}
+	if code, ok := s.codes[hash]; ok {
+		return code, nil
+	}
+	var code hexutil.Bytes
+	if !s.readCache(s.codePath(hash), &code) {
+		address, ok := s.addresses[addrHash]
+		if !ok {
+			return nil, fmt.Errorf("Failed to get code %s: unknown account hash %s", hash.Hex(), addrHash.Hex())
+		}
+		if err := s.client.CallContext(context.Background(), &code, "eth_getCode", address, s.blockRef()); err != nil {
+			return nil, fmt.Errorf("Failed to get code of %s: %w", address.Hex(), err)
+		}
+		if codeHash := crypto.Keccak256Hash(code); codeHash != hash {
+			return nil, fmt.Errorf("Failed to get code of %s: got code of hash %s, want %s", address.Hex(), codeHash.Hex(), hash.Hex())
+		}
+		if err := s.writeCache(s.codePath(hash), code); err != nil {
+			return nil, err
+		}
+	}
+	s.codes[hash] = code
+	return code, nil
+}
+
+func (s *rpcState) accountPath(address common.Address) string {
+	return filepath.Join(s.dir, s.blockHash.Hex(), address.Hex()+".json")
+}
+
+func (s *rpcState) codePath(hash common.Hash) string {
+	return filepath.Join(s.dir, "codes", hash.Hex())
+}
+
+// readCache reads the file at path of the cache into v, and returns whether
+// it succeeded.
+func (s *rpcState) readCache(path string, v interface{}) bool {
+	if s.dir == "" {
+		return false
+	}
+	bytes, err := os.ReadFile(path)
+	return err == nil && json.Unmarshal(bytes, v) == nil
+}
+
+// writeCache writes v into the file at path of the cache, through a
+// temporary file so that concurrent readers never observe a partial file.
+func (s *rpcState) writeCache(path string, v interface{}) error {
+	if s.dir == "" {
+		return nil
+	}
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("Failed to write state cache: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "*.tmp")
+	if err != nil {
+		return fmt.Errorf("Failed to write state cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bytes); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Failed to write state cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("Failed to write state cache: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// rpcStateDatabase is the state.Database of an rpcState.
+type rpcStateDatabase struct {
+	state  *rpcState
+	trieDB *trie.Database
+}
+
+func (db *rpcStateDatabase) OpenTrie(root common.Hash) (state.Trie, error) {
+	return &rpcTrie{state: db.state, root: root, written: make(map[string][]byte)}, nil
+}
+
+func (db *rpcStateDatabase) OpenStorageTrie(addrHash, root common.Hash) (state.Trie, error) {
+	db.state.mu.Lock()
+	address, ok := db.state.addresses[addrHash]
+	db.state.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown account hash %s", addrHash.Hex())
+	}
+	return &rpcTrie{state: db.state, address: &address, root: root, written: make(map[string][]byte)}, nil
+}
+
+func (db *rpcStateDatabase) CopyTrie(t state.Trie) state.Trie {
+	original := t.(*rpcTrie)
+	copied := *original
+	copied.written = make(map[string][]byte, len(original.written))
+	for key, value := range original.written {
+		copied.written[key] = value
+	}
+	return &copied
+}
+
+func (db *rpcStateDatabase) ContractCode(addrHash, codeHash common.Hash) ([]byte, error) {
+	return db.state.code(addrHash, codeHash)
+}
+
+func (db *rpcStateDatabase) ContractCodeSize(addrHash, codeHash common.Hash) (int, error) {
+	code, err := db.state.code(addrHash, codeHash)
+	return len(code), err
+}
+
+func (db *rpcStateDatabase) TrieDB() *trie.Database {
+	return db.trieDB
+}
+
+// rpcTrie is the account trie of an rpcState, or the storage trie of
+// address, which reads through to the node the keys which weren't written.
+type rpcTrie struct {
+	state   *rpcState
+	address *common.Address
+	root    common.Hash
+	// written are the values written by key, nil if deleted.
+	written map[string][]byte
+}
+
+func (t *rpcTrie) GetKey(key []byte) []byte {
+	return nil
+}
+
+func (t *rpcTrie) TryGet(key []byte) ([]byte, error) {
+	if value, ok := t.written[string(key)]; ok {
+		return value, nil
+	}
+	if t.address == nil {
+		address := common.BytesToAddress(key)
+		t.state.mu.Lock()
+		account, err := t.state.account(address)
+		t.state.mu.Unlock()
+		if err != nil || !account.exists() {
+			return nil, err
+		}
+		return rlp.EncodeToBytes(&types.StateAccount{
+			Nonce:    uint64(account.Nonce),
+			Balance:  account.Balance.ToInt(),
+			Root:     account.StorageHash,
+			CodeHash: account.CodeHash.Bytes(),
+		})
+	}
+	if t.root == types.EmptyRootHash {
+		return nil, nil
+	}
+	value, err := t.state.slot(*t.address, common.BytesToHash(key))
+	if err != nil || value == (common.Hash{}) {
+		return nil, err
+	}
+	return rlp.EncodeToBytes(common.TrimLeftZeroes(value[:]))
+}
+
+func (t *rpcTrie) TryUpdateAccount(key []byte, account *types.StateAccount) error {
+	value, err := rlp.EncodeToBytes(account)
+	if err != nil {
+		return err
+	}
+	t.written[string(key)] = value
+	return nil
+}
+
+func (t *rpcTrie) TryUpdate(key, value []byte) error {
+	t.written[string(key)] = common.CopyBytes(value)
+	return nil
+}
+
+func (t *rpcTrie) TryDelete(key []byte) error {
+	t.written[string(key)] = nil
+	return nil
+}
+
+// Hash returns the root the trie was opened at, as the whole trie isn't
+// known.
+func (t *rpcTrie) Hash() common.Hash {
+	return t.root
+}
+
+func (t *rpcTrie) Commit(onleaf trie.LeafCallback) (common.Hash, int, error) {
+	return t.root, 0, nil
+}
+
+// NodeIterator iterates an empty trie, as the whole trie isn't known.
+func (t *rpcTrie) NodeIterator(startKey []byte) trie.NodeIterator {
+	empty, _ := trie.New(common.Hash{}, trie.NewDatabase(rawdb.NewMemoryDatabase()))
+	return empty.NodeIterator(startKey)
+}
+
+func (t *rpcTrie) Prove(key []byte, fromLevel uint, proofDb ethdb.KeyValueWriter) error {
+	return errors.New("the state fetched by RPC can't be proven")
+}
@@ -0,0 +1,97 @@
+package gethutil
+
+import (
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/holiman/uint256"
+)
+
+// RWEstimate is an estimate of the read/write operations the bus-mapping
+// produces for a trace, by the kind of state they operate on. Memory
+// operations are counted by byte, like the bus-mapping does. It covers all
+// the executed steps, including the ones which weren't captured, e.g. past
+// TracerOptions.MaxSteps, since the chunking of a block needs the operations
+// of the whole trace.
+type RWEstimate struct {
+	Stack   uint64 `json:"stack"`
+	Memory  uint64 `json:"memory"`
+	Storage uint64 `json:"storage"`
+	Account uint64 `json:"account"`
+	Total   uint64 `json:"total"`
+}
+
+// addStep adds the operations of a step of op with stack before its
+// execution, which must hold the inputs of op.
+func (e *RWEstimate) addStep(op vm.OpCode, stack []uint256.Int) {
+	// back returns the n-th stack item from the top, saturated to a uint64.
+	back := func(n int) uint64 {
+		item := &stack[len(stack)-1-n]
+		if !item.IsUint64() {
+			return ^uint64(0)
+		}
+		return item.Uint64()
+	}
+	pops, pushes := opStackIO(op)
+	if len(stack) < pops {
+		// The step fails with a stack underflow.
+		return
+	}
+
+	var stackOps, memoryOps, storageOps, accountOps uint64
+	switch {
+	case op >= vm.DUP1 && op <= vm.DUP16:
+		// Read the duplicated item, and write it on top.
+		stackOps = 2
+	case op >= vm.SWAP1 && op <= vm.SWAP16:
+		// Read and write both swapped items.
+		stackOps = 4
+	default:
+		stackOps = uint64(pops + pushes)
+	}
+
+	switch op {
+	case vm.MLOAD, vm.MSTORE:
+		memoryOps = 32
+	case vm.MSTORE8:
+		memoryOps = 1
+	case vm.KECCAK256, vm.RETURN, vm.REVERT, vm.LOG0, vm.LOG1, vm.LOG2, vm.LOG3, vm.LOG4:
+		memoryOps = back(1)
+	case vm.CALLDATACOPY, vm.CODECOPY, vm.RETURNDATACOPY, vm.CREATE, vm.CREATE2:
+		memoryOps = back(2)
+	case vm.EXTCODECOPY:
+		memoryOps = back(3)
+	case vm.CALL, vm.CALLCODE:
+		memoryOps = saturatingAdd(back(4), back(6))
+	case vm.DELEGATECALL, vm.STATICCALL:
+		memoryOps = saturatingAdd(back(3), back(5))
+	}
+
+	switch op {
+	case vm.SLOAD, vm.SSTORE:
+		storageOps = 1
+	case vm.BALANCE, vm.SELFBALANCE, vm.EXTCODESIZE, vm.EXTCODECOPY, vm.EXTCODEHASH, vm.DELEGATECALL, vm.STATICCALL:
+		accountOps = 1
+	case vm.CALL, vm.CALLCODE:
+		// The callee, and the balances of a value transfer.
+		accountOps = 1
+		if back(2) != 0 {
+			accountOps += 2
+		}
+	case vm.CREATE, vm.CREATE2, vm.SELFDESTRUCT:
+		// The nonce or balance of the caller, and the created or
+		// beneficiary account.
+		accountOps = 2
+	}
+
+	e.Stack = saturatingAdd(e.Stack, stackOps)
+	e.Memory = saturatingAdd(e.Memory, memoryOps)
+	e.Storage = saturatingAdd(e.Storage, storageOps)
+	e.Account = saturatingAdd(e.Account, accountOps)
+	e.Total = saturatingAdd(e.Total, saturatingAdd(stackOps+storageOps+accountOps, memoryOps))
+}
+
+func saturatingAdd(a, b uint64) uint64 {
+	if a+b < a {
+		return ^uint64(0)
+	}
+	return a + b
+}
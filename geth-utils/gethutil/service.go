@@ -0,0 +1,393 @@
+package gethutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// TraceService exposes the tracing functions to RPC clients, so that they can
+// be called over a socket by a long-running process instead of through the
+// FFI.
+type TraceService struct{}
+
+// Trace traces the transactions of config until the request is cancelled,
+// see TraceContext, and returns the results in the output of config, see
+// FormatResults.
+func (s *TraceService) Trace(ctx context.Context, config TraceConfig) (interface{}, error) {
+	results, err := TraceContext(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return FormatResults(config, results), nil
+}
+
+// TraceBundle traces the transactions of config against an evolving state,
+// see TraceBundle.
+func (s *TraceService) TraceBundle(config BundleConfig) (*BundleResult, error) {
+	return TraceBundle(config)
+}
+
+// TraceBlock traces the transactions of config as a block with its
+// withdrawals, see TraceBlock.
+func (s *TraceService) TraceBlock(config TraceConfig) (*BlockTraceResult, error) {
+	return TraceBlock(config)
+}
+
+// TraceBlocks traces the blocks of config in sequence, see TraceBlocks.
+func (s *TraceService) TraceBlocks(config BlocksConfig) ([]*BlockTraceResult, error) {
+	return TraceBlocks(config)
+}
+
+// EncodeTransaction returns the binary encoding of tx on the chain of
+// chainID, see EncodeTransaction.
+func (s *TraceService) EncodeTransaction(tx Transaction, chainID *hexutil.Big) (hexutil.Bytes, error) {
+	return EncodeTransaction(tx, toBigInt(chainID))
+}
+
+// TransactionSigningHash returns the hash signed by the sender of tx on the
+// chain of chainID, see TransactionSigningHash.
+func (s *TraceService) TransactionSigningHash(tx Transaction, chainID *hexutil.Big) (common.Hash, error) {
+	return TransactionSigningHash(tx, toBigInt(chainID))
+}
+
+// SignTransaction signs tx on the chain of chainID with key, see
+// SignTransaction.
+func (s *TraceService) SignTransaction(tx Transaction, chainID *hexutil.Big, key SigningKey) (*SignedTransaction, error) {
+	return SignTransaction(tx, toBigInt(chainID), key)
+}
+
+// ContractAddress returns the address of the contract created by sender
+// with nonce, see ContractAddress.
+func (s *TraceService) ContractAddress(sender common.Address, nonce hexutil.Uint64) common.Address {
+	return ContractAddress(sender, uint64(nonce))
+}
+
+// Create2Address returns the address of the contract created by sender
+// with salt and the init code of initCodeHash, see Create2Address.
+func (s *TraceService) Create2Address(sender common.Address, salt, initCodeHash common.Hash) common.Address {
+	return Create2Address(sender, salt, initCodeHash)
+}
+
+// DecodedTransaction is a transaction decoded by DecodeRawTransaction, with
+// its chain ID.
+type DecodedTransaction struct {
+	Transaction *Transaction `json:"transaction"`
+	ChainID     *hexutil.Big `json:"chain_id"`
+}
+
+// DecodeTransaction decodes the binary encoding of a transaction, see
+// DecodeRawTransaction.
+func (s *TraceService) DecodeTransaction(data hexutil.Bytes) (*DecodedTransaction, error) {
+	tx, chainID, err := DecodeRawTransaction(data)
+	if err != nil {
+		return nil, err
+	}
+	return &DecodedTransaction{Transaction: tx, ChainID: (*hexutil.Big)(chainID)}, nil
+}
+
+// Call runs the transactions of config without tracing, see CallTxs.
+func (s *TraceService) Call(config TraceConfig) ([]*CallResult, error) {
+	return CallTxs(config)
+}
+
+// EstimateGas estimates the gas limit of the last transaction of config, see
+// EstimateGas.
+func (s *TraceService) EstimateGas(config TraceConfig) (hexutil.Uint64, error) {
+	gas, err := EstimateGas(config)
+	return hexutil.Uint64(gas), err
+}
+
+// PackChunks traces the transactions of config, see TraceContext, and packs
+// them into chunks within limits, see PackChunks. The transactions are
+// accounted for all their executed steps, so the steps can be left out of
+// the trace, e.g. with a max_steps of 1 in the tracer_options.
+func (s *TraceService) PackChunks(ctx context.Context, config TraceConfig, limits PackLimits) (*PackingReport, error) {
+	results, err := TraceContext(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return PackChunks(results, limits), nil
+}
+
+// TraceOutput holds either the results, in the output of their config (see
+// FormatResults), or the error of tracing a config.
+type TraceOutput struct {
+	Result interface{} `json:"result,omitempty"`
+	Error  *TraceError `json:"error,omitempty"`
+}
+
+// TraceTxs traces independent configs concurrently, see TraceTxs.
+func (s *TraceService) TraceTxs(configs []TraceConfig, workers int) []TraceOutput {
+	results, errs := TraceTxs(configs, workers)
+	outputs := make([]TraceOutput, len(configs))
+	for i := range configs {
+		if errs[i] != nil {
+			outputs[i].Error = AsTraceError(errs[i])
+		} else {
+			outputs[i].Result = FormatResults(configs[i], results[i])
+		}
+	}
+	return outputs
+}
+
+// DebugService exposes Trace through the debug_traceCall and
+// debug_traceTransaction methods of geth, for tools which only speak the geth
+// debug API. Since there is no chain, the block is the one of chain, whose
+// transactions are the ones of the block, on top of its accounts.
+type DebugService struct {
+	chain TraceConfig
+}
+
+// NewDebugService returns a DebugService on the block of chain.
+func NewDebugService(chain TraceConfig) *DebugService {
+	return &DebugService{chain: chain}
+}
+
+// CallArgs are the arguments of a call of debug_traceCall.
+// Modified from github.com/ethereum/go-ethereum/internal/ethapi.TransactionArgs
+type CallArgs struct {
+	From                 *common.Address   `json:"from"`
+	To                   *common.Address   `json:"to"`
+	Gas                  *hexutil.Uint64   `json:"gas"`
+	GasPrice             *hexutil.Big      `json:"gasPrice"`
+	MaxFeePerGas         *hexutil.Big      `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big      `json:"maxPriorityFeePerGas"`
+	Value                *hexutil.Big      `json:"value"`
+	Nonce                *hexutil.Uint64   `json:"nonce"`
+	Data                 *hexutil.Bytes    `json:"data"`
+	Input                *hexutil.Bytes    `json:"input"`
+	AccessList           *types.AccessList `json:"accessList"`
+}
+
+// defaultCallGas is the gas of a call without one, like the default RPC gas
+// cap of geth.
+const defaultCallGas = 50_000_000
+
+// transaction returns the transaction of args, with the gas limit of the
+// block of chain if args has no gas.
+func (args *CallArgs) transaction(chain *TraceConfig) Transaction {
+	tx := Transaction{
+		To:        args.To,
+		Nonce:     args.Nonce,
+		Value:     args.Value,
+		GasLimit:  defaultCallGas,
+		GasPrice:  args.GasPrice,
+		GasFeeCap: args.MaxFeePerGas,
+		GasTipCap: args.MaxPriorityFeePerGas,
+	}
+	if args.From != nil {
+		tx.From = *args.From
+	}
+	if args.Gas != nil {
+		tx.GasLimit = *args.Gas
+	} else if gasLimit := chain.Block.GasLimit; gasLimit != nil && gasLimit.ToInt().IsUint64() {
+		tx.GasLimit = hexutil.Uint64(gasLimit.ToInt().Uint64())
+	}
+	// Input is preferred to Data, like by geth.
+	if args.Input != nil {
+		tx.CallData = *args.Input
+	} else if args.Data != nil {
+		tx.CallData = *args.Data
+	}
+	if args.AccessList != nil {
+		for _, tuple := range *args.AccessList {
+			tx.AccessList = append(tx.AccessList, struct {
+				Address     common.Address `json:"address"`
+				StorageKeys []common.Hash  `json:"storage_keys"`
+			}{tuple.Address, tuple.StorageKeys})
+		}
+	}
+	return tx
+}
+
+// DebugTraceConfig is the config of the struct logger of geth, which is the
+// only tracer supported, with Limit in place of TracerOptions.MaxSteps. The
+// return data of the steps isn't captured, so EnableReturnData is ignored.
+// Modified from github.com/ethereum/go-ethereum/eth/tracers.TraceConfig
+type DebugTraceConfig struct {
+	EnableMemory     bool    `json:"enableMemory"`
+	DisableStack     bool    `json:"disableStack"`
+	DisableStorage   bool    `json:"disableStorage"`
+	EnableReturnData bool    `json:"enableReturnData"`
+	Limit            int     `json:"limit"`
+	Tracer           *string `json:"tracer"`
+	Timeout          *string `json:"timeout"`
+}
+
+// DebugTraceCallConfig is the config of debug_traceCall, with the state
+// overridden for the call.
+// Modified from github.com/ethereum/go-ethereum/eth/tracers.TraceCallConfig
+type DebugTraceCallConfig struct {
+	DebugTraceConfig
+	StateOverrides *StateOverride `json:"stateOverrides"`
+}
+
+// DebugTraceResult is the trace of a transaction in the format of the struct
+// logger of geth, whose steps have the extra fields of StructLogRes.
+// Modified from github.com/ethereum/go-ethereum/internal/ethapi.ExecutionResult
+type DebugTraceResult struct {
+	Gas         uint64         `json:"gas"`
+	Failed      bool           `json:"failed"`
+	ReturnValue string         `json:"returnValue"`
+	StructLogs  []StructLogRes `json:"structLogs"`
+}
+
+// TraceCall traces call at the block blockNrOrHash, which is the block of
+// the chain (or latest or pending), on top of its transactions, or its
+// parent, on top of its accounts.
+func (s *DebugService) TraceCall(ctx context.Context, call CallArgs, blockNrOrHash rpc.BlockNumberOrHash, config *DebugTraceCallConfig) (*DebugTraceResult, error) {
+	chain := s.chain
+	number, ok := blockNrOrHash.Number()
+	if !ok {
+		return nil, errors.New("block hashes aren't supported, use a block number or a tag")
+	}
+	// Negative numbers are the tags latest and pending.
+	if number >= 0 {
+		blockNumber := toBigInt(chain.Block.Number)
+		switch depth := new(big.Int).Sub(blockNumber, big.NewInt(number.Int64())); {
+		case depth.Sign() == 0:
+		case depth.Cmp(common.Big1) == 0:
+			chain.Transactions = nil
+		default:
+			return nil, fmt.Errorf("block %d not found, only %d and its parent are", number, blockNumber)
+		}
+	}
+
+	var traceConfig DebugTraceConfig
+	if config != nil {
+		traceConfig = config.DebugTraceConfig
+		if config.StateOverrides != nil {
+			chain.StateOverride = config.StateOverrides
+		}
+	}
+	// Like by geth, a call without a nonce has the one of its sender, but
+	// the missing nonces of the transactions of the chain are still 0.
+	txs := make([]Transaction, len(chain.Transactions), len(chain.Transactions)+1)
+	copy(txs, chain.Transactions)
+	if call.Nonce == nil && !chain.AutoNonce {
+		for i := range txs {
+			if txs[i].Nonce == nil {
+				txs[i].Nonce = new(hexutil.Uint64)
+			}
+		}
+		chain.AutoNonce = true
+	}
+	chain.Transactions = append(txs, call.transaction(&chain))
+	results, err := s.trace(ctx, chain, traceConfig)
+	if err != nil {
+		return nil, err
+	}
+	return newDebugTraceResult(results[len(results)-1], traceConfig), nil
+}
+
+// TraceTransaction traces the transaction of hash among the ones of the
+// chain, on top of the transactions before it. The hash of a transaction is
+// the Keccak-256 of its encoding by EncodeTransaction, with its nonce filled
+// by TraceConfig.AutoNonce if it has none. A signed transaction, e.g. by
+// SignTransaction, thus has its hash on the chain, while one without v, r
+// and s has the hash of its encoding with a zero signature, which is the
+// one of gethutil_encodeTransaction.
+func (s *DebugService) TraceTransaction(ctx context.Context, hash common.Hash, config *DebugTraceConfig) (*DebugTraceResult, error) {
+	var traceConfig DebugTraceConfig
+	if config != nil {
+		traceConfig = *config
+	}
+	env, err := newTraceEnv(s.chain)
+	if err != nil {
+		return nil, err
+	}
+	results, err := s.trace(ctx, s.chain, traceConfig)
+	if err != nil {
+		return nil, err
+	}
+	for i, tx := range s.chain.Transactions {
+		// The nonces filled automatically are part of the hashes.
+		if tx.Nonce == nil {
+			tx.Nonce = results[i].Nonce
+		}
+		raw, err := EncodeTransaction(tx, env.chainConfig.ChainID)
+		if err != nil {
+			return nil, err
+		}
+		if crypto.Keccak256Hash(raw) == hash {
+			return newDebugTraceResult(results[i], traceConfig), nil
+		}
+	}
+	return nil, fmt.Errorf("transaction %s not found", hash.Hex())
+}
+
+// trace traces the transactions of chain with the struct logger of config,
+// and fails unless all of them were traced to their end.
+func (s *DebugService) trace(ctx context.Context, chain TraceConfig, config DebugTraceConfig) ([]*ExecutionResult, error) {
+	if config.Tracer != nil && *config.Tracer != "" {
+		return nil, fmt.Errorf("tracer %q isn't supported, only the struct logger is", *config.Tracer)
+	}
+	if config.Timeout != nil {
+		timeout, err := time.ParseDuration(*config.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	chain.TracerOptions = TracerOptions{DisableMemory: !config.EnableMemory, MaxSteps: config.Limit}
+	chain.Output = ""
+
+	results, err := TraceContext(ctx, chain)
+	if err != nil {
+		return nil, err
+	}
+	// An interrupted transaction is the last one traced.
+	if n := len(results); n < len(chain.Transactions) || (n > 0 && results[n-1].Interrupted) {
+		return nil, errors.New("tracing interrupted, e.g. by its timeout")
+	}
+	return results, nil
+}
+
+// newDebugTraceResult returns the DebugTraceResult of result, without the
+// stacks or the storages of its steps if config disables them.
+func newDebugTraceResult(result *ExecutionResult, config DebugTraceConfig) *DebugTraceResult {
+	structLogs := result.StructLogs.Formatted()
+	if config.DisableStack || config.DisableStorage {
+		structLogs = make([]StructLogRes, len(structLogs))
+		copy(structLogs, result.StructLogs.Formatted())
+		for i := range structLogs {
+			if config.DisableStack {
+				structLogs[i].Stack = nil
+			}
+			if config.DisableStorage {
+				structLogs[i].Storage = nil
+			}
+		}
+	}
+	return &DebugTraceResult{
+		Gas:         result.Gas,
+		Failed:      result.Failed,
+		ReturnValue: result.ReturnValue,
+		StructLogs:  structLogs,
+	}
+}
+
+// NewRPCServer returns a JSON-RPC server with the TraceService registered
+// under the "gethutil" namespace (e.g. "gethutil_trace"), and the
+// DebugService on chain under the "debug" namespace (e.g. "debug_traceCall").
+func NewRPCServer(chain TraceConfig) (*rpc.Server, error) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("gethutil", new(TraceService)); err != nil {
+		return nil, err
+	}
+	if err := server.RegisterName("debug", NewDebugService(chain)); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
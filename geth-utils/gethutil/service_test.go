@@ -0,0 +1,59 @@
+package gethutil
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// TestDebugTraceTransactionHash checks that debug_traceTransaction finds a
+// signed transaction by the hash of its raw encoding, and an unsigned one by
+// the hash of its encoding with a zero signature.
+func TestDebugTraceTransactionHash(t *testing.T) {
+	chainID := big.NewInt(1)
+	from := common.HexToAddress("0xfe")
+	to := common.HexToAddress("0xaa")
+	gasPrice := (*hexutil.Big)(big.NewInt(0x3b9aca00))
+	signed, err := SignTransaction(Transaction{Nonce: new(hexutil.Uint64), To: &to, GasLimit: 21000, GasPrice: gasPrice, Value: (*hexutil.Big)(big.NewInt(1))}, chainID, SigningKey{Seed: "debug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned := Transaction{From: from, Nonce: new(hexutil.Uint64), To: &to, GasLimit: 21000, GasPrice: gasPrice}
+	balance := (*hexutil.Big)(hexutil.MustDecodeBig("0xffffffffffffffffff"))
+	service := NewDebugService(TraceConfig{
+		ChainID: (*hexutil.Big)(chainID),
+		Block:   Block{GasLimit: (*hexutil.Big)(hexutil.MustDecodeBig("0x1000000"))},
+		Accounts: map[common.Address]Account{
+			from:                    {Balance: balance},
+			signed.Transaction.From: {Balance: balance},
+		},
+		Transactions: []Transaction{unsigned, signed.Transaction},
+	})
+
+	// A client has the hash of the raw transaction it signed.
+	var tx types.Transaction
+	if err := tx.UnmarshalBinary(signed.Raw); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := EncodeTransaction(unsigned, chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range []common.Hash{tx.Hash(), crypto.Keccak256Hash(raw)} {
+		result, err := service.TraceTransaction(context.Background(), hash, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", hash.Hex(), err)
+		}
+		if result.Gas != 21000 || result.Failed {
+			t.Fatalf("%s: got gas %d, failed %v, want 21000, false", hash.Hex(), result.Gas, result.Failed)
+		}
+	}
+	if _, err := service.TraceTransaction(context.Background(), common.Hash{}, nil); err == nil {
+		t.Fatal("found a transaction of zero hash")
+	}
+}
@@ -0,0 +1,168 @@
+package gethutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Authorization is an authorization of an EIP-7702 set-code transaction,
+// which delegates the code of its authority to the code of Address.
+type Authorization struct {
+	ChainID *hexutil.Big   `json:"chain_id"`
+	Address common.Address `json:"address"`
+	Nonce   hexutil.Uint64 `json:"nonce"`
+	YParity hexutil.Uint64 `json:"y_parity"`
+	R       *hexutil.Big   `json:"r"`
+	S       *hexutil.Big   `json:"s"`
+	// Authority, if set, is the signer of the authorization in place of the
+	// one recovered from its signature, like From for the transactions.
+	Authority *common.Address `json:"authority"`
+}
+
+// The constants of EIP-7702.
+const (
+	authorizationMagic = 0x05
+	// perAuthorizationGas is the intrinsic gas of an authorization, of
+	// which perAuthorizationRefund is refunded if its authority exists.
+	perAuthorizationGas    = 25000
+	perAuthorizationRefund = 25000 - 12500
+)
+
+// delegationPrefix is the prefix of the code of a delegated account, which
+// is followed by the address of its delegate.
+var delegationPrefix = []byte{0xef, 0x01, 0x00}
+
+// parseDelegation returns the delegate of an account of code, if it is
+// delegated.
+func parseDelegation(code []byte) (common.Address, bool) {
+	if len(code) != len(delegationPrefix)+common.AddressLength || !bytes.HasPrefix(code, delegationPrefix) {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(code[len(delegationPrefix):]), true
+}
+
+// sigHash returns the hash signed by the authority of a.
+func (a *Authorization) sigHash() (common.Hash, error) {
+	payload, err := rlp.EncodeToBytes([]interface{}{toBigInt(a.ChainID), a.Address, uint64(a.Nonce)})
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash([]byte{authorizationMagic}, payload), nil
+}
+
+// authority returns the signer of a.
+func (a *Authorization) authority() (common.Address, error) {
+	if a.Authority != nil {
+		return *a.Authority, nil
+	}
+	if a.YParity > 1 || !crypto.ValidateSignatureValues(byte(a.YParity), toBigInt(a.R), toBigInt(a.S), true) {
+		return common.Address{}, errors.New("invalid signature values")
+	}
+	hash, err := a.sigHash()
+	if err != nil {
+		return common.Address{}, err
+	}
+	var sig [crypto.SignatureLength]byte
+	toBigInt(a.R).FillBytes(sig[:32])
+	toBigInt(a.S).FillBytes(sig[32:64])
+	sig[64] = byte(a.YParity)
+	pub, err := crypto.SigToPub(hash[:], sig[:])
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// authorizationGas returns the intrinsic gas of the authorizations of the
+// i-th message, which isn't part of its gas.
+func (env *traceEnv) authorizationGas(i int) uint64 {
+	return perAuthorizationGas * uint64(len(env.authorizations[i]))
+}
+
+// authorize checks that the sender of message, the i-th one, can pay for
+// the intrinsic gas of its authorizations on top of its gas, and makes the
+// transaction apply them once it starts, after the nonce of its sender is
+// incremented like in geth. It returns the fee paid for the intrinsic gas,
+// or nil if the message has no authorization.
+// As the go-ethereum in use predates EIP-7702, the intrinsic gas of the
+// authorizations is paid by the sender before the execution, and its
+// priority fee is burned.
+func (env *traceEnv) authorize(stateDB *StateDB, i int, message types.Message, config TraceConfig) (*big.Int, error) {
+	authorizations := env.authorizations[i]
+	if len(authorizations) == 0 {
+		return nil, nil
+	}
+
+	from := message.From()
+	fee := new(big.Int).SetUint64(env.authorizationGas(i))
+	fee.Mul(fee, message.GasPrice())
+	// Same as the balance check of core.StateTransition.buyGas for the whole
+	// gas limit
+	required := new(big.Int).SetUint64(message.Gas() + env.authorizationGas(i))
+	required.Mul(required, message.GasFeeCap())
+	required.Add(required, message.Value())
+	if balance := stateDB.GetBalance(from); balance.Cmp(required) < 0 {
+		if !config.SkipBalanceCheck {
+			return nil, fmt.Errorf("%w: address %v have %v want %v", core.ErrInsufficientFunds, from.Hex(), balance, required)
+		}
+		stateDB.AddBalance(from, required.Sub(required, balance))
+	}
+
+	stateDB.onTxStart = append(stateDB.onTxStart, func() {
+		stateDB.SubBalance(from, fee)
+		for _, authorization := range authorizations {
+			env.applyAuthorization(stateDB, &authorization)
+		}
+	})
+	return fee, nil
+}
+
+// applyAuthorization delegates the code of the authority of authorization,
+// or skips it if it is invalid.
+// Modified from github.com/ethereum/go-ethereum/core.StateTransition.applyAuthorization
+func (env *traceEnv) applyAuthorization(stateDB *StateDB, authorization *Authorization) {
+	if chainID := toBigInt(authorization.ChainID); chainID.Sign() != 0 && chainID.Cmp(env.chainConfig.ChainID) != 0 {
+		return
+	}
+	if uint64(authorization.Nonce)+1 == 0 {
+		return
+	}
+	authority, err := authorization.authority()
+	if err != nil {
+		return
+	}
+	stateDB.warmAddress(authority)
+	if code := stateDB.StateDB.GetCode(authority); len(code) != 0 {
+		if _, ok := parseDelegation(code); !ok {
+			return
+		}
+	}
+	if stateDB.GetNonce(authority) != uint64(authorization.Nonce) {
+		return
+	}
+
+	if stateDB.Exist(authority) {
+		stateDB.StateDB.AddRefund(perAuthorizationRefund)
+	}
+	stateDB.SetNonce(authority, uint64(authorization.Nonce)+1)
+	if authorization.Address == (common.Address{}) {
+		stateDB.SetCode(authority, nil)
+		return
+	}
+	stateDB.SetCode(authority, append(append([]byte{}, delegationPrefix...), authorization.Address.Bytes()...))
+}
+
+// isDelegated returns whether the code of address delegates to another one.
+func isDelegated(stateDB *StateDB, address common.Address) bool {
+	_, ok := parseDelegation(stateDB.StateDB.GetCode(address))
+	return ok
+}
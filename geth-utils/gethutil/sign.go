@@ -0,0 +1,96 @@
+package gethutil
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// SigningKey is a private key, given either as is or by a seed from which it
+// is derived deterministically, so that the tests don't carry raw keys.
+type SigningKey struct {
+	PrivateKey hexutil.Bytes `json:"private_key"`
+	Seed       string        `json:"seed"`
+}
+
+// privateKey returns the private key of k, which is the keccak256 of its
+// seed if it has no private key.
+func (k *SigningKey) privateKey() (*ecdsa.PrivateKey, error) {
+	if len(k.PrivateKey) != 0 {
+		return crypto.ToECDSA(k.PrivateKey)
+	}
+	if k.Seed == "" {
+		return nil, errors.New("signing key has neither a private key nor a seed")
+	}
+	return crypto.ToECDSA(crypto.Keccak256([]byte(k.Seed)))
+}
+
+// Address returns the address of k.
+func (k *SigningKey) Address() (common.Address, error) {
+	key, err := k.privateKey()
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(key.PublicKey), nil
+}
+
+// SignedTransaction is a transaction signed by SignTransaction.
+type SignedTransaction struct {
+	// Transaction is the signed transaction, whose From is the address of
+	// the key, so that it can be traced as is.
+	Transaction Transaction   `json:"transaction"`
+	Raw         hexutil.Bytes `json:"raw"`
+	Hash        common.Hash   `json:"hash"`
+	V           *hexutil.Big  `json:"v"`
+	R           *hexutil.Big  `json:"r"`
+	S           *hexutil.Big  `json:"s"`
+}
+
+// SignTransaction signs tx on the chain of chainID with key, and returns it
+// with its binary encoding, see EncodeTransaction. A legacy transaction is
+// signed by EIP-155 unless chainID is nil or 0.
+func SignTransaction(tx Transaction, chainID *big.Int, key SigningKey) (*SignedTransaction, error) {
+	privateKey, err := key.privateKey()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := TransactionSigningHash(tx, chainID)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := crypto.Sign(hash[:], privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	v := new(big.Int).SetUint64(uint64(sig[64]))
+	if encodedTxType(tx) == types.LegacyTxType {
+		if chainID != nil && chainID.Sign() != 0 {
+			// v is chain ID * 2 + 35 + y parity by EIP-155.
+			v.Add(v, new(big.Int).Add(new(big.Int).Lsh(chainID, 1), big.NewInt(35)))
+		} else {
+			v.Add(v, big.NewInt(27))
+		}
+	}
+	tx.From = crypto.PubkeyToAddress(privateKey.PublicKey)
+	tx.V = (*hexutil.Big)(v)
+	tx.R = (*hexutil.Big)(new(big.Int).SetBytes(sig[:32]))
+	tx.S = (*hexutil.Big)(new(big.Int).SetBytes(sig[32:64]))
+	raw, err := EncodeTransaction(tx, chainID)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedTransaction{
+		Transaction: tx,
+		Raw:         raw,
+		Hash:        crypto.Keccak256Hash(raw),
+		V:           tx.V,
+		R:           tx.R,
+		S:           tx.S,
+	}, nil
+}
@@ -0,0 +1,137 @@
+//go:build !js
+// +build !js
+
+package gethutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os/exec"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// SolcContract is a contract compiled by solc.
+type SolcContract struct {
+	Name string
+	// ABI is the JSON ABI of the contract.
+	ABI        json.RawMessage
+	Bin        []byte
+	BinRuntime []byte
+}
+
+// CompileSolidity compiles the Solidity source files with the solc
+// executable (e.g. "solc", or a path to a solc-bin release), and returns the
+// compiled contracts by name.
+func CompileSolidity(solc string, sources ...string) (map[string]*SolcContract, error) {
+	args := append([]string{"--combined-json", "abi,bin,bin-runtime"}, sources...)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(solc, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("Failed to run solc: %v\n%s", err, stderr.String())
+	}
+
+	var output struct {
+		Contracts map[string]struct {
+			ABI        json.RawMessage `json:"abi"`
+			Bin        string          `json:"bin"`
+			BinRuntime string          `json:"bin-runtime"`
+		} `json:"contracts"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal solc output: %w", err)
+	}
+
+	contracts := make(map[string]*SolcContract, len(output.Contracts))
+	for fullName, compiled := range output.Contracts {
+		// Contracts are named as <source>:<name>.
+		name := fullName[strings.LastIndex(fullName, ":")+1:]
+		// solc before 0.8 encodes the ABI as a JSON string.
+		abi := compiled.ABI
+		var abiString string
+		if err := json.Unmarshal(abi, &abiString); err == nil {
+			abi = json.RawMessage(abiString)
+		}
+		bin, err := hexutil.Decode("0x" + compiled.Bin)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode bin of %s: %w", fullName, err)
+		}
+		binRuntime, err := hexutil.Decode("0x" + compiled.BinRuntime)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode bin-runtime of %s: %w", fullName, err)
+		}
+		contracts[name] = &SolcContract{Name: name, ABI: abi, Bin: bin, BinRuntime: binRuntime}
+	}
+	return contracts, nil
+}
+
+// deployGas is the gas available to a constructor run by Deploy.
+const deployGas = 1 << 40
+
+// storageRecorder records the storage written through it.
+type storageRecorder struct {
+	*StateDB
+	storage map[common.Hash]common.Hash
+	address common.Address
+}
+
+func (s *storageRecorder) SetState(address common.Address, key, value common.Hash) {
+	if address == s.address {
+		s.storage[key] = value
+	}
+	s.StateDB.SetState(address, key, value)
+}
+
+// Deploy runs the constructor of the contract with the ABI-encoded args on
+// the state of config, and sets the deployed account at address in
+// config.Accounts, with the code returned by the constructor and the storage
+// it wrote. The constructor runs as the code of address, so it sees its
+// final address, but a non-zero EXTCODESIZE of itself.
+func (c *SolcContract) Deploy(config *TraceConfig, address common.Address, args []byte) error {
+	env, err := newTraceEnv(*config)
+	if err != nil {
+		return err
+	}
+	stateDB, err := newStateDB(*config)
+	if err != nil {
+		return err
+	}
+
+	account := config.Accounts[address]
+	storage := make(map[common.Hash]common.Hash)
+	for key, value := range account.Storage {
+		storage[key] = value
+	}
+	stateDB.SetCode(address, append(append([]byte{}, c.Bin...), args...))
+	stateDB.SetNonce(address, 1)
+
+	recorder := &storageRecorder{StateDB: stateDB, storage: storage, address: address}
+	evm := vm.NewEVM(env.blockCtx, vm.TxContext{Origin: address, GasPrice: new(big.Int)}, recorder, env.chainConfig, env.vmConfig(nil))
+	code, _, err := evm.Call(vm.AccountRef(address), address, nil, deployGas, new(big.Int))
+	if err != nil {
+		return fmt.Errorf("Failed to run the constructor of %s: %w", c.Name, err)
+	}
+
+	for key, value := range storage {
+		if value == (common.Hash{}) {
+			delete(storage, key)
+		}
+	}
+	if config.Accounts == nil {
+		config.Accounts = make(map[common.Address]Account)
+	}
+	config.Accounts[address] = Account{
+		Nonce:   1,
+		Balance: account.Balance,
+		Code:    code,
+		Storage: storage,
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package gethutil
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// accessKey is an address, or a storage slot of an address if isSlot is set.
+type accessKey struct {
+	address common.Address
+	slot    common.Hash
+	isSlot  bool
+}
+
+// StateDB wraps a state.StateDB to observe the state accesses of the EVM,
+// which StructLogger reads to annotate the steps with what the geth logger
+// doesn't expose.
+type StateDB struct {
+	*state.StateDB
+
+	// coldAccesses are the accesses which were added to the access list
+	// since the last call of takeColdAccesses.
+	coldAccesses map[accessKey]struct{}
+	// accessed are the accesses which were added to the access list since
+	// the last call of takeAccessList, some of which may have been reverted.
+	accessed map[accessKey]struct{}
+	// refundDelta is the change of the refund counter since the last call of
+	// takeRefundDelta.
+	refundDelta int64
+	// hiddenCode is the account whose code hash reads as the empty one until
+	// the next snapshot, see hideSenderCode.
+	hiddenCode *common.Address
+	// onTxStart are called by the next snapshot, which the EVM takes when a
+	// transaction starts after its checks.
+	onTxStart []func()
+	// clampCoinbaseCredit turns a negative credit of the coinbase into 0.
+	clampCoinbaseCredit bool
+	// coinbaseCredit is the last credit of the coinbase since the last call
+	// of watchCoinbase, see takeCoinbaseCredit, and coinbaseCreated is set
+	// when the coinbase didn't exist before it.
+	coinbase        common.Address
+	coinbaseCredit  *big.Int
+	coinbaseCreated bool
+	// preState is the state of the accounts written to since the last call
+	// of watchState, see takeStateDiff.
+	preState map[common.Address]*accountState
+	// touched are the accounts touched since the last call of watchTouches,
+	// with whether they existed before, see finaliseTouched.
+	touched map[common.Address]bool
+	// preimages are the preimages of the keys of the tries accessed since
+	// the last call of watchPreimages, see takePreimages.
+	preimages map[common.Hash]hexutil.Bytes
+}
+
+// NewStateDB returns a StateDB wrapping statedb.
+func NewStateDB(statedb *state.StateDB) *StateDB {
+	return &StateDB{
+		StateDB:      statedb,
+		coldAccesses: make(map[accessKey]struct{}),
+		accessed:     make(map[accessKey]struct{}),
+	}
+}
+
+// PrepareAccessList prepares the access list of a transaction, recording
+// its accesses.
+func (s *StateDB) PrepareAccessList(sender common.Address, dst *common.Address, precompiles []common.Address, list types.AccessList) {
+	s.StateDB.PrepareAccessList(sender, dst, precompiles, list)
+	s.accessed = make(map[accessKey]struct{})
+	s.accessed[accessKey{address: sender}] = struct{}{}
+	if dst != nil {
+		s.accessed[accessKey{address: *dst}] = struct{}{}
+	}
+	for _, address := range precompiles {
+		s.accessed[accessKey{address: address}] = struct{}{}
+	}
+	for _, tuple := range list {
+		s.accessed[accessKey{address: tuple.Address}] = struct{}{}
+		for _, slot := range tuple.StorageKeys {
+			s.accessed[accessKey{address: tuple.Address, slot: slot, isSlot: true}] = struct{}{}
+		}
+	}
+}
+
+// warmAddress adds address to the access list outside of the execution, so
+// that the access isn't recorded as cold.
+func (s *StateDB) warmAddress(address common.Address) {
+	s.accessed[accessKey{address: address}] = struct{}{}
+	s.StateDB.AddAddressToAccessList(address)
+}
+
+// AddAddressToAccessList adds address to the access list, recording the
+// access as cold if it wasn't in the access list yet.
+func (s *StateDB) AddAddressToAccessList(address common.Address) {
+	if !s.StateDB.AddressInAccessList(address) {
+		s.coldAccesses[accessKey{address: address}] = struct{}{}
+	}
+	s.accessed[accessKey{address: address}] = struct{}{}
+	s.StateDB.AddAddressToAccessList(address)
+}
+
+// AddSlotToAccessList adds (address, slot) to the access list, recording
+// the access as cold if it wasn't in the access list yet.
+func (s *StateDB) AddSlotToAccessList(address common.Address, slot common.Hash) {
+	if _, slotOk := s.StateDB.SlotInAccessList(address, slot); !slotOk {
+		s.coldAccesses[accessKey{address: address, slot: slot, isSlot: true}] = struct{}{}
+	}
+	s.accessed[accessKey{address: address}] = struct{}{}
+	s.accessed[accessKey{address: address, slot: slot, isSlot: true}] = struct{}{}
+	s.StateDB.AddSlotToAccessList(address, slot)
+}
+
+// takeColdAccesses returns the cold accesses recorded since the last call,
+// and starts recording anew.
+func (s *StateDB) takeColdAccesses() map[accessKey]struct{} {
+	if len(s.coldAccesses) == 0 {
+		return nil
+	}
+	accesses := s.coldAccesses
+	s.coldAccesses = make(map[accessKey]struct{})
+	return accesses
+}
+
+// takeAccessList returns the access list, which is made of the recorded
+// accesses which weren't reverted, sorted, and starts recording anew.
+func (s *StateDB) takeAccessList() types.AccessList {
+	slots := make(map[common.Address][]common.Hash)
+	for key := range s.accessed {
+		if !key.isSlot {
+			if _, ok := slots[key.address]; !ok && s.StateDB.AddressInAccessList(key.address) {
+				slots[key.address] = []common.Hash{}
+			}
+		} else if _, slotOk := s.StateDB.SlotInAccessList(key.address, key.slot); slotOk {
+			slots[key.address] = append(slots[key.address], key.slot)
+		}
+	}
+	s.accessed = make(map[accessKey]struct{})
+
+	accessList := make(types.AccessList, 0, len(slots))
+	for address, keys := range slots {
+		sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+		accessList = append(accessList, types.AccessTuple{Address: address, StorageKeys: keys})
+	}
+	sort.Slice(accessList, func(i, j int) bool {
+		return bytes.Compare(accessList[i].Address[:], accessList[j].Address[:]) < 0
+	})
+	return accessList
+}
+
+// AddRefund adds gas to the refund counter, recording the change.
+func (s *StateDB) AddRefund(gas uint64) {
+	s.refundDelta += int64(gas)
+	s.StateDB.AddRefund(gas)
+}
+
+// SubRefund removes gas from the refund counter, recording the change.
+func (s *StateDB) SubRefund(gas uint64) {
+	s.refundDelta -= int64(gas)
+	s.StateDB.SubRefund(gas)
+}
+
+// takeRefundDelta returns the change of the refund counter since the last
+// call, and starts recording anew.
+func (s *StateDB) takeRefundDelta() int64 {
+	delta := s.refundDelta
+	s.refundDelta = 0
+	return delta
+}
+
+// hideSenderCode makes the code hash of sender read as the empty one until
+// the transaction starts after its checks, so that geth doesn't reject it by
+// EIP-3607.
+func (s *StateDB) hideSenderCode(sender common.Address) {
+	s.hiddenCode = &sender
+	s.onTxStart = append(s.onTxStart, func() { s.hiddenCode = nil })
+}
+
+// startTx calls the functions of onTxStart.
+func (s *StateDB) startTx() {
+	onTxStart := s.onTxStart
+	s.onTxStart = nil
+	for _, f := range onTxStart {
+		f()
+	}
+}
+
+// GetCodeHash returns the code hash of address, see hideSenderCode.
+func (s *StateDB) GetCodeHash(address common.Address) common.Hash {
+	s.recordAccountPreimage(address)
+	if s.hiddenCode != nil && *s.hiddenCode == address {
+		return emptyCodeHash
+	}
+	return s.StateDB.GetCodeHash(address)
+}
+
+// GetCode returns the code of address, which is the code of its delegate if
+// it is delegated by EIP-7702, see parseDelegation.
+func (s *StateDB) GetCode(address common.Address) []byte {
+	s.recordAccountPreimage(address)
+	code := s.StateDB.GetCode(address)
+	if delegate, ok := parseDelegation(code); ok {
+		s.recordAccountPreimage(delegate)
+		return s.StateDB.GetCode(delegate)
+	}
+	return code
+}
+
+// Snapshot returns a snapshot of the state, and calls the functions of
+// onTxStart.
+func (s *StateDB) Snapshot() int {
+	s.startTx()
+	return s.StateDB.Snapshot()
+}
+
+// watchCoinbase starts recording the credits of coinbase.
+func (s *StateDB) watchCoinbase(coinbase common.Address) {
+	s.coinbase = coinbase
+	s.coinbaseCredit = nil
+	s.coinbaseCreated = false
+}
+
+// AddBalance adds amount to the balance of address, recording the credits of
+// the watched coinbase, see clampCoinbaseCredit, and the state of address
+// before.
+func (s *StateDB) AddBalance(address common.Address, amount *big.Int) {
+	s.recordPreState(address)
+	if address == s.coinbase {
+		if s.clampCoinbaseCredit && amount.Sign() < 0 {
+			amount = new(big.Int)
+		}
+		s.coinbaseCredit = new(big.Int).Set(amount)
+		s.coinbaseCreated = !s.StateDB.Exist(address)
+	}
+	s.StateDB.AddBalance(address, amount)
+}
+
+// takeCoinbaseCredit returns the last credit of the watched coinbase, which is
+// the fee paid to it at the end of a transaction, and whether it created the
+// coinbase account. A credit of zero creates an empty account, which isn't
+// kept if deleteEmptyObjects is set by EIP-158.
+func (s *StateDB) takeCoinbaseCredit(deleteEmptyObjects bool) (*big.Int, bool) {
+	credit, created := s.coinbaseCredit, s.coinbaseCreated
+	if credit == nil {
+		credit = new(big.Int)
+	}
+	if deleteEmptyObjects && credit.Sign() <= 0 {
+		created = false
+	}
+	s.coinbaseCredit = nil
+	s.coinbaseCreated = false
+	return credit, created
+}
@@ -0,0 +1,179 @@
+package gethutil
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// AccountStateRes is the state of an account.
+type AccountStateRes struct {
+	Balance *hexutil.Big                `json:"balance"`
+	Nonce   hexutil.Uint64              `json:"nonce"`
+	Code    hexutil.Bytes               `json:"code"`
+	Storage map[common.Hash]common.Hash `json:"storage"`
+}
+
+// AccountDiffRes is the change of an account by a transaction, with the
+// storage restricted to the written slots which changed. Pre is nil if the
+// account didn't exist before the transaction, and Post if it doesn't exist
+// after it.
+type AccountDiffRes struct {
+	Pre  *AccountStateRes `json:"pre"`
+	Post *AccountStateRes `json:"post"`
+}
+
+// accountState is the state of an account before the first write of a
+// transaction, with the values of the written slots before their first
+// write.
+type accountState struct {
+	exists  bool
+	balance *big.Int
+	nonce   uint64
+	code    []byte
+	storage map[common.Hash]common.Hash
+}
+
+// watchState starts recording the state of the accounts written to, see
+// takeStateDiff.
+func (s *StateDB) watchState() {
+	s.preState = make(map[common.Address]*accountState)
+}
+
+// recordPreState records the state of address before its first write since
+// watchState.
+func (s *StateDB) recordPreState(address common.Address) {
+	s.recordTouch(address)
+	s.recordAccountPreimage(address)
+	if s.preState == nil {
+		return
+	}
+	if _, ok := s.preState[address]; ok {
+		return
+	}
+	s.preState[address] = &accountState{
+		exists:  s.StateDB.Exist(address),
+		balance: new(big.Int).Set(s.StateDB.GetBalance(address)),
+		nonce:   s.StateDB.GetNonce(address),
+		code:    common.CopyBytes(s.StateDB.GetCode(address)),
+		storage: make(map[common.Hash]common.Hash),
+	}
+}
+
+// recordPreSlot records the value of the slot key of address before its
+// first write since watchState.
+func (s *StateDB) recordPreSlot(address common.Address, key common.Hash) {
+	s.recordTouch(address)
+	s.recordSlotPreimage(address, key)
+	if s.preState == nil {
+		return
+	}
+	s.recordPreState(address)
+	if storage := s.preState[address].storage; storage != nil {
+		if _, ok := storage[key]; !ok {
+			storage[key] = s.StateDB.GetState(address, key)
+		}
+	}
+}
+
+// takeStateDiff returns the changes of the accounts written to since
+// watchState, and stops recording. The accounts which didn't change are
+// omitted.
+func (s *StateDB) takeStateDiff() map[common.Address]*AccountDiffRes {
+	preState := s.preState
+	s.preState = nil
+	if len(preState) == 0 {
+		return nil
+	}
+
+	diff := make(map[common.Address]*AccountDiffRes)
+	for address, pre := range preState {
+		accountDiff := &AccountDiffRes{}
+		if pre.exists {
+			accountDiff.Pre = &AccountStateRes{
+				Balance: (*hexutil.Big)(pre.balance),
+				Nonce:   hexutil.Uint64(pre.nonce),
+				Code:    pre.code,
+				Storage: make(map[common.Hash]common.Hash),
+			}
+		}
+		if s.StateDB.Exist(address) {
+			accountDiff.Post = &AccountStateRes{
+				Balance: (*hexutil.Big)(new(big.Int).Set(s.StateDB.GetBalance(address))),
+				Nonce:   hexutil.Uint64(s.StateDB.GetNonce(address)),
+				Code:    common.CopyBytes(s.StateDB.GetCode(address)),
+				Storage: make(map[common.Hash]common.Hash),
+			}
+		}
+		storageChanged := false
+		for key, value := range pre.storage {
+			var post common.Hash
+			if accountDiff.Post != nil {
+				post = s.StateDB.GetState(address, key)
+			}
+			if post == value {
+				continue
+			}
+			storageChanged = true
+			if accountDiff.Pre != nil {
+				accountDiff.Pre.Storage[key] = value
+			}
+			if accountDiff.Post != nil {
+				accountDiff.Post.Storage[key] = post
+			}
+		}
+		if !storageChanged && accountStateEqual(accountDiff.Pre, accountDiff.Post) {
+			continue
+		}
+		diff[address] = accountDiff
+	}
+	return diff
+}
+
+// accountStateEqual returns whether a and b have the same balance, nonce and
+// code, or are both nil.
+func accountStateEqual(a, b *AccountStateRes) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Balance.ToInt().Cmp(b.Balance.ToInt()) == 0 && a.Nonce == b.Nonce && bytes.Equal(a.Code, b.Code)
+}
+
+// CreateAccount creates address, recording its state before.
+func (s *StateDB) CreateAccount(address common.Address) {
+	s.recordPreState(address)
+	s.StateDB.CreateAccount(address)
+}
+
+// SubBalance subtracts amount from the balance of address, recording its
+// state before.
+func (s *StateDB) SubBalance(address common.Address, amount *big.Int) {
+	s.recordPreState(address)
+	s.StateDB.SubBalance(address, amount)
+}
+
+// SetNonce sets the nonce of address, recording its state before.
+func (s *StateDB) SetNonce(address common.Address, nonce uint64) {
+	s.recordPreState(address)
+	s.StateDB.SetNonce(address, nonce)
+}
+
+// SetCode sets the code of address, recording its state before.
+func (s *StateDB) SetCode(address common.Address, code []byte) {
+	s.recordPreState(address)
+	s.StateDB.SetCode(address, code)
+}
+
+// SetState sets the slot key of address, recording its value before.
+func (s *StateDB) SetState(address common.Address, key, value common.Hash) {
+	s.recordPreSlot(address, key)
+	s.StateDB.SetState(address, key, value)
+}
+
+// Suicide marks address as self-destructed, recording its state before.
+func (s *StateDB) Suicide(address common.Address) bool {
+	s.recordPreState(address)
+	return s.StateDB.Suicide(address)
+}
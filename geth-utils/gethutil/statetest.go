@@ -0,0 +1,170 @@
+package gethutil
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// StateTest is a case of the GeneralStateTests of the Ethereum tests.
+// Modified from github.com/ethereum/go-ethereum/tests.StateTest
+type StateTest struct {
+	Env  StateTestEnv               `json:"env"`
+	Pre  core.GenesisAlloc          `json:"pre"`
+	Tx   StateTestTransaction       `json:"transaction"`
+	Post map[string][]StateTestPost `json:"post"`
+}
+
+type StateTestEnv struct {
+	Coinbase   common.Address        `json:"currentCoinbase"`
+	Difficulty *math.HexOrDecimal256 `json:"currentDifficulty"`
+	GasLimit   math.HexOrDecimal64   `json:"currentGasLimit"`
+	Number     math.HexOrDecimal64   `json:"currentNumber"`
+	Timestamp  math.HexOrDecimal64   `json:"currentTimestamp"`
+	BaseFee    *math.HexOrDecimal256 `json:"currentBaseFee"`
+	Random     *common.Hash          `json:"currentRandom"`
+}
+
+// StateTestTransaction is the transaction of a StateTest, whose data, gas
+// limit and value are chosen by the indexes of a StateTestPost.
+type StateTestTransaction struct {
+	GasPrice             *math.HexOrDecimal256 `json:"gasPrice"`
+	MaxFeePerGas         *math.HexOrDecimal256 `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *math.HexOrDecimal256 `json:"maxPriorityFeePerGas"`
+	Nonce                math.HexOrDecimal64   `json:"nonce"`
+	To                   string                `json:"to"`
+	Data                 []string              `json:"data"`
+	AccessLists          []*types.AccessList   `json:"accessLists"`
+	GasLimit             []math.HexOrDecimal64 `json:"gasLimit"`
+	Value                []string              `json:"value"`
+	SecretKey            hexutil.Bytes         `json:"secretKey"`
+}
+
+// StateTestPost is an expected outcome of a StateTest in a fork.
+type StateTestPost struct {
+	Root            common.Hash `json:"hash"`
+	Logs            common.Hash `json:"logs"`
+	ExpectException string      `json:"expectException"`
+	Indexes         struct {
+		Data  int `json:"data"`
+		Gas   int `json:"gas"`
+		Value int `json:"value"`
+	} `json:"indexes"`
+}
+
+// TraceConfig returns the TraceConfig of the index-th post state of t in
+// fork, which returns the transaction as rejected if it's invalid.
+func (t *StateTest) TraceConfig(fork string, index int) (TraceConfig, error) {
+	post := t.Post[fork][index]
+	if post.Indexes.Data >= len(t.Tx.Data) || post.Indexes.Gas >= len(t.Tx.GasLimit) || post.Indexes.Value >= len(t.Tx.Value) {
+		return TraceConfig{}, fmt.Errorf("tx indexes out of range")
+	}
+
+	key, err := crypto.ToECDSA(t.Tx.SecretKey)
+	if err != nil {
+		return TraceConfig{}, fmt.Errorf("invalid secret key: %w", err)
+	}
+	var to *common.Address
+	if t.Tx.To != "" {
+		address := common.HexToAddress(t.Tx.To)
+		to = &address
+	}
+	value := new(big.Int)
+	if valueHex := t.Tx.Value[post.Indexes.Value]; valueHex != "0x" {
+		var ok bool
+		if value, ok = math.ParseBig256(valueHex); !ok {
+			return TraceConfig{}, fmt.Errorf("invalid tx value %q", valueHex)
+		}
+	}
+	nonce := hexutil.Uint64(t.Tx.Nonce)
+	tx := Transaction{
+		From:      crypto.PubkeyToAddress(key.PublicKey),
+		To:        to,
+		Nonce:     &nonce,
+		Value:     (*hexutil.Big)(value),
+		GasLimit:  hexutil.Uint64(t.Tx.GasLimit[post.Indexes.Gas]),
+		GasPrice:  (*hexutil.Big)(t.Tx.GasPrice),
+		GasFeeCap: (*hexutil.Big)(t.Tx.MaxFeePerGas),
+		GasTipCap: (*hexutil.Big)(t.Tx.MaxPriorityFeePerGas),
+		CallData:  common.FromHex(t.Tx.Data[post.Indexes.Data]),
+	}
+	if post.Indexes.Data < len(t.Tx.AccessLists) && t.Tx.AccessLists[post.Indexes.Data] != nil {
+		for _, tuple := range *t.Tx.AccessLists[post.Indexes.Data] {
+			tx.AccessList = append(tx.AccessList, struct {
+				Address     common.Address `json:"address"`
+				StorageKeys []common.Hash  `json:"storage_keys"`
+			}{tuple.Address, tuple.StorageKeys})
+		}
+	}
+
+	return TraceConfig{
+		ChainID: (*hexutil.Big)(big.NewInt(1)),
+		Block: Block{
+			Coinbase:   t.Env.Coinbase,
+			Timestamp:  (*hexutil.Big)(new(big.Int).SetUint64(uint64(t.Env.Timestamp))),
+			Number:     (*hexutil.Big)(new(big.Int).SetUint64(uint64(t.Env.Number))),
+			Difficulty: (*hexutil.Big)(t.Env.Difficulty),
+			GasLimit:   (*hexutil.Big)(new(big.Int).SetUint64(uint64(t.Env.GasLimit))),
+			BaseFee:    (*hexutil.Big)(t.Env.BaseFee),
+			Random:     t.Env.Random,
+		},
+		Accounts:       genesisAccounts(t.Pre),
+		Transactions:   []Transaction{tx},
+		ReturnRejected: true,
+		Fork:           fork,
+		// Same as the block hashes of the geth state test runner
+		GetHash: func(n uint64) common.Hash {
+			return crypto.Keccak256Hash([]byte(new(big.Int).SetUint64(n).String()))
+		},
+	}, nil
+}
+
+// genesisAccounts returns the accounts of a genesis alloc.
+func genesisAccounts(alloc core.GenesisAlloc) map[common.Address]Account {
+	accounts := make(map[common.Address]Account, len(alloc))
+	for address, account := range alloc {
+		accounts[address] = Account{
+			Nonce:   hexutil.Uint64(account.Nonce),
+			Balance: (*hexutil.Big)(account.Balance),
+			Code:    account.Code,
+			Storage: account.Storage,
+		}
+	}
+	return accounts
+}
+
+// Run runs the index-th post state of t in fork, and checks that the
+// transaction is rejected if and only if an exception is expected, and the
+// post state root. Unlike the geth runner, the coinbase isn't touched by a
+// rejected transaction, which only matters before EIP-158.
+func (t *StateTest) Run(fork string, index int) (*ExecutionResult, error) {
+	config, err := t.TraceConfig(fork, index)
+	if err != nil {
+		return nil, err
+	}
+	post := t.Post[fork][index]
+	bundleResult, err := TraceBundle(BundleConfig{TraceConfig: config})
+	if err != nil {
+		// A transaction of a type not supported by fork fails the validation
+		// of the config rather than being rejected.
+		if post.ExpectException != "" && AsTraceError(err).Code == ErrCodeInvalidConfig {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	result := bundleResult.Results[0]
+	if expected := post.ExpectException != ""; result.Rejected != expected {
+		return result, fmt.Errorf("rejected: %v, expected exception: %q", result.Rejected, post.ExpectException)
+	}
+	if root := bundleResult.StateRoots[0]; root != post.Root {
+		return result, fmt.Errorf("post state root mismatch: got %x, want %x", root, post.Root)
+	}
+	return result, nil
+}
@@ -0,0 +1,116 @@
+package gethutil
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// StepError is an entry of the table of the errors of the steps, which is the
+// single source of the error strings of StructLogRes.Error and of the
+// constants matching them on the Rust side.
+type StepError struct {
+	Name    string        `json:"name"`
+	Kind    ExecErrorKind `json:"kind"`
+	Message string        `json:"message"`
+
+	// is returns whether a geth error is the error of the entry.
+	is func(err error) bool
+}
+
+func isError(target error) func(err error) bool {
+	return func(err error) bool { return errors.Is(err, target) }
+}
+
+var stepErrors = []StepError{
+	{Name: "StackOverflow", Kind: ExecErrorStackOverflow, Message: "stack limit reached", is: func(err error) bool {
+		var target *vm.ErrStackOverflow
+		return errors.As(err, &target)
+	}},
+	{Name: "StackUnderflow", Kind: ExecErrorStackUnderflow, Message: "stack underflow", is: func(err error) bool {
+		var target *vm.ErrStackUnderflow
+		return errors.As(err, &target)
+	}},
+	{Name: "InvalidOpcode", Kind: ExecErrorInvalidOpcode, Message: "invalid opcode", is: func(err error) bool {
+		var target *vm.ErrInvalidOpCode
+		return errors.As(err, &target)
+	}},
+	{Name: "OutOfGas", Kind: ExecErrorOutOfGas, Message: "out of gas", is: isError(vm.ErrOutOfGas)},
+	// Like the bus-mapping, a gas uint64 overflow is classified as an out of
+	// gas.
+	{Name: "GasUintOverflow", Kind: ExecErrorOutOfGas, Message: "gas uint64 overflow", is: isError(vm.ErrGasUintOverflow)},
+	{Name: "WriteProtection", Kind: ExecErrorWriteProtection, Message: "write protection", is: isError(vm.ErrWriteProtection)},
+	{Name: "InvalidJump", Kind: ExecErrorInvalidJump, Message: "invalid jump destination", is: isError(vm.ErrInvalidJump)},
+	{Name: "ReturnDataOutOfBounds", Kind: ExecErrorReturnDataOutOfBounds, Message: "return data out of bounds", is: isError(vm.ErrReturnDataOutOfBounds)},
+	{Name: "Depth", Kind: ExecErrorDepth, Message: "max call depth exceeded", is: isError(vm.ErrDepth)},
+	{Name: "InsufficientBalance", Kind: ExecErrorInsufficientBalance, Message: "insufficient balance for transfer", is: isError(vm.ErrInsufficientBalance)},
+	{Name: "ContractAddressCollision", Kind: ExecErrorContractAddressCollision, Message: "contract address collision", is: isError(vm.ErrContractAddressCollision)},
+	{Name: "InvalidCreationCode", Kind: ExecErrorInvalidCreationCode, Message: "invalid code: must not begin with 0xef", is: isError(vm.ErrInvalidCode)},
+	{Name: "CodeStoreOutOfGas", Kind: ExecErrorCodeStoreOutOfGas, Message: "contract creation code storage out of gas", is: isError(vm.ErrCodeStoreOutOfGas)},
+	{Name: "MaxCodeSizeExceeded", Kind: ExecErrorMaxCodeSizeExceeded, Message: "max code size exceeded", is: isError(vm.ErrMaxCodeSizeExceeded)},
+}
+
+// lookupStepError returns the entry of the geth error err of a step, or nil if
+// it has none.
+func lookupStepError(err error) *StepError {
+	for i := range stepErrors {
+		if stepErrors[i].is(err) {
+			return &stepErrors[i]
+		}
+	}
+	return nil
+}
+
+// StepErrorMessage returns the message of the geth error err of a step in
+// the table, or err.Error() if it's not in the table, or "" if err is nil.
+func StepErrorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	if entry := lookupStepError(err); entry != nil {
+		return entry.Message
+	}
+	return err.Error()
+}
+
+// StepErrors returns the table of the errors of the steps.
+func StepErrors() []StepError {
+	return append([]StepError(nil), stepErrors...)
+}
+
+// WriteStepErrorsJSON writes the table of the errors of the steps as JSON.
+func WriteStepErrorsJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(stepErrors)
+}
+
+// WriteStepErrorsRust writes the table of the errors of the steps as Rust
+// constants GETH_ERR_<NAME> of their messages, each documented with the
+// message itself so that the comment can't diverge from the string.
+func WriteStepErrorsRust(w io.Writer) error {
+	p := &prettyPrinter{w: w}
+	p.printf("// Code generated by `gethutil errors -format rust`. DO NOT EDIT.\n")
+	for _, entry := range stepErrors {
+		p.printf("\n/// Geth error message `%s`\n", entry.Message)
+		p.printf("pub const GETH_ERR_%s: &str = %q;\n", strings.ToUpper(strings.Join(splitCamelCase(entry.Name), "_")), entry.Message)
+	}
+	return p.err
+}
+
+// splitCamelCase splits a CamelCase name into its words.
+func splitCamelCase(name string) []string {
+	var words []string
+	start := 0
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) {
+			words = append(words, name[start:i])
+			start = i
+		}
+	}
+	return append(words, name[start:])
+}
@@ -0,0 +1,54 @@
+package gethutil
+
+// OpcodeStats are the statistics of an opcode in a trace.
+type OpcodeStats struct {
+	Count int `json:"count"`
+	// Gas is the total gas cost of the steps of the opcode, which includes
+	// the gas sent to the callees by the call opcodes.
+	Gas uint64 `json:"gas"`
+}
+
+// TraceSummary is a profile of a trace.
+type TraceSummary struct {
+	// Steps is the number of captured steps, which the fields other than
+	// RW cover.
+	Steps         int                     `json:"steps"`
+	Opcodes       map[string]*OpcodeStats `json:"opcodes"`
+	MaxDepth      int                     `json:"maxDepth"`
+	MaxMemorySize int                     `json:"maxMemorySize"`
+	MaxStackSize  int                     `json:"maxStackSize"`
+	// RW is set for the summaries of Trace, since it's estimated from the
+	// full stacks of the steps. Unlike the other fields, it covers all the
+	// executed steps, see RWEstimate.
+	RW *RWEstimate `json:"rw,omitempty"`
+}
+
+// Summarize returns the summary of the steps of result, without RW.
+func Summarize(result *ExecutionResult) *TraceSummary {
+	logs := result.StructLogs.Formatted()
+	summary := &TraceSummary{
+		Steps:   len(logs),
+		Opcodes: make(map[string]*OpcodeStats),
+	}
+	for i := range logs {
+		step := &logs[i]
+		stats, ok := summary.Opcodes[step.Op]
+		if !ok {
+			stats = new(OpcodeStats)
+			summary.Opcodes[step.Op] = stats
+		}
+		stats.Count++
+		stats.Gas += step.GasCost
+
+		if step.Depth > summary.MaxDepth {
+			summary.MaxDepth = step.Depth
+		}
+		if step.MemorySize > summary.MaxMemorySize {
+			summary.MaxMemorySize = step.MemorySize
+		}
+		if step.StackSize > summary.MaxStackSize {
+			summary.MaxStackSize = step.StackSize
+		}
+	}
+	return summary
+}
@@ -0,0 +1,27 @@
+package gethutil
+
+import "testing"
+
+// TestSummaryTruncated checks that the RW estimate of a truncated trace
+// covers all its executed steps, unlike the rest of its summary.
+func TestSummaryTruncated(t *testing.T) {
+	config := loopConfig()
+	config.TracerOptions.Summary = true
+	full, err := Trace(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.TracerOptions.MaxSteps = 5
+	truncated, err := Trace(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary := truncated[0].Summary
+	if !truncated[0].Truncated || summary.Steps != 5 {
+		t.Fatalf("got %d captured steps, truncated %v, want 5, true", summary.Steps, truncated[0].Truncated)
+	}
+	if got, want := *summary.RW, *full[0].Summary.RW; got != want {
+		t.Fatalf("rw: got %+v, want %+v", got, want)
+	}
+}
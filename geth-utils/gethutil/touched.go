@@ -0,0 +1,54 @@
+package gethutil
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// watchTouches starts recording the accounts touched, see
+// finaliseTouched.
+func (s *StateDB) watchTouches() {
+	s.touched = make(map[common.Address]bool)
+}
+
+// recordTouch records whether address existed before its first touch since
+// watchTouches.
+func (s *StateDB) recordTouch(address common.Address) {
+	if s.touched == nil {
+		return
+	}
+	if _, ok := s.touched[address]; !ok {
+		s.touched[address] = s.StateDB.Exist(address)
+	}
+}
+
+// finaliseTouched finalises the transaction like Finalise, and returns the
+// accounts which existed before their first touch since watchTouches and
+// were deleted by EIP-161 as empty, sorted, and stops recording. The
+// self-destructed accounts aren't returned.
+func (s *StateDB) finaliseTouched(deleteEmptyObjects bool) []common.Address {
+	var empty []common.Address
+	if deleteEmptyObjects {
+		for address, existed := range s.touched {
+			if existed && s.StateDB.Exist(address) && s.StateDB.Empty(address) && !s.StateDB.HasSuicided(address) {
+				empty = append(empty, address)
+			}
+		}
+	}
+	s.touched = nil
+	s.StateDB.Finalise(deleteEmptyObjects)
+
+	// Finalise only deletes the accounts whose touch wasn't reverted.
+	var deleted []common.Address
+	for _, address := range empty {
+		if !s.StateDB.Exist(address) {
+			deleted = append(deleted, address)
+		}
+	}
+	sort.Slice(deleted, func(i, j int) bool {
+		return bytes.Compare(deleted[i][:], deleted[j][:]) < 0
+	})
+	return deleted
+}
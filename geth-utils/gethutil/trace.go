@@ -1,84 +1,412 @@
 package gethutil
 
 import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
+	"runtime"
+	"sync"
+	"time"
 
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
-	"github.com/ethereum/go-ethereum/eth/tracers/logger"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
 )
 
+// TraceSchemaVersion is the version of the schema of ExecutionResult, which
+// must be bumped whenever its serialization changes incompatibly, so that the
+// consumers detect a mismatched build of the library.
+const TraceSchemaVersion = 1
+
 // Copied from github.com/ethereum/go-ethereum/internal/ethapi.ExecutionResult
 // ExecutionResult groups all structured logs emitted by the EVM
 // while replaying a transaction in debug mode as well as transaction
 // execution status, the amount of gas used and the return value
 type ExecutionResult struct {
-	Gas         uint64         `json:"gas"`
-	Failed      bool           `json:"failed"`
-	ReturnValue string         `json:"returnValue"`
-	StructLogs  []StructLogRes `json:"structLogs"`
+	// Version is TraceSchemaVersion.
+	Version     int        `json:"version"`
+	Gas         uint64     `json:"gas"`
+	Failed      bool       `json:"failed"`
+	ReturnValue string     `json:"returnValue"`
+	StructLogs  StructLogs `json:"structLogs"`
+	// Error classifies the failure of the execution when Failed is set.
+	Error *TraceError `json:"error,omitempty"`
+	// RevertReason is the decoded reason of a reverted execution.
+	RevertReason string `json:"revertReason,omitempty"`
+	// Calls are the call frames in the order they were entered.
+	Calls []CallRes `json:"calls,omitempty"`
+	// Deployments are the code deployed by the creation frames of Calls.
+	Deployments []DeploymentRes `json:"deployments,omitempty"`
+	// Bytecodes are the code run, or read by EXTCODECOPY and EXTCODEHASH,
+	// by the transaction by hash.
+	Bytecodes map[common.Hash]hexutil.Bytes `json:"bytecodes,omitempty"`
+	// AccessList is the EIP-2929 access list at the end of the transaction,
+	// which holds all the warm addresses and their warm slots.
+	AccessList types.AccessList `json:"accessList,omitempty"`
+	// BlockHashes are the lookups of the BLOCKHASH steps in order.
+	BlockHashes []BlockHashRes `json:"blockHashes,omitempty"`
+	// Logs are the logs emitted by the transaction, including the reverted
+	// ones.
+	Logs []LogRes `json:"logs,omitempty"`
+	// Decoded annotates Calls and Logs with TraceConfig.ABIs, if any.
+	Decoded *DecodedRes `json:"decoded,omitempty"`
+	// Labels are TraceConfig.Labels, for PrettyPrint.
+	Labels map[common.Address]string `json:"labels,omitempty"`
+	// StateDiff are the changes of the accounts written to by the
+	// transaction, set when TraceConfig.Output is OutputParity or
+	// TraceConfig.TrieUpdates is set.
+	StateDiff map[common.Address]*AccountDiffRes `json:"stateDiff,omitempty"`
+	// TrieUpdates are the updates of the state trie making StateDiff, set
+	// when TraceConfig.TrieUpdates is set, see TrieUpdates.
+	TrieUpdates []TrieUpdateRes `json:"trieUpdates,omitempty"`
+	// DeletedEmptyAccounts are the empty accounts which existed before the
+	// transaction and were deleted at its end by EIP-161 as it touched them,
+	// sorted.
+	DeletedEmptyAccounts []common.Address `json:"deletedEmptyAccounts,omitempty"`
+	// Preimages are the preimages by hash of the keys of the account and
+	// storage tries hashed by the transaction, i.e. the addresses of the
+	// accounts and the slots it accessed, set when TraceConfig.Preimages is
+	// set.
+	Preimages map[common.Hash]hexutil.Bytes `json:"preimages,omitempty"`
+	// Transfers are the changes of the balances of the transaction in
+	// order, including the reverted ones, set when TraceConfig.Transfers is
+	// set.
+	Transfers []TransferRes `json:"transfers,omitempty"`
+	// StateDump is the whole state after the transaction in the format of
+	// debug_dumpBlock, set when TraceConfig.DumpState is set.
+	StateDump *state.Dump `json:"stateDump,omitempty"`
+	// Rejected is set when the transaction was rejected before its execution
+	// and TraceConfig.ReturnRejected is set, in which case Error classifies
+	// the rejection and StructLogs is empty.
+	Rejected bool `json:"rejected,omitempty"`
+	// Truncated is set when the steps past TracerOptions.MaxSteps weren't
+	// captured, in which case StructLogs is partial. The rest of the result
+	// is complete.
+	Truncated bool `json:"truncated,omitempty"`
+	// Steps is the number of steps executed, including the ones which
+	// weren't captured in StructLogs, by TracerOptions or TraceWithCallback.
+	Steps int `json:"steps,omitempty"`
+	// Interrupted is set when the tracing was aborted by the cancellation of
+	// its context or its timeout, in which case StructLogs is partial and
+	// the following transactions aren't traced.
+	Interrupted bool `json:"interrupted,omitempty"`
+	// Summary is set when TracerOptions.Summary is set.
+	Summary *TraceSummary `json:"summary,omitempty"`
+	// Estimates are the estimates of TraceConfig.RowWeights and
+	// TraceConfig.StepEstimators by name, see Estimate.
+	Estimates map[string]uint64 `json:"estimates,omitempty"`
+	// ErrorStep is the index of the first step which failed, including the
+	// steps of the calls whose failure was handled by their caller, with
+	// the kinds of its error. It indexes all the steps, which are the ones
+	// in StructLogs unless TracerOptions filters them.
+	ErrorStep    *int          `json:"errorStep,omitempty"`
+	ErrorKind    ExecErrorKind `json:"errorKind,omitempty"`
+	OogErrorKind OogErrorKind  `json:"oogErrorKind,omitempty"`
+	// TracerResult is the result of TraceConfig.Tracer.
+	TracerResult json.RawMessage `json:"tracerResult,omitempty"`
+	// NativeTracerResults are the results of the ResultTracers of
+	// TraceConfig.NativeTracers by name.
+	NativeTracerResults map[string]json.RawMessage `json:"nativeTracerResults,omitempty"`
+	// TracerResults are the results of TraceConfig.Tracers by key.
+	TracerResults map[string]json.RawMessage `json:"tracerResults,omitempty"`
+	// Chunks split StructLogs when TracerOptions.ChunkSize is set.
+	Chunks []ChunkRes `json:"chunks,omitempty"`
+	// Coinbase is the change of the balance of the coinbase during the
+	// transaction, including the fees paid to it.
+	Coinbase *CoinbaseRes `json:"coinbase,omitempty"`
+	// FeeCapTooLow is set when the transaction was executed despite its fee
+	// cap below the base fee, see TraceConfig.ForceLowFeeCap.
+	FeeCapTooLow bool `json:"feeCapTooLow,omitempty"`
+	// Fees splits the fees paid by the sender, see FeesRes.
+	Fees *FeesRes `json:"fees,omitempty"`
+	// Nonce is the nonce filled for a transaction without one, see
+	// TraceConfig.AutoNonce.
+	Nonce *hexutil.Uint64 `json:"nonce,omitempty"`
+	// DefaultsApplied are the JSON names of the block constants omitted from
+	// the config, which were filled with their defaults.
+	DefaultsApplied []string `json:"defaultsApplied,omitempty"`
+}
+
+// CallRes is a call frame of a transaction, see Call.
+type CallRes struct {
+	CallID       int            `json:"callId"`
+	CallerID     int            `json:"callerId"`
+	Type         string         `json:"type"`
+	From         common.Address `json:"from"`
+	To           common.Address `json:"to"`
+	Input        hexutil.Bytes  `json:"input"`
+	Value        *hexutil.Big   `json:"value,omitempty"`
+	Gas          hexutil.Uint64 `json:"gas"`
+	GasUsed      hexutil.Uint64 `json:"gasUsed"`
+	Output       hexutil.Bytes  `json:"output"`
+	Error        string         `json:"error,omitempty"`
+	RevertReason string         `json:"revertReason,omitempty"`
+	// CreatedAddress is set for the creation frames, see Call.
+	CreatedAddress *common.Address `json:"createdAddress,omitempty"`
+	// CodeHash indexes the code of the frame in the Bytecodes of its
+	// ExecutionResult, see Call.
+	CodeHash *common.Hash `json:"codeHash,omitempty"`
+}
+
+// FormatCalls formats call frames for json output.
+func FormatCalls(calls []Call) []CallRes {
+	formatted := make([]CallRes, len(calls))
+	for i, call := range calls {
+		formatted[i] = CallRes{
+			CallID:         call.ID,
+			CallerID:       call.CallerID,
+			Type:           call.Type.String(),
+			From:           call.From,
+			To:             call.To,
+			Input:          call.Input,
+			Value:          (*hexutil.Big)(call.Value),
+			Gas:            hexutil.Uint64(call.Gas),
+			GasUsed:        hexutil.Uint64(call.GasUsed),
+			Output:         call.Output,
+			RevertReason:   call.RevertReason,
+			CreatedAddress: call.CreatedAddress,
+			CodeHash:       call.CodeHash,
+		}
+		if call.Err != nil {
+			formatted[i].Error = call.Err.Error()
+		}
+	}
+	return formatted
 }
 
 // StructLogRes stores a structured log emitted by the EVM while replaying a
 // transaction in debug mode
 // Copied from github.com/ethereum/go-ethereum/internal/ethapi.StructLogRes
 type StructLogRes struct {
-	Pc      uint64             `json:"pc"`
-	Op      string             `json:"op"`
-	Gas     uint64             `json:"gas"`
-	GasCost uint64             `json:"gasCost"`
-	Depth   int                `json:"depth"`
-	Error   string             `json:"error,omitempty"`
-	Stack   *[]string          `json:"stack,omitempty"`
-	Memory  *[]string          `json:"memory,omitempty"`
-	Storage *map[string]string `json:"storage,omitempty"`
-}
-
-// Copied from github.com/ethereum/go-ethereum/internal/ethapi.FormatLogs
-// FormatLogs formats EVM returned structured logs for json output
-func FormatLogs(logs []logger.StructLog) []StructLogRes {
+	Pc             uint64             `json:"pc"`
+	Op             string             `json:"op"`
+	Gas            uint64             `json:"gas"`
+	GasCost        uint64             `json:"gasCost"`
+	Depth          int                `json:"depth"`
+	Error          string             `json:"error,omitempty"`
+	Stack          *[]string          `json:"stack,omitempty"`
+	StackSize      int                `json:"stackSize"`
+	Memory         *[]string          `json:"memory,omitempty"`
+	MemorySize     int                `json:"memorySize"`
+	ReturnDataSize int                `json:"returnDataSize"`
+	Storage        *map[string]string `json:"storage,omitempty"`
+	Access         *AccessRes         `json:"access,omitempty"`
+	CallID         int                `json:"callId"`
+	CallerID       int                `json:"callerId"`
+	IsStatic       bool               `json:"isStatic"`
+	IsCreate       bool               `json:"isCreate"`
+	GasCosts       *GasCostRes        `json:"gasCosts,omitempty"`
+	// StorageAccess is set for SLOAD and SSTORE steps.
+	StorageAccess *StorageAccessRes `json:"storageAccess,omitempty"`
+	// CallGas is set for successful CALL, CALLCODE, DELEGATECALL and
+	// STATICCALL steps.
+	CallGas *CallGasRes `json:"callGas,omitempty"`
+}
+
+// AccessRes is the EIP-2929 access of a step, see Access.
+type AccessRes struct {
+	Address common.Address `json:"address"`
+	Slot    *common.Hash   `json:"slot,omitempty"`
+	Warm    bool           `json:"warm"`
+	Gas     uint64         `json:"gas"`
+}
+
+// GasCostRes is the decomposition of the gas cost of a step, see GasCost.
+type GasCostRes struct {
+	Constant        uint64 `json:"constant"`
+	MemoryExpansion uint64 `json:"memoryExpansion"`
+	Copy            uint64 `json:"copy"`
+	Access          uint64 `json:"access"`
+	Other           uint64 `json:"other"`
+}
+
+// CallGasRes is the gas sent by a call step to its callee, see CallGas.
+type CallGasRes struct {
+	Requested uint64  `json:"requested"`
+	Forwarded uint64  `json:"forwarded"`
+	Stipend   uint64  `json:"stipend"`
+	Returned  *uint64 `json:"returned,omitempty"`
+}
+
+// StorageAccessRes is the storage access of a step, see StorageAccess.
+type StorageAccessRes struct {
+	Address       common.Address `json:"address"`
+	Key           common.Hash    `json:"key"`
+	OriginalValue common.Hash    `json:"originalValue"`
+	CurrentValue  common.Hash    `json:"currentValue"`
+	NewValue      common.Hash    `json:"newValue"`
+	GasCost       uint64         `json:"gasCost"`
+	RefundDelta   int64          `json:"refundDelta"`
+}
+
+// StructLogs are the steps of an ExecutionResult. The steps of a traced
+// result are kept as captured, and only formatted into StructLogRes by the
+// first call to Formatted, which drops the captured steps, so a StructLogs
+// holds a single form of its steps. Until then, encoding the result encodes
+// the captured steps directly, see WriteResults.
+//
+// Formatted modifies the StructLogs, which isn't safe for concurrent use
+// until it is formatted.
+type StructLogs struct {
+	captured  []StructLog
+	formatted []StructLogRes
+}
+
+// NewStructLogs returns the StructLogs of the formatted steps logs.
+func NewStructLogs(logs []StructLogRes) StructLogs {
+	return StructLogs{formatted: logs}
+}
+
+// capturedStructLogs returns the StructLogs of the captured steps logs, which
+// are encoded as an empty array rather than null if there are none, like
+// the ones formatted by FormatLogs.
+func capturedStructLogs(logs []StructLog) StructLogs {
+	if logs == nil {
+		logs = []StructLog{}
+	}
+	return StructLogs{captured: logs}
+}
+
+// Len returns the number of steps.
+func (s *StructLogs) Len() int {
+	if s.captured != nil {
+		return len(s.captured)
+	}
+	return len(s.formatted)
+}
+
+// Formatted returns the steps, formatted by FormatLogs on the first call.
+// The steps are encoded from the returned slice afterwards, including the
+// changes made to it.
+func (s *StructLogs) Formatted() []StructLogRes {
+	if s.captured != nil {
+		s.formatted = FormatLogs(s.captured)
+		s.captured = nil
+	}
+	return s.formatted
+}
+
+// Modified from github.com/ethereum/go-ethereum/internal/ethapi.FormatLogs
+// FormatLogs formats EVM returned structured logs for json output.
+// The stack and memory words of a step are hex encoded into a single string,
+// which the formatted words are slices of, instead of allocating a string per
+// word.
+func FormatLogs(logs []StructLog) []StructLogRes {
 	formatted := make([]StructLogRes, len(logs))
+	var buf []byte
 	for index, trace := range logs {
 		formatted[index] = StructLogRes{
-			Pc:      trace.Pc,
-			Op:      trace.Op.String(),
-			Gas:     trace.Gas,
-			GasCost: trace.GasCost,
-			Depth:   trace.Depth,
-			Error:   trace.ErrorString(),
+			Pc:             trace.Pc,
+			Op:             trace.Op.String(),
+			Gas:            trace.Gas,
+			GasCost:        trace.GasCost,
+			Depth:          trace.Depth,
+			Error:          StepErrorMessage(trace.Err),
+			StackSize:      trace.StackSize,
+			CallID:         trace.CallID,
+			CallerID:       trace.CallerID,
+			IsStatic:       trace.IsStatic,
+			IsCreate:       trace.IsCreate,
+			MemorySize:     trace.MemorySize,
+			ReturnDataSize: trace.ReturnDataSize,
 		}
 		if trace.Stack != nil {
+			buf = buf[:0]
+			ends := make([]int, len(trace.Stack))
+			for i := range trace.Stack {
+				buf = appendHexQuantity(buf, &trace.Stack[i])
+				ends[i] = len(buf)
+			}
+			encoded := string(buf)
 			stack := make([]string, len(trace.Stack))
-			for i, stackValue := range trace.Stack {
-				stack[i] = stackValue.Hex()
+			start := 0
+			for i, end := range ends {
+				stack[i] = encoded[start:end]
+				start = end
 			}
 			formatted[index].Stack = &stack
 		}
 		if trace.Memory != nil {
-			memory := make([]string, 0, (len(trace.Memory)+31)/32)
-			for i := 0; i+32 <= len(trace.Memory); i += 32 {
-				memory = append(memory, fmt.Sprintf("%x", trace.Memory[i:i+32]))
+			words := len(trace.Memory) / 32
+			encoded := hex.EncodeToString(trace.Memory[:words*32])
+			memory := make([]string, words)
+			for i := range memory {
+				memory[i] = encoded[i*64 : (i+1)*64]
 			}
 			formatted[index].Memory = &memory
 		}
 		if trace.Storage != nil {
-			storage := make(map[string]string)
+			storage := make(map[string]string, len(trace.Storage))
 			for i, storageValue := range trace.Storage {
-				storage[fmt.Sprintf("%x", i)] = fmt.Sprintf("%x", storageValue)
+				storage[hex.EncodeToString(i[:])] = hex.EncodeToString(storageValue[:])
 			}
 			formatted[index].Storage = &storage
 		}
+		if trace.Access != nil {
+			formatted[index].Access = &AccessRes{
+				Address: trace.Access.Address,
+				Slot:    trace.Access.Slot,
+				Warm:    trace.Access.Warm,
+				Gas:     trace.Access.Gas,
+			}
+		}
+		if gasCosts := trace.GasCosts; gasCosts != nil {
+			formatted[index].GasCosts = &GasCostRes{
+				Constant:        gasCosts.Constant,
+				MemoryExpansion: gasCosts.MemoryExpansion,
+				Copy:            gasCosts.Copy,
+				Access:          gasCosts.Access,
+				Other:           gasCosts.Other,
+			}
+		}
+		if access := trace.StorageAccess; access != nil {
+			formatted[index].StorageAccess = &StorageAccessRes{
+				Address:       access.Address,
+				Key:           access.Key,
+				OriginalValue: access.Original,
+				CurrentValue:  access.Current,
+				NewValue:      access.New,
+				GasCost:       access.GasCost,
+				RefundDelta:   access.RefundDelta,
+			}
+		}
+		if callGas := trace.CallGas; callGas != nil {
+			formatted[index].CallGas = &CallGasRes{
+				Requested: callGas.Requested,
+				Forwarded: callGas.Forwarded,
+				Stipend:   callGas.Stipend,
+				Returned:  callGas.Returned,
+			}
+		}
 	}
 	return formatted
 }
 
+// appendHexQuantity appends v to buf as a 0x-prefixed hex quantity without
+// leading zeros, the same as v.Hex().
+func appendHexQuantity(buf []byte, v *uint256.Int) []byte {
+	var encoded [64]byte
+	word := v.Bytes32()
+	hex.Encode(encoded[:], word[:])
+	start := 0
+	for start < len(encoded)-1 && encoded[start] == '0' {
+		start++
+	}
+	buf = append(buf, "0x"...)
+	return append(buf, encoded[start:]...)
+}
+
 type Block struct {
 	Coinbase   common.Address `json:"coinbase"`
 	Timestamp  *hexutil.Big   `json:"timestamp"`
@@ -86,6 +414,24 @@ type Block struct {
 	Difficulty *hexutil.Big   `json:"difficulty"`
 	GasLimit   *hexutil.Big   `json:"gas_limit"`
 	BaseFee    *hexutil.Big   `json:"base_fee"`
+	// Random is the randomness of the beacon chain returned by the
+	// DIFFICULTY opcode (PREVRANDAO) past the Merge, where Difficulty is
+	// ignored.
+	Random *common.Hash `json:"random"`
+	// Reward is credited to the coinbase after the transactions by
+	// TraceBlock.
+	Reward *hexutil.Big `json:"reward"`
+	// Withdrawals are credited after the transactions by TraceBlock.
+	Withdrawals []Withdrawal `json:"withdrawals"`
+	// ParentBeaconBlockRoot is stored in the beacon roots contract before
+	// the transactions, see processBeaconRoot.
+	ParentBeaconBlockRoot *common.Hash `json:"parent_beacon_block_root"`
+	// ExtraData, MixHash and Nonce are only part of the header of the block,
+	// see NewHeader. MixHash and Nonce are the proof of work, and so are
+	// ignored past the Merge.
+	ExtraData hexutil.Bytes    `json:"extra_data"`
+	MixHash   common.Hash      `json:"mix_hash"`
+	Nonce     types.BlockNonce `json:"nonce"`
 }
 
 type Account struct {
@@ -93,12 +439,19 @@ type Account struct {
 	Balance *hexutil.Big                `json:"balance"`
 	Code    hexutil.Bytes               `json:"code"`
 	Storage map[common.Hash]common.Hash `json:"storage"`
+	// CodeHash references the code in TraceConfig.Codes, in place of Code.
+	CodeHash *common.Hash `json:"code_hash"`
+	// CodeFile and StorageFile are the paths of files holding the code, in
+	// hex, and the storage, in JSON, in place of Code and Storage. They are
+	// read when the state is set up.
+	CodeFile    string `json:"code_file"`
+	StorageFile string `json:"storage_file"`
 }
 
 type Transaction struct {
 	From       common.Address  `json:"from"`
 	To         *common.Address `json:"to"`
-	Nonce      hexutil.Uint64  `json:"nonce"`
+	Nonce      *hexutil.Uint64 `json:"nonce"`
 	Value      *hexutil.Big    `json:"value"`
 	GasLimit   hexutil.Uint64  `json:"gas_limit"`
 	GasPrice   *hexutil.Big    `json:"gas_price"`
@@ -109,6 +462,28 @@ type Transaction struct {
 		Address     common.Address `json:"address"`
 		StorageKeys []common.Hash  `json:"storage_keys"`
 	} `json:"access_list"`
+	// Deposit makes an L2 deposit transaction, which isn't signed and pays
+	// no gas price. Its sender is credited Mint before its execution, which
+	// is kept even if the transaction fails, and its nonce isn't checked.
+	Deposit    bool         `json:"deposit"`
+	Mint       *hexutil.Big `json:"mint"`
+	SourceHash common.Hash  `json:"source_hash"`
+	// AuthorizationList makes an EIP-7702 set-code transaction, whose
+	// authorizations are applied before its execution, see authorize.
+	AuthorizationList []Authorization `json:"authorization_list"`
+	// BlobFeeCap and BlobHashes make an EIP-4844 blob transaction when it
+	// is encoded, see EncodeTransaction. As the go-ethereum in use predates
+	// Cancun, they are ignored by the execution.
+	BlobFeeCap *hexutil.Big  `json:"blob_fee_cap"`
+	BlobHashes []common.Hash `json:"blob_hashes"`
+	// Type is the type of the transaction when it is encoded, which is
+	// inferred from its fields if nil, see encodedTxType.
+	Type *hexutil.Uint64 `json:"type"`
+	// V, R and S are the signature of the transaction, which is encoded
+	// with it. The sender is From, whatever the signature.
+	V *hexutil.Big `json:"v"`
+	R *hexutil.Big `json:"r"`
+	S *hexutil.Big `json:"s"`
 }
 
 type TraceConfig struct {
@@ -119,34 +494,224 @@ type TraceConfig struct {
 	Block         Block                      `json:"block_constants"`
 	Accounts      map[common.Address]Account `json:"accounts"`
 	Transactions  []Transaction              `json:"transactions"`
+	TracerOptions TracerOptions              `json:"tracer_options"`
+	// Output, if OutputGeth or OutputParity, shapes the results returned by
+	// CreateTrace and the RPC method gethutil_trace like the GethExecTraces
+	// of bus-mapping or the replays of trace_replayTransaction of
+	// OpenEthereum, see FormatResults.
+	Output string `json:"output"`
+	// ABIs are the JSON ABIs of contracts by address, by which the call
+	// frames and the logs are decoded in ExecutionResult.Decoded.
+	ABIs map[common.Address]json.RawMessage `json:"abis"`
+	// Labels are names of addresses, e.g. "USDT" or "attacker", which
+	// replace the addresses in ExecutionResult.Decoded and in PrettyPrint.
+	Labels map[common.Address]string `json:"labels"`
+	// Codes are the codes by hash which Account.CodeHash references, so
+	// that the accounts sharing a code, e.g. proxies, don't repeat it.
+	Codes map[common.Hash]hexutil.Bytes `json:"codes"`
+	// ChainData is the path of the LevelDB chaindata directory of a geth
+	// node, opened read-only, whose state at StateRoot is the one on which
+	// Accounts are set up, e.g. to trace a historical transaction without an
+	// archive RPC. The state isn't written to.
+	ChainData string       `json:"chaindata"`
+	StateRoot *common.Hash `json:"state_root"`
+	// StateRPC is the URL of a node from which the state after the block
+	// StateBlockHash, on which Accounts are set up, is fetched lazily by
+	// eth_getProof and eth_getCode as the transactions read it, and cached
+	// in StateCacheDir if set, so that the same block is traced again
+	// without refetching. The state roots aren't computed on such a state.
+	StateRPC       string       `json:"state_rpc"`
+	StateBlockHash *common.Hash `json:"state_block_hash"`
+	StateCacheDir  string       `json:"state_cache_dir"`
+	// TrieUpdates lists the updates of the state trie by each transaction
+	// in ExecutionResult.TrieUpdates, for the witness of the MPT circuit.
+	TrieUpdates bool `json:"trie_updates"`
+	// Preimages collects the preimages of the keys of the account and
+	// storage tries hashed by each transaction in ExecutionResult.Preimages.
+	Preimages bool `json:"preimages"`
+	// Transfers lists the changes of the balances by each transaction, from
+	// the gas bought to the priority fee, in ExecutionResult.Transfers, for
+	// the balance rows of the state circuit.
+	Transfers bool `json:"transfers"`
+	// DumpState exports the whole state after each transaction in
+	// ExecutionResult.StateDump, see DumpAccounts.
+	DumpState bool `json:"dump_state"`
+	// ReturnRejected returns a rejected ExecutionResult for a transaction
+	// rejected before its execution, instead of failing the whole trace.
+	ReturnRejected bool `json:"return_rejected"`
+	// SkipNonceCheck and SkipBalanceCheck relax the checks of the senders
+	// like eth_call, for hypothetical execution. A sender which can't pay for
+	// the gas and the value of a transaction is credited the shortfall before
+	// its execution. A zero gas price is always allowed, as the EVM runs with
+	// NoBaseFee.
+	SkipNonceCheck   bool `json:"skip_nonce_check"`
+	SkipBalanceCheck bool `json:"skip_balance_check"`
+	// AllowSenderCode allows transactions from accounts with code, which are
+	// rejected by EIP-3607 on mainnet. Like the nonce, the code of the sender
+	// isn't checked with SkipNonceCheck.
+	AllowSenderCode bool `json:"allow_sender_code"`
+	// ForceLowFeeCap executes the transactions whose fee cap is below the
+	// base fee, which are rejected by consensus, for negative tests. Their
+	// results are marked by FeeCapTooLow, and their coinbase is paid no
+	// priority fee.
+	ForceLowFeeCap bool `json:"force_low_fee_cap"`
+	// AutoNonce sets the nonce of the transactions without one to the nonce
+	// of their sender when they are applied, i.e. the next one, which is
+	// reported in the Nonce of their results. Without it, a missing nonce is
+	// 0.
+	AutoNonce bool `json:"auto_nonce"`
+	// L1Fee charges the senders of the transactions but the deposits an L1
+	// data fee before their execution, as rollups do, which is reported in
+	// the Fees of their results.
+	L1Fee *L1FeeParams `json:"l1_fee"`
+	// L1DataFee, if set, computes the L1 data fees in place of L1Fee. Like
+	// GetHash, configs with it are never cached.
+	L1DataFee L1DataFeeFunc `json:"-"`
+	// MaxInitCodeSize, if set, rejects the contract creations whose init
+	// code is longer, like EIP-3860 (49152 bytes from Shanghai). As the
+	// go-ethereum in use predates EIP-3860, it doesn't apply to the CREATE
+	// and CREATE2 opcodes, nor charge the gas of the init code words. The
+	// limit of the deployed code of EIP-170 is params.MaxCodeSize from the
+	// EIP158 fork.
+	MaxInitCodeSize *hexutil.Uint64 `json:"max_init_code_size"`
+	// DisableEIP158Cleanup keeps the empty accounts, both of Accounts and
+	// touched by the transactions, which EIP-158/161 deletes from the
+	// EIP158 fork, to trace the vectors of the earlier forks on a later
+	// one. The other rules of EIP-158, e.g. that a call without value
+	// doesn't create its empty callee, still follow Fork.
+	DisableEIP158Cleanup bool `json:"disable_eip158_cleanup"`
+	// GasOverrides replace the constant gas of the opcodes by name, e.g. to
+	// trace an L2 which reprices SLOAD. Their dynamic gas, e.g. the cold
+	// access cost of EIP-2929, still applies.
+	GasOverrides map[string]uint64 `json:"gas_overrides"`
+	// ExtraEips are EIPs activated on top of the fork, e.g. 3198 before
+	// London, among the ones supported by vm.EnableEIP.
+	ExtraEips []int `json:"extra_eips"`
+	// DisabledOpcodes are opcode names which are invalid, e.g. SELFDESTRUCT
+	// on the zkEVMs which don't support it, so that the traces follow the
+	// proving target.
+	DisabledOpcodes []string `json:"disabled_opcodes"`
+	// StateOverride is applied on top of Accounts.
+	StateOverride *StateOverride `json:"state_override"`
+	// BlockHashes are the hashes of blocks by number, which take precedence
+	// over HistoryHashes.
+	BlockHashes map[hexutil.Uint64]common.Hash `json:"block_hashes"`
+	// GetHash, if set, returns the hashes of the blocks not in BlockHashes,
+	// in place of HistoryHashes. As it can't be serialized, configs with it
+	// are never cached.
+	GetHash func(uint64) common.Hash `json:"-"`
+	// RowWeights are weights by opcode name (or "*" for the other opcodes)
+	// by estimate name, e.g. the rows of a step in each circuit, whose sums
+	// over the steps are returned in ExecutionResult.Estimates.
+	RowWeights map[string]map[string]uint64 `json:"row_weights"`
+	// StepEstimators are estimators by estimate name computed like
+	// RowWeights, for the weights which don't only depend on the opcode.
+	// Like GetHash, configs with them are never cached.
+	StepEstimators map[string]StepEstimator `json:"-"`
+	// TimeoutMillis aborts the tracing after TimeoutMillis milliseconds,
+	// where 0 means no timeout, see TraceContext.
+	TimeoutMillis uint64 `json:"timeout_ms"`
+	// Tracer is the body of a JavaScript tracer object (or the name of a
+	// tracer built into geth) run alongside the struct logger, whose result
+	// is returned in ExecutionResult.TracerResult.
+	Tracer string `json:"tracer"`
+	// NativeTracers are the names of the native tracers registered by
+	// RegisterTracer run alongside the struct logger, see Tracer.
+	NativeTracers []string `json:"native_tracers"`
+	// Tracers are tracers by key run alongside the struct logger, whose
+	// results are returned in ExecutionResult.TracerResults by the same
+	// key. Each tracer is the name of a native tracer registered by
+	// RegisterTracer, or else like Tracer, e.g. "callTracer",
+	// "prestateTracer" or the body of a JavaScript tracer object.
+	Tracers map[string]string `json:"tracers"`
+	// Fork is the name of the fork of the chain, as in the fixtures of the
+	// Ethereum tests (see Forks), where "" means London.
+	Fork string `json:"fork"`
+	// ConfigureVM, if set, modifies the config of each EVM before it is
+	// created, e.g. to enable experimental EIPs in its jump table by
+	// vm.EnableEIP, or to wrap its tracer. Its jump table is the one of
+	// GasOverrides and DisabledOpcodes if any, or else empty for the EVM
+	// to pick the one of the fork. Like GetHash, configs with it are never
+	// cached.
+	ConfigureVM func(config *vm.Config) `json:"-"`
+	// OnStep, if set, is passed the steps of the transactions in place of
+	// StructLogs, see TraceWithCallback. Like GetHash, configs with it are
+	// never cached.
+	OnStep StepCallback `json:"-"`
 }
 
-func Trace(config TraceConfig) ([]*ExecutionResult, error) {
-	chainConfig := params.ChainConfig{
-		ChainID:             toBigInt(config.ChainID),
-		HomesteadBlock:      big.NewInt(0),
-		DAOForkBlock:        big.NewInt(0),
-		DAOForkSupport:      true,
-		EIP150Block:         big.NewInt(0),
-		EIP150Hash:          common.Hash{},
-		EIP155Block:         big.NewInt(0),
-		EIP158Block:         big.NewInt(0),
-		ByzantiumBlock:      big.NewInt(0),
-		ConstantinopleBlock: big.NewInt(0),
-		PetersburgBlock:     big.NewInt(0),
-		IstanbulBlock:       big.NewInt(0),
-		MuirGlacierBlock:    big.NewInt(0),
-		BerlinBlock:         big.NewInt(0),
-		LondonBlock:         big.NewInt(0),
-	}
-
-	var blockGasLimit uint64
+// StepCallback is passed each captured step of the txIndex-th transaction,
+// and stops the tracing by returning an error.
+type StepCallback func(txIndex int, step *StructLog) error
+
+// traceEnv is the environment the transactions of a TraceConfig run in.
+type traceEnv struct {
+	chainConfig *params.ChainConfig
+	blockCtx    vm.BlockContext
+	messages    []types.Message
+	// defaults are the block constants filled by applyDefaults.
+	defaults []string
+	// autoNonce[i] is set when the nonce of messages[i] is the one of its
+	// sender, see TraceConfig.AutoNonce.
+	autoNonce []bool
+	// mints[i] is the mint of messages[i] if it's a deposit.
+	mints []*big.Int
+	// txTypes[i] is the type messages[i] is serialized as for l1DataFee.
+	txTypes   []uint8
+	l1DataFee L1DataFeeFunc
+	// beaconRoot is the parent beacon block root of the block, if any.
+	beaconRoot *common.Hash
+	// authorizations[i] are the EIP-7702 authorizations of messages[i],
+	// whose intrinsic gas is left out of the gas of messages[i].
+	authorizations [][]Authorization
+	// jumpTable is the jump table of the EVMs, or nil for the one of the
+	// fork, see TraceConfig.GasOverrides and TraceConfig.DisabledOpcodes.
+	jumpTable   *vm.JumpTable
+	extraEips   []int
+	configureVM func(config *vm.Config)
+	// abis are the parsed TraceConfig.ABIs.
+	abis   map[common.Address]*abi.ABI
+	labels map[common.Address]string
+
+	// disableEIP158Cleanup is TraceConfig.DisableEIP158Cleanup.
+	disableEIP158Cleanup bool
+}
+
+func newTraceEnv(config TraceConfig) (*traceEnv, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	chainConfig, err := newChainConfig(toBigInt(config.ChainID), config.Fork)
+	if err != nil {
+		return nil, NewTraceError(ErrCodeInvalidConfig, err, "Failed to create the chain config: %v", err)
+	}
+	defaults := config.applyDefaults()
+
+	autoNonce := make([]bool, len(config.Transactions))
+	mints := make([]*big.Int, len(config.Transactions))
+	txTypes := make([]uint8, len(config.Transactions))
+	authorizations := make([][]Authorization, len(config.Transactions))
 	messages := make([]types.Message, len(config.Transactions))
 	for i, tx := range config.Transactions {
+		var nonce uint64
+		if tx.Nonce != nil {
+			nonce = uint64(*tx.Nonce)
+		}
+		autoNonce[i] = config.AutoNonce && tx.Nonce == nil
+		if tx.Deposit {
+			mints[i] = toBigInt(tx.Mint)
+		}
+		txTypes[i] = txType(tx)
+		authorizations[i] = tx.AuthorizationList
+
 		// If gas price is specified directly, the tx is treated as legacy type.
+		gasPrice := toBigInt(tx.GasPrice)
 		if tx.GasPrice != nil {
 			tx.GasFeeCap = tx.GasPrice
 			tx.GasTipCap = tx.GasPrice
+		} else if tx.GasFeeCap != nil {
+			// Same as the effective gas price of types.Transaction.AsMessage
+			gasPrice = math.BigMin(new(big.Int).Add(toBigInt(tx.GasTipCap), toBigInt(config.Block.BaseFee)), toBigInt(tx.GasFeeCap))
 		}
 
 		txAccessList := make(types.AccessList, len(tx.AccessList))
@@ -157,26 +722,30 @@ func Trace(config TraceConfig) ([]*ExecutionResult, error) {
 		messages[i] = types.NewMessage(
 			tx.From,
 			tx.To,
-			uint64(tx.Nonce),
+			nonce,
 			toBigInt(tx.Value),
-			uint64(tx.GasLimit),
-			toBigInt(tx.GasPrice),
+			uint64(tx.GasLimit)-perAuthorizationGas*uint64(len(tx.AuthorizationList)),
+			gasPrice,
 			toBigInt(tx.GasFeeCap),
 			toBigInt(tx.GasTipCap),
 			tx.CallData,
 			txAccessList,
-			false,
+			config.SkipNonceCheck || tx.Deposit,
 		)
-
-		blockGasLimit += uint64(tx.GasLimit)
 	}
 
 	blockCtx := vm.BlockContext{
 		CanTransfer: core.CanTransfer,
 		Transfer:    core.Transfer,
 		GetHash: func(n uint64) common.Hash {
-			number := config.Block.Number.ToInt().Uint64()
-			if number > n && number-n <= 256 {
+			if hash, ok := config.BlockHashes[hexutil.Uint64(n)]; ok {
+				return hash
+			}
+			if config.GetHash != nil {
+				return config.GetHash(n)
+			}
+			number := toBigInt(config.Block.Number).Uint64()
+			if number > n && number-n <= uint64(len(config.HistoryHashes)) {
 				index := uint64(len(config.HistoryHashes)) - number + n
 				return common.BigToHash(toBigInt(config.HistoryHashes[index]))
 			}
@@ -187,42 +756,472 @@ func Trace(config TraceConfig) ([]*ExecutionResult, error) {
 		Time:        toBigInt(config.Block.Timestamp),
 		Difficulty:  toBigInt(config.Block.Difficulty),
 		BaseFee:     toBigInt(config.Block.BaseFee),
-		GasLimit:    blockGasLimit,
+		GasLimit:    config.Block.GasLimit.ToInt().Uint64(),
+	}
+	if isMerged(chainConfig) {
+		// The EVM of geth reads PREVRANDAO from the difficulty.
+		blockCtx.Difficulty = config.Block.Random.Big()
+	}
+	jumpTable, err := newJumpTable(&config, chainConfig.Rules(blockCtx.BlockNumber))
+	if err != nil {
+		return nil, NewTraceError(ErrCodeInvalidConfig, err, "Failed to apply config.GasOverrides or config.DisabledOpcodes: %v", err)
+	}
+	abis, err := parseABIs(&config)
+	if err != nil {
+		return nil, NewTraceError(ErrCodeInvalidConfig, err, "Failed to parse config.ABIs: %v", err)
 	}
 
-	// Setup state db with accounts from argument
-	stateDB, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	return &traceEnv{
+		chainConfig:    chainConfig,
+		blockCtx:       blockCtx,
+		messages:       messages,
+		defaults:       defaults,
+		autoNonce:      autoNonce,
+		mints:          mints,
+		txTypes:        txTypes,
+		l1DataFee:      config.l1DataFee(),
+		beaconRoot:     config.Block.ParentBeaconBlockRoot,
+		authorizations: authorizations,
+		jumpTable:      jumpTable,
+		extraEips:      config.ExtraEips,
+		configureVM:    config.ConfigureVM,
+		abis:           abis,
+		labels:         config.Labels,
+
+		disableEIP158Cleanup: config.DisableEIP158Cleanup,
+	}, nil
+}
+
+// vmConfig returns the config of the EVMs running the transactions, with
+// tracer if it isn't nil.
+func (env *traceEnv) vmConfig(tracer vm.EVMLogger) vm.Config {
+	// The extra EIPs are already in the jump table, if any.
+	config := vm.Config{NoBaseFee: true, ExtraEips: env.extraEips}
+	if tracer != nil {
+		config.Debug = true
+		config.Tracer = tracer
+	}
+	if env.jumpTable != nil {
+		config.JumpTable = env.jumpTable
+	}
+	if env.configureVM != nil {
+		env.configureVM(&config)
+	}
+	return config
+}
+
+// message returns the i-th message to apply to stateDB, with the nonce of its
+// sender if its nonce is filled automatically.
+func (env *traceEnv) message(stateDB *StateDB, i int) types.Message {
+	message := env.messages[i]
+	if !env.autoNonce[i] {
+		return message
+	}
+	return types.NewMessage(
+		message.From(),
+		message.To(),
+		stateDB.GetNonce(message.From()),
+		message.Value(),
+		message.Gas(),
+		message.GasPrice(),
+		message.GasFeeCap(),
+		message.GasTipCap(),
+		message.Data(),
+		message.AccessList(),
+		message.IsFake(),
+	)
+}
+
+// mint credits the mint of the i-th message to its sender if it's a deposit.
+func (env *traceEnv) mint(stateDB *StateDB, i int) {
+	if mint := env.mints[i]; mint != nil {
+		stateDB.AddBalance(env.messages[i].From(), mint)
+	}
+}
+
+// isEIP158 returns whether the empty accounts touched by the transactions are
+// deleted, see TraceConfig.DisableEIP158Cleanup.
+func (env *traceEnv) isEIP158() bool {
+	return !env.disableEIP158Cleanup && env.chainConfig.IsEIP158(env.blockCtx.BlockNumber)
+}
+
+// accountCode returns the code of account, resolving its CodeHash in
+// config.Codes or reading its CodeFile.
+func accountCode(config TraceConfig, account Account) ([]byte, error) {
+	if account.CodeFile != "" {
+		return readCodeFile(account.CodeFile)
+	}
+	if account.CodeHash == nil {
+		return account.Code, nil
+	}
+	code, ok := config.Codes[*account.CodeHash]
+	if !ok {
+		return nil, fmt.Errorf("code_hash %s isn't in codes", account.CodeHash.Hex())
+	}
+	return code, nil
+}
+
+// accountStorage returns the storage of account, reading its StorageFile.
+func accountStorage(account Account) (map[common.Hash]common.Hash, error) {
+	if account.StorageFile != "" {
+		return readStorageFile(account.StorageFile)
+	}
+	return account.Storage, nil
+}
+
+// newStateDB returns a StateDB with the accounts of config, on top of the
+// state at config.StateRoot of config.ChainData or the one fetched from
+// config.StateRPC if set, overridden by config.StateOverride.
+func newStateDB(config TraceConfig) (*StateDB, error) {
+	database, root := state.NewDatabase(rawdb.NewMemoryDatabase()), common.Hash{}
+	switch {
+	case config.ChainData != "":
+		db, err := openChainData(config.ChainData)
+		if err != nil {
+			return nil, NewTraceError(ErrCodeInvalidConfig, err, "Failed to open config.ChainData: %v", err)
+		}
+		database = state.NewDatabase(db)
+		if config.StateRoot != nil {
+			root = *config.StateRoot
+		}
+	case config.StateRPC != "" && config.StateBlockHash != nil:
+		var err error
+		if database, err = openRPCState(config.StateRPC, *config.StateBlockHash, config.StateCacheDir); err != nil {
+			return nil, NewTraceError(ErrCodeInvalidConfig, err, "Failed to open config.StateRPC: %v", err)
+		}
+	}
+	statedb, err := state.New(root, database, nil)
+	if err != nil {
+		return nil, NewTraceError(ErrCodeInvalidConfig, err, "Failed to open the state at config.StateRoot: %v", err)
+	}
+	stateDB := NewStateDB(statedb)
 	for address, account := range config.Accounts {
+		code, err := accountCode(config, account)
+		if err != nil {
+			return nil, NewTraceError(ErrCodeInvalidConfig, err, "Failed to resolve the code of config.Accounts[%s]: %v", address.Hex(), err)
+		}
+		storage, err := accountStorage(account)
+		if err != nil {
+			return nil, NewTraceError(ErrCodeInvalidConfig, err, "Failed to resolve the storage of config.Accounts[%s]: %v", address.Hex(), err)
+		}
 		stateDB.SetNonce(address, uint64(account.Nonce))
-		stateDB.SetCode(address, account.Code)
+		stateDB.SetCode(address, code)
 		if account.Balance != nil {
 			stateDB.SetBalance(address, toBigInt(account.Balance))
 		}
-		for key, value := range account.Storage {
+		for key, value := range storage {
 			stateDB.SetState(address, key, value)
 		}
 	}
-	stateDB.Finalise(true)
+	if err := config.StateOverride.Apply(stateDB); err != nil {
+		return nil, NewTraceError(ErrCodeInvalidConfig, err, "Failed to apply config.StateOverride: %v", err)
+	}
+	stateDB.Finalise(!config.DisableEIP158Cleanup)
+	return stateDB, nil
+}
+
+// applyMessage applies message like core.ApplyMessage, rejecting a contract
+// creation above config.MaxInitCodeSize, letting a sender with code through
+// if config.AllowSenderCode is set or if its code is an EIP-7702 delegation,
+// and a fee cap below the base fee if config.ForceLowFeeCap is set.
+func applyMessage(evm *vm.EVM, stateDB *StateDB, message types.Message, config TraceConfig) (*core.ExecutionResult, error) {
+	if limit := config.MaxInitCodeSize; limit != nil && message.To() == nil && uint64(len(message.Data())) > uint64(*limit) {
+		return nil, fmt.Errorf("%w: code size %d limit %d", ErrMaxInitCodeSizeExceeded, len(message.Data()), uint64(*limit))
+	}
+	if config.AllowSenderCode || isDelegated(stateDB, message.From()) {
+		stateDB.hideSenderCode(message.From())
+	}
+	// With NoBaseFee, geth computes a negative priority fee for a message
+	// without gas price, which later versions don't pay.
+	clamp := message.GasPrice().Sign() == 0
+	if config.ForceLowFeeCap && feeCapTooLow(evm, message) {
+		// Pass the fee cap check with the base fee lowered to the fee cap,
+		// then execute with the actual base fee, which makes the priority
+		// fee negative.
+		baseFee := evm.Context.BaseFee
+		evm.Context.BaseFee = message.GasFeeCap()
+		stateDB.onTxStart = append(stateDB.onTxStart, func() { evm.Context.BaseFee = baseFee })
+		clamp = true
+	}
+	if clamp {
+		stateDB.clampCoinbaseCredit = true
+		defer func() { stateDB.clampCoinbaseCredit = false }()
+	}
+	// The transaction may be rejected before it starts.
+	defer stateDB.startTx()
+	return core.ApplyMessage(evm, message, new(core.GasPool).AddGas(message.Gas()))
+}
+
+// feeCapTooLow returns whether geth rejects message for its fee cap below the
+// base fee, which it only checks when the fee cap or the tip cap is set since
+// the EVM runs with NoBaseFee.
+func feeCapTooLow(evm *vm.EVM, message types.Message) bool {
+	if !evm.ChainConfig().IsLondon(evm.Context.BlockNumber) || (message.GasFeeCap().Sign() == 0 && message.GasTipCap().Sign() == 0) {
+		return false
+	}
+	return message.GasFeeCap().Cmp(evm.Context.BaseFee) < 0
+}
+
+// creditShortfall credits the sender of message the shortfall of its balance
+// to pay for the gas and the value, for TraceConfig.SkipBalanceCheck.
+func creditShortfall(stateDB *StateDB, message types.Message) {
+	// Same as the balance check of core.StateTransition.buyGas
+	required := new(big.Int).SetUint64(message.Gas())
+	required.Mul(required, message.GasFeeCap())
+	required.Add(required, message.Value())
+	if balance := stateDB.GetBalance(message.From()); balance.Cmp(required) < 0 {
+		stateDB.AddBalance(message.From(), required.Sub(required, balance))
+	}
+}
+
+// Trace traces the transactions of config, see TraceContext.
+func Trace(config TraceConfig) ([]*ExecutionResult, error) {
+	return TraceContext(context.Background(), config)
+}
+
+// TraceContext traces the transactions of config until ctx is done or
+// config.TimeoutMillis has elapsed, in which case the result of the
+// transaction being traced is marked as interrupted and is the last one
+// returned.
+func TraceContext(ctx context.Context, config TraceConfig) ([]*ExecutionResult, error) {
+	env, err := newTraceEnv(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Setup state db with accounts from argument
+	stateDB, err := newStateDB(config)
+	if err != nil {
+		return nil, err
+	}
+	return env.traceAll(ctx, stateDB, config)
+}
+
+// traceAll traces the transactions of config on stateDB, see TraceContext.
+func (env *traceEnv) traceAll(ctx context.Context, stateDB *StateDB, config TraceConfig) ([]*ExecutionResult, error) {
+	if config.TimeoutMillis > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(config.TimeoutMillis)*time.Millisecond)
+		defer cancel()
+	}
+	env.processBeaconRoot(stateDB)
 
 	// Run the transactions with tracing enabled.
+	var err error
 	executionResults := make([]*ExecutionResult, len(config.Transactions))
-	for i, message := range messages {
-		tracer := logger.NewStructLogger(&logger.Config{EnableMemory: true})
-		evm := vm.NewEVM(blockCtx, core.NewEVMTxContext(message), stateDB, &chainConfig, vm.Config{Debug: true, Tracer: tracer, NoBaseFee: true})
+	for i := range env.messages {
+		if executionResults[i], err = env.trace(ctx, stateDB, i, config); err != nil {
+			return nil, err
+		}
+		if executionResults[i].Interrupted {
+			return executionResults[:i+1], nil
+		}
+	}
 
-		result, err := core.ApplyMessage(evm, message, new(core.GasPool).AddGas(message.Gas()))
-		if err != nil {
-			return nil, fmt.Errorf("Failed to apply config.Transactions[%d]: %w", i, err)
+	return executionResults, nil
+}
+
+// TraceWithCallback traces the transactions of config like Trace, but passes
+// each captured step to callback instead of returning it in StructLogs, so
+// that the memory of the tracing doesn't grow with the steps. The summaries
+// and estimates of the results only cover the steps in StructLogs, which is
+// empty. An error returned by callback stops the tracing and is returned.
+func TraceWithCallback(config TraceConfig, callback StepCallback) ([]*ExecutionResult, error) {
+	config.OnStep = callback
+	return Trace(config)
+}
+
+// trace applies the i-th transaction of config to stateDB with tracing
+// enabled, until ctx is done.
+func (env *traceEnv) trace(ctx context.Context, stateDB *StateDB, i int, config TraceConfig) (*ExecutionResult, error) {
+	message := env.message(stateDB, i)
+	var nonce *hexutil.Uint64
+	if env.autoNonce[i] {
+		filled := hexutil.Uint64(message.Nonce())
+		nonce = &filled
+	}
+	if config.SkipBalanceCheck {
+		creditShortfall(stateDB, message)
+	}
+
+	tracer := NewStructLogger(config.TracerOptions)
+	if config.OnStep != nil {
+		tracer = NewStreamingStructLogger(config.TracerOptions, func(step *StructLog) error {
+			return config.OnStep(i, step)
+		})
+	}
+	txTracers, err := newTxTracers(config, i, tracer)
+	if err != nil {
+		return nil, err
+	}
+	evm := vm.NewEVM(env.blockCtx, core.NewEVMTxContext(message), stateDB, env.chainConfig, env.vmConfig(txTracers.evmLogger()))
+
+	if config.Output == OutputParity || config.TrieUpdates {
+		stateDB.watchState()
+	}
+	stateDB.watchTouches()
+	if config.Preimages {
+		stateDB.watchPreimages()
+	}
+	// The mint is kept even if the deposit is rejected.
+	env.mint(stateDB, i)
+	stateDB.watchCoinbase(env.blockCtx.Coinbase)
+	coinbaseBalance := new(big.Int).Set(stateDB.GetBalance(env.blockCtx.Coinbase))
+	snapshot := stateDB.Snapshot()
+	stopWatch := watchContext(ctx, evm)
+	forcedFeeCap := config.ForceLowFeeCap && feeCapTooLow(evm, message)
+	l1Fee, err := env.chargeL1Fee(stateDB, i, message, config)
+	var authorizationFee *big.Int
+	if err == nil {
+		authorizationFee, err = env.authorize(stateDB, i, message, config)
+	}
+	var result *core.ExecutionResult
+	if err == nil {
+		result, err = applyMessage(evm, stateDB, message, config)
+	}
+	interrupted := stopWatch()
+	if err != nil {
+		traceErr := NewTraceError(txErrorCode(err), err, "Failed to apply config.Transactions[%d]: %v", i, err)
+		if !config.ReturnRejected {
+			return nil, traceErr
 		}
-		stateDB.Finalise(true)
+		// Undo the gas bought before the rejection.
+		stateDB.RevertToSnapshot(snapshot)
+		return &ExecutionResult{
+			Version:         TraceSchemaVersion,
+			Failed:          true,
+			StructLogs:      NewStructLogs([]StructLogRes{}),
+			Error:           traceErr,
+			StateDiff:       stateDB.takeStateDiff(),
+			Rejected:        true,
+			Nonce:           nonce,
+			DefaultsApplied: env.defaults,
+		}, nil
+	}
+	if err := tracer.StepError(); err != nil {
+		return nil, NewTraceError(ErrCodeInternal, err, "Failed to pass a step of config.Transactions[%d] to config.OnStep: %v", i, err)
+	}
+	// The state read failures, e.g. of config.StateRPC, read as empty.
+	if err := stateDB.Error(); err != nil {
+		return nil, NewTraceError(ErrCodeInternal, err, "Failed to read the state of config.Transactions[%d]: %v", i, err)
+	}
+	deletedEmptyAccounts := stateDB.finaliseTouched(env.isEIP158())
+	coinbaseRes := newCoinbaseRes(stateDB, coinbaseBalance, env.isEIP158())
+	fees := newFeesRes(message, result.UsedGas, coinbaseRes.Amount.ToInt(), l1Fee)
+	if authorizationFee != nil {
+		fees.Burned = (*hexutil.Big)(new(big.Int).Add(fees.Burned.ToInt(), authorizationFee))
+	}
 
-		executionResults[i] = &ExecutionResult{
-			Gas:         result.UsedGas,
-			Failed:      result.Failed(),
-			ReturnValue: fmt.Sprintf("%x", result.ReturnData),
-			StructLogs:  FormatLogs(tracer.StructLogs()),
+	executionResult := &ExecutionResult{
+		Version:         TraceSchemaVersion,
+		Gas:             result.UsedGas + env.authorizationGas(i),
+		Failed:          result.Failed(),
+		ReturnValue:     fmt.Sprintf("%x", result.ReturnData),
+		StructLogs:      capturedStructLogs(tracer.StructLogs()),
+		Error:           executionError(result),
+		Calls:           FormatCalls(tracer.Calls()),
+		Deployments:     Deployments(tracer.Calls()),
+		Bytecodes:       FormatBytecodes(tracer.Bytecodes()),
+		AccessList:      stateDB.takeAccessList(),
+		BlockHashes:     tracer.BlockHashes(),
+		Logs:            FormatEventLogs(tracer.Logs()),
+		StateDiff:       stateDB.takeStateDiff(),
+		Coinbase:        coinbaseRes,
+		FeeCapTooLow:    forcedFeeCap,
+		Fees:            fees,
+		Nonce:           nonce,
+		DefaultsApplied: env.defaults,
+	}
+	if errors.Is(result.Err, vm.ErrExecutionReverted) {
+		executionResult.RevertReason, _ = DecodeRevertReason(result.Revert())
+	}
+	if env.abis != nil {
+		executionResult.Decoded = Decode(executionResult, env.abis, env.labels)
+	}
+	executionResult.Labels = env.labels
+	executionResult.DeletedEmptyAccounts = deletedEmptyAccounts
+	executionResult.Preimages = stateDB.takePreimages()
+	if config.Transfers {
+		executionResult.Transfers = newTransfers(tracer, message, env.mints[i], l1Fee, authorizationFee, fees, coinbaseRes)
+	}
+	if config.TrieUpdates {
+		executionResult.TrieUpdates = TrieUpdates(executionResult.StateDiff)
+	}
+	if config.DumpState {
+		executionResult.StateDump = stateDB.dumpState(env.isEIP158())
+	}
+	executionResult.Interrupted = interrupted
+	if err := txTracers.setResults(executionResult, i, config, result); err != nil {
+		return nil, err
+	}
+	if firstError := tracer.FirstError(); firstError != nil {
+		executionResult.ErrorStep = &firstError.Step
+		executionResult.ErrorKind = firstError.Kind
+		executionResult.OogErrorKind = firstError.Oog
+	}
+	executionResult.Truncated = tracer.Truncated()
+	executionResult.Steps = tracer.Steps()
+	if config.TracerOptions.Summary {
+		executionResult.Summary = Summarize(executionResult)
+		rw := tracer.RWEstimate()
+		executionResult.Summary.RW = &rw
+	}
+	if config.TracerOptions.ChunkSize > 0 {
+		executionResult.Chunks = FormatChunks(tracer.Continuations(), executionResult.StructLogs.Len())
+	}
+	if estimators := config.stepEstimators(); estimators != nil {
+		executionResult.Estimates = Estimate(executionResult, estimators)
+	}
+	return executionResult, nil
+}
+
+// watchContext cancels evm when ctx is done, until the returned function is
+// called, which returns whether evm was cancelled.
+func watchContext(ctx context.Context, evm *vm.EVM) func() bool {
+	stop := make(chan struct{})
+	cancelled := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			evm.Cancel()
+			cancelled <- true
+		case <-stop:
+			cancelled <- false
 		}
+	}()
+	return func() bool {
+		close(stop)
+		return <-cancelled
 	}
+}
 
-	return executionResults, nil
+// TraceTxs traces independent configs concurrently with at most workers
+// configs in flight (runtime.NumCPU() if workers < 1), and returns the
+// results and errors in the order of configs.
+func TraceTxs(configs []TraceConfig, workers int) ([][]*ExecutionResult, []error) {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	results := make([][]*ExecutionResult, len(configs))
+	errs := make([]error, len(configs))
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				results[i], errs[i] = Trace(configs[i])
+			}
+		}()
+	}
+	for i := range configs {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	return results, errs
 }
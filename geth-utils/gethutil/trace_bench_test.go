@@ -0,0 +1,83 @@
+package gethutil
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// loopConfig returns the config of a tx running a loop of 10000 iterations,
+// each storing the counter in memory and in storage, i.e. 130002 steps with
+// their memory and storage.
+func loopConfig() TraceConfig {
+	from := common.HexToAddress("0xfe")
+	to := common.HexToAddress("0xaa")
+	return TraceConfig{
+		Block: Block{GasLimit: (*hexutil.Big)(hexutil.MustDecodeBig("0x1000000"))},
+		Accounts: map[common.Address]Account{
+			from: {Balance: (*hexutil.Big)(hexutil.MustDecodeBig("0xffffffffffffffffff"))},
+			// PUSH2 10000
+			// loop: JUMPDEST DUP1 PUSH1 32 MSTORE DUP1 PUSH1 0 SSTORE
+			//       PUSH1 1 SWAP1 SUB DUP1 PUSH1 loop JUMPI
+			to: {Code: hexutil.MustDecode("0x6127105b8060205280600055600190038060035700")},
+		},
+		Transactions: []Transaction{{From: from, To: &to, GasLimit: 10_000_000}},
+	}
+}
+
+// loopResults returns the results of the loop of loopConfig.
+func loopResults(b *testing.B) []*ExecutionResult {
+	results, err := Trace(loopConfig())
+	if err != nil {
+		b.Fatal(err)
+	}
+	if steps := results[0].StructLogs.Len(); steps != 130002 {
+		b.Fatalf("steps: got %d, want 130002", steps)
+	}
+	return results
+}
+
+// BenchmarkTrace traces the loop of loopConfig and writes the results like
+// CreateTrace.
+func BenchmarkTrace(b *testing.B) {
+	config := loopConfig()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		results, err := Trace(config)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := WriteResults(io.Discard, results, "  "); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkWriteResults writes the results of the loop of loopConfig like
+// CreateTrace.
+func BenchmarkWriteResults(b *testing.B) {
+	results := loopResults(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := WriteResults(io.Discard, results, "  "); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMarshalResults encodes the results of the loop of loopConfig with
+// encoding/json.
+func BenchmarkMarshalResults(b *testing.B) {
+	results := loopResults(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.MarshalIndent(results, "", "  "); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package gethutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+
+	// Register the JavaScript and native tracers of geth.
+	_ "github.com/ethereum/go-ethereum/eth/tracers/js"
+	_ "github.com/ethereum/go-ethereum/eth/tracers/native"
+)
+
+// newGethTracer returns the geth tracer of code, which is either the body of a
+// JavaScript tracer object or the name of a tracer built into geth, for the
+// i-th transaction.
+func newGethTracer(code string, i int) (tracers.Tracer, error) {
+	return tracers.New(code, &tracers.Context{TxIndex: i})
+}
+
+// Tracer is a native tracer of a transaction run alongside the struct logger,
+// which is registered with RegisterTracer and selected by name in
+// TraceConfig.NativeTracers.
+type Tracer interface {
+	// OnEnter is called when a call frame at depth is entered, starting with
+	// the frame of the transaction at depth 1.
+	OnEnter(depth int, typ vm.OpCode, from, to common.Address, input []byte, gas uint64, value *big.Int)
+	// OnExit is called when the call frame at depth is exited.
+	OnExit(depth int, output []byte, gasUsed uint64, err error)
+	// OnOpcode is called before the execution of each step, or with the
+	// error failing the step before its execution.
+	OnOpcode(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error)
+	// OnTxEnd is called after the transaction is executed, with the gas
+	// used by the transaction and its execution error, but not when the
+	// transaction is rejected before its execution.
+	OnTxEnd(gasUsed uint64, err error)
+}
+
+// ResultTracer is a Tracer with a result, which is returned in
+// ExecutionResult.NativeTracerResults.
+type ResultTracer interface {
+	Tracer
+	Result() (json.RawMessage, error)
+}
+
+// tracerRegistry holds the constructors of the tracers registered by
+// RegisterTracer by name.
+var tracerRegistry = struct {
+	sync.RWMutex
+	tracers map[string]func(txIndex int) Tracer
+}{tracers: make(map[string]func(txIndex int) Tracer)}
+
+// RegisterTracer registers the constructor of the native tracers of name,
+// which is called with the index of each transaction traced with name in its
+// TraceConfig.NativeTracers. It's meant to be called from init functions, and
+// panics if name is already registered.
+func RegisterTracer(name string, newTracer func(txIndex int) Tracer) {
+	tracerRegistry.Lock()
+	defer tracerRegistry.Unlock()
+	if _, ok := tracerRegistry.tracers[name]; ok {
+		panic(fmt.Sprintf("tracer %q is already registered", name))
+	}
+	tracerRegistry.tracers[name] = newTracer
+}
+
+// newNativeTracer returns the native tracer of name for the i-th
+// transaction.
+func newNativeTracer(name string, i int) (Tracer, error) {
+	tracerRegistry.RLock()
+	newTracer, ok := tracerRegistry.tracers[name]
+	tracerRegistry.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown tracer %q", name)
+	}
+	return newTracer(i), nil
+}
+
+// nativeLogger adapts a Tracer to a vm.EVMLogger.
+type nativeLogger struct {
+	tracer Tracer
+	depth  int
+}
+
+func (l *nativeLogger) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	typ := vm.CALL
+	if create {
+		typ = vm.CREATE
+	}
+	l.depth = 1
+	l.tracer.OnEnter(l.depth, typ, from, to, input, gas, value)
+}
+
+func (l *nativeLogger) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	l.tracer.OnOpcode(pc, op, gas, cost, scope, rData, depth, err)
+}
+
+func (l *nativeLogger) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	l.depth++
+	l.tracer.OnEnter(l.depth, typ, from, to, input, gas, value)
+}
+
+func (l *nativeLogger) CaptureExit(output []byte, gasUsed uint64, err error) {
+	l.tracer.OnExit(l.depth, output, gasUsed, err)
+	l.depth--
+}
+
+// CaptureFault is ignored, as the failure of a step during its execution is
+// reported by the OnExit of its frame.
+func (l *nativeLogger) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (l *nativeLogger) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) {
+	l.tracer.OnExit(l.depth, output, gasUsed, err)
+	l.depth--
+}
+
+// multiLogger forwards the events of the EVM to each of its loggers in order.
+type multiLogger []vm.EVMLogger
+
+func (m multiLogger) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	for _, l := range m {
+		l.CaptureStart(env, from, to, create, input, gas, value)
+	}
+}
+
+func (m multiLogger) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	for _, l := range m {
+		l.CaptureState(pc, op, gas, cost, scope, rData, depth, err)
+	}
+}
+
+func (m multiLogger) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	for _, l := range m {
+		l.CaptureEnter(typ, from, to, input, gas, value)
+	}
+}
+
+func (m multiLogger) CaptureExit(output []byte, gasUsed uint64, err error) {
+	for _, l := range m {
+		l.CaptureExit(output, gasUsed, err)
+	}
+}
+
+func (m multiLogger) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+	for _, l := range m {
+		l.CaptureFault(pc, op, gas, cost, scope, depth, err)
+	}
+}
+
+func (m multiLogger) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) {
+	for _, l := range m {
+		l.CaptureEnd(output, gasUsed, t, err)
+	}
+}
+
+// muxedTracer is a tracer of TraceConfig.Tracers, which is either a geth or
+// a native tracer.
+type muxedTracer struct {
+	key    string
+	geth   tracers.Tracer
+	native Tracer
+}
+
+// txTracers are the tracers of a TraceConfig run alongside the struct logger
+// on a transaction.
+type txTracers struct {
+	loggers       multiLogger
+	gethTracer    tracers.Tracer
+	nativeTracers []Tracer
+	muxedTracers  []muxedTracer
+}
+
+// newTxTracers returns the tracers of config for the i-th transaction, run
+// alongside structLogger.
+func newTxTracers(config TraceConfig, i int, structLogger *StructLogger) (*txTracers, error) {
+	t := &txTracers{loggers: multiLogger{structLogger}}
+	if config.Tracer != "" {
+		tracer, err := newGethTracer(config.Tracer, i)
+		if err != nil {
+			return nil, NewTraceError(ErrCodeInvalidConfig, err, "Failed to create config.Tracer: %v", err)
+		}
+		t.gethTracer = tracer
+		t.loggers = append(t.loggers, tracer)
+	}
+	for j, name := range config.NativeTracers {
+		tracer, err := newNativeTracer(name, i)
+		if err != nil {
+			return nil, NewTraceError(ErrCodeInvalidConfig, err, "Failed to create config.NativeTracers[%d]: %v", j, err)
+		}
+		t.nativeTracers = append(t.nativeTracers, tracer)
+		t.loggers = append(t.loggers, &nativeLogger{tracer: tracer})
+	}
+
+	keys := make([]string, 0, len(config.Tracers))
+	for key := range config.Tracers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		muxed := muxedTracer{key: key}
+		if tracer, err := newNativeTracer(config.Tracers[key], i); err == nil {
+			muxed.native = tracer
+			t.loggers = append(t.loggers, &nativeLogger{tracer: tracer})
+		} else {
+			tracer, err := newGethTracer(config.Tracers[key], i)
+			if err != nil {
+				return nil, NewTraceError(ErrCodeInvalidConfig, err, "Failed to create config.Tracers[%q]: %v", key, err)
+			}
+			muxed.geth = tracer
+			t.loggers = append(t.loggers, tracer)
+		}
+		t.muxedTracers = append(t.muxedTracers, muxed)
+	}
+	return t, nil
+}
+
+// evmLogger returns the logger of the EVM running the tracers.
+func (t *txTracers) evmLogger() vm.EVMLogger {
+	if len(t.loggers) == 1 {
+		return t.loggers[0]
+	}
+	return t.loggers
+}
+
+// setResults ends the tracing of the i-th transaction of config by result,
+// and sets the results of the tracers in executionResult.
+func (t *txTracers) setResults(executionResult *ExecutionResult, i int, config TraceConfig, result *core.ExecutionResult) error {
+	var err error
+	if t.gethTracer != nil {
+		if executionResult.TracerResult, err = t.gethTracer.GetResult(); err != nil {
+			return NewTraceError(ErrCodeInvalidConfig, err, "Failed to get the result of config.Tracer for config.Transactions[%d]: %v", i, err)
+		}
+	}
+	for j, tracer := range t.nativeTracers {
+		tracerResult, ok, err := nativeTracerResult(tracer, result)
+		if err != nil {
+			return NewTraceError(ErrCodeInternal, err, "Failed to get the result of config.NativeTracers[%d] for config.Transactions[%d]: %v", j, i, err)
+		}
+		if !ok {
+			continue
+		}
+		if executionResult.NativeTracerResults == nil {
+			executionResult.NativeTracerResults = make(map[string]json.RawMessage)
+		}
+		executionResult.NativeTracerResults[config.NativeTracers[j]] = tracerResult
+	}
+	for _, muxed := range t.muxedTracers {
+		var tracerResult json.RawMessage
+		if muxed.native != nil {
+			var ok bool
+			if tracerResult, ok, err = nativeTracerResult(muxed.native, result); err != nil {
+				return NewTraceError(ErrCodeInternal, err, "Failed to get the result of config.Tracers[%q] for config.Transactions[%d]: %v", muxed.key, i, err)
+			}
+			if !ok {
+				continue
+			}
+		} else if tracerResult, err = muxed.geth.GetResult(); err != nil {
+			return NewTraceError(ErrCodeInvalidConfig, err, "Failed to get the result of config.Tracers[%q] for config.Transactions[%d]: %v", muxed.key, i, err)
+		}
+		if executionResult.TracerResults == nil {
+			executionResult.TracerResults = make(map[string]json.RawMessage)
+		}
+		executionResult.TracerResults[muxed.key] = tracerResult
+	}
+	return nil
+}
+
+// nativeTracerResult ends the tracing of tracer by result, and returns its
+// result if it's a ResultTracer.
+func nativeTracerResult(tracer Tracer, result *core.ExecutionResult) (json.RawMessage, bool, error) {
+	tracer.OnTxEnd(result.UsedGas, result.Err)
+	resultTracer, ok := tracer.(ResultTracer)
+	if !ok {
+		return nil, false, nil
+	}
+	tracerResult, err := resultTracer.Result()
+	return tracerResult, true, err
+}
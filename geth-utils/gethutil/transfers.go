@@ -0,0 +1,94 @@
+package gethutil
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// The types of TransferRes.
+const (
+	// TransferMint is the mint of a deposit credited to its sender.
+	TransferMint = "mint"
+	// TransferL1Fee is the L1 data fee paid by the sender, see
+	// TraceConfig.L1Fee.
+	TransferL1Fee = "l1Fee"
+	// TransferGas is the gas limit bought by the sender before the
+	// execution.
+	TransferGas = "gas"
+	// TransferAuthorizationFee is the fee of the authorizations paid by the
+	// sender.
+	TransferAuthorizationFee = "authorizationFee"
+	// TransferValue is the value of a call frame, including the root one,
+	// sent by its caller to its callee.
+	TransferValue = "value"
+	// TransferSelfDestruct is the balance swept by a SELFDESTRUCT step to its
+	// beneficiary.
+	TransferSelfDestruct = "selfdestruct"
+	// TransferRefund is the price of the gas left, refunded to the sender
+	// after the execution.
+	TransferRefund = "refund"
+	// TransferReward is the priority fee credited to the coinbase.
+	TransferReward = "reward"
+)
+
+// TransferRes is a change of the balances of a transaction, in the order
+// the EVM made them.
+type TransferRes struct {
+	Type string `json:"type"`
+	// CallID is the ID of the call frame of a TransferValue or a
+	// TransferSelfDestruct, or 0.
+	CallID int `json:"callId"`
+	// From is nil for the amounts credited out of nothing, e.g. the mint and
+	// the refund, and To for the ones debited to nobody, e.g. the fees.
+	From   *common.Address `json:"from"`
+	To     *common.Address `json:"to"`
+	Amount *hexutil.Big    `json:"amount"`
+	// Reverted is set when the call frame of the transfer, or one of its
+	// callers, failed.
+	Reverted bool `json:"reverted,omitempty"`
+}
+
+// newTransfers returns the transfers of message traced by tracer, given its
+// mint, L1 data fee and authorization fee if any, and its fees paid to
+// coinbase. The transfers of zero are left out.
+func newTransfers(tracer *StructLogger, message types.Message, mint, l1Fee, authorizationFee *big.Int, fees *FeesRes, coinbase *CoinbaseRes) []TransferRes {
+	var transfers []TransferRes
+	add := func(typ string, callID int, from, to *common.Address, amount *big.Int) {
+		if amount == nil || amount.Sign() == 0 {
+			return
+		}
+		transfers = append(transfers, TransferRes{
+			Type:     typ,
+			CallID:   callID,
+			From:     from,
+			To:       to,
+			Amount:   (*hexutil.Big)(new(big.Int).Set(amount)),
+			Reverted: callID != 0 && tracer.reverted(callID),
+		})
+	}
+
+	sender := message.From()
+	add(TransferMint, 0, nil, &sender, mint)
+	add(TransferL1Fee, 0, &sender, nil, l1Fee)
+	add(TransferGas, 0, &sender, nil, new(big.Int).Mul(new(big.Int).SetUint64(message.Gas()), message.GasPrice()))
+	add(TransferAuthorizationFee, 0, &sender, nil, authorizationFee)
+	for _, call := range tracer.Calls() {
+		from, to := call.From, call.To
+		typ := TransferValue
+		switch call.Type {
+		case vm.SELFDESTRUCT:
+			typ = TransferSelfDestruct
+		// The value of a CALLCODE is sent by the caller to itself.
+		case vm.CALLCODE:
+			to = from
+		}
+		add(typ, call.ID, &from, &to, call.Value)
+	}
+	add(TransferRefund, 0, nil, &sender, fees.SenderRefund.ToInt())
+	add(TransferReward, 0, nil, &coinbase.Address, fees.PriorityFee.ToInt())
+	return transfers
+}
@@ -0,0 +1,114 @@
+package gethutil
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// The types of TrieUpdateRes, after the modifications of the mpt-witness
+// generator.
+const (
+	TrieUpdateNonce      = "nonce"
+	TrieUpdateBalance    = "balance"
+	TrieUpdateCodeHash   = "codeHash"
+	TrieUpdateStorage    = "storage"
+	TrieUpdateDestructed = "destructed"
+)
+
+// TrieUpdateRes is an update of the state trie by a transaction, for the
+// witness of the MPT circuit. The values are 32-byte words, 0 for the fields
+// of an account which doesn't exist.
+type TrieUpdateRes struct {
+	Type    string         `json:"type"`
+	Address common.Address `json:"address"`
+	// AccountPath is the key of Address in the account trie.
+	AccountPath common.Hash `json:"accountPath"`
+	// Key and StoragePath, its key in the storage trie, are set for
+	// TrieUpdateStorage.
+	Key         *common.Hash `json:"key,omitempty"`
+	StoragePath *common.Hash `json:"storagePath,omitempty"`
+	OldValue    common.Hash  `json:"oldValue"`
+	NewValue    common.Hash  `json:"newValue"`
+}
+
+// TrieUpdates returns the updates of the state trie making diff, ordered by
+// address, then nonce, balance, code hash and storage by key. A deleted
+// account is a single TrieUpdateDestructed.
+func TrieUpdates(diff map[common.Address]*AccountDiffRes) []TrieUpdateRes {
+	addresses := make([]common.Address, 0, len(diff))
+	for address := range diff {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return bytes.Compare(addresses[i][:], addresses[j][:]) < 0
+	})
+
+	var updates []TrieUpdateRes
+	for _, address := range addresses {
+		accountDiff := diff[address]
+		accountPath := crypto.Keccak256Hash(address[:])
+		update := func(typ string, before, after common.Hash) {
+			if before != after {
+				updates = append(updates, TrieUpdateRes{Type: typ, Address: address, AccountPath: accountPath, OldValue: before, NewValue: after})
+			}
+		}
+		if accountDiff.Post == nil {
+			if accountDiff.Pre != nil {
+				updates = append(updates, TrieUpdateRes{Type: TrieUpdateDestructed, Address: address, AccountPath: accountPath})
+			}
+			continue
+		}
+
+		pre, post := accountWordsOf(accountDiff.Pre), accountWordsOf(accountDiff.Post)
+		update(TrieUpdateNonce, pre.nonce, post.nonce)
+		update(TrieUpdateBalance, pre.balance, post.balance)
+		update(TrieUpdateCodeHash, pre.codeHash, post.codeHash)
+
+		keys := make([]common.Hash, 0, len(accountDiff.Post.Storage))
+		for key := range accountDiff.Post.Storage {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return bytes.Compare(keys[i][:], keys[j][:]) < 0
+		})
+		for _, key := range keys {
+			key := key
+			storagePath := crypto.Keccak256Hash(key[:])
+			var old common.Hash
+			if accountDiff.Pre != nil {
+				old = accountDiff.Pre.Storage[key]
+			}
+			updates = append(updates, TrieUpdateRes{
+				Type:        TrieUpdateStorage,
+				Address:     address,
+				AccountPath: accountPath,
+				Key:         &key,
+				StoragePath: &storagePath,
+				OldValue:    old,
+				NewValue:    accountDiff.Post.Storage[key],
+			})
+		}
+	}
+	return updates
+}
+
+// accountWords are the fields of an account as 32-byte words.
+type accountWords struct {
+	nonce, balance, codeHash common.Hash
+}
+
+// accountWordsOf returns the words of account, 0 if it is nil.
+func accountWordsOf(account *AccountStateRes) accountWords {
+	if account == nil {
+		return accountWords{}
+	}
+	return accountWords{
+		nonce:    common.BigToHash(new(big.Int).SetUint64(uint64(account.Nonce))),
+		balance:  common.BigToHash(account.Balance.ToInt()),
+		codeHash: crypto.Keccak256Hash(account.Code),
+	}
+}
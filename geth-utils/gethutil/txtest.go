@@ -0,0 +1,117 @@
+package gethutil
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// TransactionTest is a case of the TransactionTests of the Ethereum tests.
+type TransactionTest struct {
+	TxBytes hexutil.Bytes                    `json:"txbytes"`
+	Result  map[string]TransactionTestResult `json:"result"`
+}
+
+// TransactionTestResult is the expected outcome of a TransactionTest in a
+// fork, where the transaction is invalid if an exception is expected.
+type TransactionTestResult struct {
+	Hash         common.Hash         `json:"hash"`
+	Sender       common.Address      `json:"sender"`
+	IntrinsicGas math.HexOrDecimal64 `json:"intrinsicGas"`
+	Exception    string              `json:"exception"`
+}
+
+// DecodeTransaction decodes a raw legacy or typed transaction, recovers its
+// sender in fork on chain 1, and checks that its gas limit covers its
+// intrinsic gas. It returns the Transaction as traced, with its hash and its
+// intrinsic gas.
+func DecodeTransaction(raw []byte, fork string) (Transaction, common.Hash, uint64, error) {
+	chainConfig, err := newChainConfig(big.NewInt(1), fork)
+	if err != nil {
+		return Transaction{}, common.Hash{}, 0, err
+	}
+	number := new(big.Int)
+
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return Transaction{}, common.Hash{}, 0, fmt.Errorf("failed to decode tx: %w", err)
+	}
+	transaction, err := newTransaction(tx, types.MakeSigner(chainConfig, number))
+	if err != nil {
+		return Transaction{}, tx.Hash(), 0, err
+	}
+
+	intrinsicGas, err := core.IntrinsicGas(tx.Data(), tx.AccessList(), tx.To() == nil, chainConfig.IsHomestead(number), chainConfig.IsIstanbul(number))
+	if err != nil {
+		return Transaction{}, tx.Hash(), 0, err
+	}
+	if tx.Gas() < intrinsicGas {
+		return Transaction{}, tx.Hash(), intrinsicGas, fmt.Errorf("%w: have %d, want %d", core.ErrIntrinsicGas, tx.Gas(), intrinsicGas)
+	}
+	return transaction, tx.Hash(), intrinsicGas, nil
+}
+
+// Run decodes the transaction of t in fork, and checks that it's invalid if
+// and only if an exception is expected, or else its hash, its sender and its
+// intrinsic gas.
+func (t *TransactionTest) Run(fork string) error {
+	expected := t.Result[fork]
+	transaction, hash, intrinsicGas, err := DecodeTransaction(t.TxBytes, fork)
+	if expected.Exception != "" {
+		if err == nil {
+			return fmt.Errorf("valid tx, expected exception: %q", expected.Exception)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if hash != expected.Hash {
+		return fmt.Errorf("hash mismatch: got %x, want %x", hash, expected.Hash)
+	}
+	if transaction.From != expected.Sender {
+		return fmt.Errorf("sender mismatch: got %x, want %x", transaction.From, expected.Sender)
+	}
+	if intrinsicGas != uint64(expected.IntrinsicGas) {
+		return fmt.Errorf("intrinsic gas mismatch: got %d, want %d", intrinsicGas, uint64(expected.IntrinsicGas))
+	}
+	return nil
+}
+
+// newTransaction returns the Transaction of a signed transaction, whose
+// sender is recovered by signer.
+func newTransaction(tx *types.Transaction, signer types.Signer) (Transaction, error) {
+	from, err := types.Sender(signer, tx)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("failed to recover the sender of tx %x: %w", tx.Hash(), err)
+	}
+
+	nonce := hexutil.Uint64(tx.Nonce())
+	transaction := Transaction{
+		From:     from,
+		To:       tx.To(),
+		Nonce:    &nonce,
+		Value:    (*hexutil.Big)(tx.Value()),
+		GasLimit: hexutil.Uint64(tx.Gas()),
+		CallData: tx.Data(),
+	}
+	if tx.Type() == types.DynamicFeeTxType {
+		transaction.GasFeeCap = (*hexutil.Big)(tx.GasFeeCap())
+		transaction.GasTipCap = (*hexutil.Big)(tx.GasTipCap())
+	} else {
+		transaction.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	}
+	for _, tuple := range tx.AccessList() {
+		transaction.AccessList = append(transaction.AccessList, struct {
+			Address     common.Address `json:"address"`
+			StorageKeys []common.Hash  `json:"storage_keys"`
+		}{tuple.Address, tuple.StorageKeys})
+	}
+	return transaction, nil
+}
@@ -8,23 +8,49 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/holiman/uint256"
 )
 
 var (
+	constantGasPtrOffset = 1 * unsafe.Sizeof(int(0))
 	minStackPtrOffset    = 3 * unsafe.Sizeof(int(0))
+	maxStackPtrOffset    = 4 * unsafe.Sizeof(int(0))
 	longonInstructionSet = newLondonInstructionSet()
 )
 
 //go:linkname newLondonInstructionSet github.com/ethereum/go-ethereum/core/vm.newLondonInstructionSet
 func newLondonInstructionSet() vm.JumpTable
 
-func opPushRangeCheck(op vm.OpCode, n int) {
+// opStackBounds returns the minStack and maxStack of the operation of op in
+// London, or false if op is undefined.
+func opStackBounds(op vm.OpCode) (minStack, maxStack int, ok bool) {
 	opPtr := unsafe.Pointer(longonInstructionSet[op])
-	minStack := *(*int)(unsafe.Pointer(uintptr(opPtr) + minStackPtrOffset))
+	if opPtr == nil {
+		return 0, 0, false
+	}
+	minStack = *(*int)(unsafe.Pointer(uintptr(opPtr) + minStackPtrOffset))
+	maxStack = *(*int)(unsafe.Pointer(uintptr(opPtr) + maxStackPtrOffset))
+	return minStack, maxStack, true
+}
+
+func opPushRangeCheck(op vm.OpCode, n int) {
+	minStack, _, _ := opStackBounds(op)
 	rangeCheck(n, 0, minStack, fmt.Sprintf("len(vals) of %s", op.String()))
 }
 
+// opStackIO returns the numbers of items op pops from and pushes onto the
+// stack, derived from the stack bounds of its operation.
+func opStackIO(op vm.OpCode) (pops, pushes int) {
+	minStack, maxStack, ok := opStackBounds(op)
+	if !ok {
+		return 0, 0
+	}
+	// maxStack is params.StackLimit + pops - pushes.
+	return minStack, int(params.StackLimit) + minStack - maxStack
+}
+
 func rangeCheck(n, l, h int, name string) {
 	if n < l || n > h {
 		if l == h {
@@ -83,3 +109,15 @@ func toBigInt(value *hexutil.Big) *big.Int {
 	}
 	return big.NewInt(0)
 }
+
+// ContractAddress returns the address of the contract created by sender
+// with nonce, by a creation transaction or CREATE.
+func ContractAddress(sender common.Address, nonce uint64) common.Address {
+	return crypto.CreateAddress(sender, nonce)
+}
+
+// Create2Address returns the address of the contract created by sender
+// with salt and the init code of initCodeHash, by CREATE2.
+func Create2Address(sender common.Address, salt, initCodeHash common.Hash) common.Address {
+	return crypto.CreateAddress2(sender, salt, initCodeHash[:])
+}
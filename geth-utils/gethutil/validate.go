@@ -0,0 +1,136 @@
+package gethutil
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Validate reports the missing and contradictory fields of config, which
+// would otherwise make the tracing fail obscurely or panic inside geth, as a
+// TraceError with ErrCodeInvalidConfig listing all of them.
+func (config *TraceConfig) Validate() error {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	chainConfig, err := newChainConfig(toBigInt(config.ChainID), config.Fork)
+	if err != nil {
+		report("fork: %v", err)
+	}
+
+	if len(config.HistoryHashes) > 0 {
+		if config.Block.Number == nil {
+			report("block_constants.number is required with history_hashes")
+		} else if number := config.Block.Number.ToInt(); !number.IsUint64() || uint64(len(config.HistoryHashes)) > number.Uint64() || len(config.HistoryHashes) > 256 {
+			report("history_hashes has %d hashes, more than the last 256 blocks before block %v", len(config.HistoryHashes), number)
+		}
+	}
+
+	if config.Output != "" && config.Output != OutputGeth && config.Output != OutputParity {
+		report("output: unknown output %q", config.Output)
+	}
+
+	if (config.ChainData != "") != (config.StateRoot != nil) {
+		report("chaindata and state_root must be set together")
+	}
+	if (config.StateRPC != "") != (config.StateBlockHash != nil) {
+		report("state_rpc and state_block_hash must be set together")
+	}
+	if config.ChainData != "" && config.StateRPC != "" {
+		report("chaindata is set together with state_rpc")
+	}
+
+	var accountProblems []string
+	for hash, code := range config.Codes {
+		if codeHash := crypto.Keccak256Hash(code); codeHash != hash {
+			accountProblems = append(accountProblems, fmt.Sprintf("codes[%s]: the code hashes to %s", hash.Hex(), codeHash.Hex()))
+		}
+	}
+	for address, account := range config.Accounts {
+		if account.CodeFile != "" && (len(account.Code) > 0 || account.CodeHash != nil) {
+			accountProblems = append(accountProblems, fmt.Sprintf("accounts[%s]: code_file is set together with code or code_hash", address.Hex()))
+		}
+		if account.StorageFile != "" && len(account.Storage) > 0 {
+			accountProblems = append(accountProblems, fmt.Sprintf("accounts[%s]: storage_file is set together with storage", address.Hex()))
+		}
+		if account.CodeHash == nil {
+			continue
+		}
+		if len(account.Code) > 0 {
+			accountProblems = append(accountProblems, fmt.Sprintf("accounts[%s]: code is set together with code_hash", address.Hex()))
+		}
+		if _, ok := config.Codes[*account.CodeHash]; !ok {
+			accountProblems = append(accountProblems, fmt.Sprintf("accounts[%s]: code_hash %s isn't in codes", address.Hex(), account.CodeHash.Hex()))
+		}
+	}
+	// The maps are iterated in random order.
+	sort.Strings(accountProblems)
+	problems = append(problems, accountProblems...)
+
+	for _, eip := range config.ExtraEips {
+		if !vm.ValidEip(eip) {
+			report("extra_eips: EIP %d isn't supported", eip)
+		}
+	}
+
+	if chainConfig != nil && !isMerged(chainConfig) {
+		if config.Block.Random != nil {
+			report("block_constants.random is set before the Merge")
+		}
+		if config.Block.ParentBeaconBlockRoot != nil {
+			report("block_constants.parent_beacon_block_root is set before the Merge")
+		}
+	}
+
+	number := toBigInt(config.Block.Number)
+	for i, tx := range config.Transactions {
+		if tx.GasPrice != nil && (tx.GasFeeCap != nil || tx.GasTipCap != nil) {
+			report("transactions[%d]: gas_price is set together with gas_fee_cap or gas_tip_cap", i)
+		}
+		if tx.GasFeeCap != nil && tx.GasTipCap != nil && tx.GasTipCap.ToInt().Cmp(tx.GasFeeCap.ToInt()) > 0 {
+			report("transactions[%d]: gas_tip_cap %v is above gas_fee_cap %v", i, tx.GasTipCap, tx.GasFeeCap)
+		}
+		if tx.Deposit {
+			if toBigInt(tx.GasPrice).Sign() != 0 || toBigInt(tx.GasFeeCap).Sign() != 0 || toBigInt(tx.GasTipCap).Sign() != 0 {
+				report("transactions[%d]: deposit pays a gas price", i)
+			}
+			if len(tx.AccessList) > 0 {
+				report("transactions[%d]: deposit has an access_list", i)
+			}
+		} else if tx.Mint != nil {
+			report("transactions[%d]: mint is set on a transaction which isn't a deposit", i)
+		}
+		if len(tx.AuthorizationList) > 0 {
+			if tx.To == nil {
+				report("transactions[%d]: authorization_list is set on a contract creation", i)
+			}
+			if authorizationGas := perAuthorizationGas * uint64(len(tx.AuthorizationList)); uint64(tx.GasLimit) < authorizationGas {
+				report("transactions[%d]: gas_limit %d is below the intrinsic gas %d of the authorization_list", i, tx.GasLimit, authorizationGas)
+			}
+		}
+		if chainConfig == nil {
+			continue
+		}
+		if len(tx.AuthorizationList) > 0 && !isMerged(chainConfig) {
+			report("transactions[%d]: authorization_list is set before the Merge", i)
+		}
+		if len(tx.AccessList) > 0 && !chainConfig.IsBerlin(number) {
+			report("transactions[%d]: access_list is set before Berlin", i)
+		}
+		if (tx.GasFeeCap != nil || tx.GasTipCap != nil) && !chainConfig.IsLondon(number) {
+			report("transactions[%d]: gas_fee_cap or gas_tip_cap is set before London", i)
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	err = errors.New(strings.Join(problems, "; "))
+	return NewTraceError(ErrCodeInvalidConfig, err, "Invalid config: %v", err)
+}
@@ -1,10 +1,13 @@
-module main
+module github.com/appliedzkp/zkevm-circuits/geth-utils
 
 go 1.16
 
 require (
 	github.com/ethereum/go-ethereum v1.10.15
 	github.com/holiman/uint256 v1.2.0
+	github.com/klauspost/compress v1.13.6
+	google.golang.org/grpc v1.40.0
+	google.golang.org/protobuf v1.27.1
 )
 
 // Uncomment for debugging
@@ -2,38 +2,352 @@ package main
 
 /*
    #include <stdlib.h>
+
+   typedef void (*get_hash_fn)(unsigned long long number, unsigned char *hash);
+
+   static inline void call_get_hash(get_hash_fn fn, unsigned long long number, unsigned char *hash) {
+       fn(number, hash);
+   }
 */
 import "C"
 import (
+	"bytes"
 	"encoding/json"
-	"fmt"
-	"main/gethutil"
+	"os"
+	"sync"
 	"unsafe"
+
+	"github.com/appliedzkp/zkevm-circuits/geth-utils/gethutil"
+	"github.com/ethereum/go-ethereum/common"
 )
 
-// TODO: Add proper error handling.  For example, return an int, where 0 means
-// ok, and !=0 means error.
+// CreateTrace returns the JSON []ExecutionResult of the JSON config, or an
+// error envelope {"error": {"code": <code>, "message": <message>}} on failure,
+// see gethutil.TraceError.
 //export CreateTrace
 func CreateTrace(configStr *C.char) *C.char {
+	result, err := createTrace(C.GoString(configStr))
+	if err != nil {
+		return C.CString(errorEnvelope(err))
+	}
+	return cString(result)
+}
+
+// CreateTraceCompressed is CreateTrace with the result wrapped in a payload
+// compressed by the given algorithm (see gethutil.CompressPayload). Since the
+// payload is binary, its length is written to length. Failures are returned
+// uncompressed, as the same error envelope CreateTrace would return.
+//export CreateTraceCompressed
+func CreateTraceCompressed(configStr *C.char, compression C.int, length *C.size_t) *C.char {
+	var payload []byte
+	result, err := createTrace(C.GoString(configStr))
+	if err == nil {
+		var compressErr error
+		payload, compressErr = gethutil.CompressPayload(result, gethutil.Compression(compression))
+		if compressErr != nil {
+			err = gethutil.NewTraceError(gethutil.ErrCodeInvalidConfig, compressErr, "Failed to compress trace, err: %v", compressErr)
+		}
+	}
+	if err != nil {
+		payload, _ = gethutil.CompressPayload([]byte(errorEnvelope(err)), gethutil.CompressionNone)
+	}
+
+	*length = C.size_t(len(payload))
+	return (*C.char)(C.CBytes(payload))
+}
+
+// getHashCallback is the callback set by SetGetHashCallback.
+var getHashCallback struct {
+	sync.Mutex
+	fn C.get_hash_fn
+}
+
+// SetGetHashCallback sets the callback which writes the 32-byte hash of the
+// block of number into hash, for the blocks not in config.BlockHashes, in
+// place of config.HistoryHashes. A NULL callback unsets it. The callback can
+// be called concurrently by parallel traces.
+//export SetGetHashCallback
+func SetGetHashCallback(fn C.get_hash_fn) {
+	getHashCallback.Lock()
+	defer getHashCallback.Unlock()
+	getHashCallback.fn = fn
+}
+
+func createTrace(configStr string) ([]byte, *gethutil.TraceError) {
 	var config gethutil.TraceConfig
-	err := json.Unmarshal([]byte(C.GoString(configStr)), &config)
+	err := json.Unmarshal([]byte(configStr), &config)
 	if err != nil {
-		return C.CString(fmt.Sprintf("Failed to unmarshal config, err: %v", err))
+		return nil, gethutil.NewTraceError(gethutil.ErrCodeInvalidConfig, err, "Failed to unmarshal config, err: %v", err)
 	}
+	config.GetHash = getHash()
 
-	executionResults, err := gethutil.Trace(config)
+	var executionResults []*gethutil.ExecutionResult
+	if cacheDir := os.Getenv("GETH_UTILS_CACHE_DIR"); cacheDir != "" {
+		executionResults, err = gethutil.TraceCached(config, cacheDir)
+	} else {
+		executionResults, err = gethutil.Trace(config)
+	}
 	if err != nil {
-		return C.CString(fmt.Sprintf("Failed to run Trace, err: %v", err))
+		traceErr := gethutil.AsTraceError(err)
+		return nil, gethutil.NewTraceError(traceErr.Code, err, "Failed to run Trace, err: %v", err)
 	}
 
-	bytes, err := json.MarshalIndent(executionResults, "", "  ")
+	return marshalResults(config, executionResults)
+}
+
+func marshalResults(config gethutil.TraceConfig, executionResults []*gethutil.ExecutionResult) ([]byte, *gethutil.TraceError) {
+	formatted := gethutil.FormatResults(config, executionResults)
+	// The steps of the results are written directly, which is much faster
+	// for long traces than through encoding/json.
+	if results, ok := formatted.([]*gethutil.ExecutionResult); ok {
+		var buf bytes.Buffer
+		if err := gethutil.WriteResults(&buf, results, "  "); err != nil {
+			return nil, gethutil.NewTraceError(gethutil.ErrCodeInternal, err, "Failed to marshal []ExecutionResult, err: %v", err)
+		}
+		return buf.Bytes(), nil
+	}
+	encoded, err := json.MarshalIndent(formatted, "", "  ")
 	if err != nil {
-		return C.CString(fmt.Sprintf("Failed to marshal []ExecutionResult, err: %v", err))
+		return nil, gethutil.NewTraceError(gethutil.ErrCodeInternal, err, "Failed to marshal []ExecutionResult, err: %v", err)
+	}
+
+	return encoded, nil
+}
+
+// cString returns a copy of b in the C heap terminated by a NUL, like
+// C.CString without converting b to a string first.
+func cString(b []byte) *C.char {
+	return (*C.char)(C.CBytes(append(b, 0)))
+}
+
+// getHash returns the GetHash of a config calling the callback set by
+// SetGetHashCallback, or nil if there is none.
+func getHash() func(uint64) common.Hash {
+	getHashCallback.Lock()
+	fn := getHashCallback.fn
+	getHashCallback.Unlock()
+	if fn == nil {
+		return nil
+	}
+	return func(number uint64) common.Hash {
+		var hash common.Hash
+		C.call_get_hash(fn, C.ulonglong(number), (*C.uchar)(unsafe.Pointer(&hash[0])))
+		return hash
+	}
+}
+
+func errorEnvelope(err *gethutil.TraceError) string {
+	bytes, _ := json.Marshal(struct {
+		Error *gethutil.TraceError `json:"error"`
+	}{err})
+	return string(bytes)
+}
+
+// CreateTraces traces a JSON array of configs with at most workers configs
+// in flight, and returns a JSON array with, for each config in order, either
+// {"result": [...]} or {"error": {"code": <code>, "message": <message>}}.
+//export CreateTraces
+func CreateTraces(configsStr *C.char, workers C.int) *C.char {
+	var configs []gethutil.TraceConfig
+	err := json.Unmarshal([]byte(C.GoString(configsStr)), &configs)
+	if err != nil {
+		return C.CString(errorEnvelope(gethutil.NewTraceError(gethutil.ErrCodeInvalidConfig, err, "Failed to unmarshal configs, err: %v", err)))
+	}
+
+	for i := range configs {
+		configs[i].GetHash = getHash()
+	}
+	results, errs := gethutil.TraceTxs(configs, int(workers))
+	outputs := make([]gethutil.TraceOutput, len(configs))
+	for i := range configs {
+		if errs[i] != nil {
+			traceErr := gethutil.AsTraceError(errs[i])
+			outputs[i].Error = gethutil.NewTraceError(traceErr.Code, errs[i], "Failed to run Trace, err: %v", errs[i])
+		} else {
+			outputs[i].Result = gethutil.FormatResults(configs[i], results[i])
+		}
+	}
+
+	bytes, err := json.Marshal(outputs)
+	if err != nil {
+		return C.CString(errorEnvelope(gethutil.NewTraceError(gethutil.ErrCodeInternal, err, "Failed to marshal traces, err: %v", err)))
 	}
 
 	return C.CString(string(bytes))
 }
 
+// traceHandle is a serialized trace started by StartTrace, whose lock
+// serializes the calls to ReadTraceChunk and FreeTrace on it from different
+// threads.
+type traceHandle struct {
+	sync.Mutex
+	// reader is nil once the handle is freed.
+	reader *bytes.Reader
+}
+
+// traceHandles holds the serialized traces started by StartTrace, which are
+// kept on the Go heap until their handle is freed by FreeTrace.
+var traceHandles = struct {
+	sync.Mutex
+	next    uint64
+	handles map[uint64]*traceHandle
+}{handles: make(map[uint64]*traceHandle)}
+
+// StartTrace traces the JSON config and returns a handle to its serialized
+// result of length bytes, to be read in chunks by ReadTraceChunk and freed by
+// FreeTrace. The trace is serialized once into the buffer the chunks are
+// read from, which avoids copying the whole trace into a single C
+// allocation.
+// On failure, it returns 0 and sets errStr to the same error envelope
+// CreateTrace would return, to be freed by FreeString.
+//export StartTrace
+func StartTrace(configStr *C.char, length *C.size_t, errStr **C.char) C.ulonglong {
+	result, err := createTrace(C.GoString(configStr))
+	if err != nil {
+		*errStr = C.CString(errorEnvelope(err))
+		return 0
+	}
+
+	traceHandles.Lock()
+	defer traceHandles.Unlock()
+	traceHandles.next++
+	traceHandles.handles[traceHandles.next] = &traceHandle{reader: bytes.NewReader(result)}
+	*length = C.size_t(len(result))
+	return C.ulonglong(traceHandles.next)
+}
+
+// maxChunkLen is the maximum number of bytes copied by a ReadTraceChunk.
+const maxChunkLen = 1 << 30
+
+// ReadTraceChunk copies the next at most bufLen bytes (capped to maxChunkLen)
+// of the trace of handle into buf, and returns the number of bytes copied,
+// which is 0 once the whole trace has been read, or -1 if the handle is
+// unknown or freed. It may be called from any thread, concurrently with the
+// other calls on the handle.
+//export ReadTraceChunk
+func ReadTraceChunk(handle C.ulonglong, buf *C.char, bufLen C.size_t) C.longlong {
+	traceHandles.Lock()
+	trace, ok := traceHandles.handles[uint64(handle)]
+	traceHandles.Unlock()
+	if !ok {
+		return -1
+	}
+
+	trace.Lock()
+	defer trace.Unlock()
+	if trace.reader == nil {
+		return -1
+	}
+	n := int(bufLen)
+	if n > maxChunkLen {
+		n = maxChunkLen
+	}
+	read, _ := trace.reader.Read((*[maxChunkLen]byte)(unsafe.Pointer(buf))[:n:n])
+	return C.longlong(read)
+}
+
+// FreeTrace releases the trace of handle, once the ReadTraceChunk in progress
+// on it, if any, returns.
+//export FreeTrace
+func FreeTrace(handle C.ulonglong) {
+	traceHandles.Lock()
+	trace, ok := traceHandles.handles[uint64(handle)]
+	delete(traceHandles.handles, uint64(handle))
+	traceHandles.Unlock()
+	if !ok {
+		return
+	}
+
+	trace.Lock()
+	defer trace.Unlock()
+	trace.reader = nil
+}
+
+// stateHandles holds the states set up by NewStateHandle until their handle
+// is freed by FreeStateHandle.
+var stateHandles = struct {
+	sync.Mutex
+	next   uint64
+	states map[uint64]*gethutil.StateHandle
+}{states: make(map[uint64]*gethutil.StateHandle)}
+
+// NewStateHandle sets up the state of the accounts of the JSON config, and
+// returns a handle to it, on which TraceOnStateHandle traces transactions in
+// sequence, to be freed by FreeStateHandle. On failure, it returns 0 and
+// sets errStr to the same error envelope CreateTrace would return, to be
+// freed by FreeString.
+//export NewStateHandle
+func NewStateHandle(configStr *C.char, errStr **C.char) C.ulonglong {
+	var config gethutil.TraceConfig
+	if err := json.Unmarshal([]byte(C.GoString(configStr)), &config); err != nil {
+		*errStr = C.CString(errorEnvelope(gethutil.NewTraceError(gethutil.ErrCodeInvalidConfig, err, "Failed to unmarshal config, err: %v", err)))
+		return 0
+	}
+	state, err := gethutil.NewStateHandle(config)
+	if err != nil {
+		traceErr := gethutil.AsTraceError(err)
+		*errStr = C.CString(errorEnvelope(gethutil.NewTraceError(traceErr.Code, err, "Failed to set up state, err: %v", err)))
+		return 0
+	}
+
+	stateHandles.Lock()
+	defer stateHandles.Unlock()
+	stateHandles.next++
+	stateHandles.states[stateHandles.next] = state
+	return C.ulonglong(stateHandles.next)
+}
+
+// TraceOnStateHandle traces the transactions of the JSON config, without
+// accounts, on the state of handle, which keeps their changes, and returns
+// the same JSON as CreateTrace.
+//export TraceOnStateHandle
+func TraceOnStateHandle(handle C.ulonglong, configStr *C.char) *C.char {
+	result, err := traceOnStateHandle(uint64(handle), C.GoString(configStr))
+	if err != nil {
+		return C.CString(errorEnvelope(err))
+	}
+	return cString(result)
+}
+
+func traceOnStateHandle(handle uint64, configStr string) ([]byte, *gethutil.TraceError) {
+	stateHandles.Lock()
+	state, ok := stateHandles.states[handle]
+	stateHandles.Unlock()
+	if !ok {
+		return nil, gethutil.NewTraceError(gethutil.ErrCodeInvalidConfig, nil, "Unknown state handle %d", handle)
+	}
+
+	var config gethutil.TraceConfig
+	err := json.Unmarshal([]byte(configStr), &config)
+	if err != nil {
+		return nil, gethutil.NewTraceError(gethutil.ErrCodeInvalidConfig, err, "Failed to unmarshal config, err: %v", err)
+	}
+	config.GetHash = getHash()
+
+	executionResults, err := state.Trace(config)
+	if err != nil {
+		traceErr := gethutil.AsTraceError(err)
+		return nil, gethutil.NewTraceError(traceErr.Code, err, "Failed to run Trace, err: %v", err)
+	}
+
+	return marshalResults(config, executionResults)
+}
+
+// FreeStateHandle releases the state of handle.
+//export FreeStateHandle
+func FreeStateHandle(handle C.ulonglong) {
+	stateHandles.Lock()
+	defer stateHandles.Unlock()
+	delete(stateHandles.states, uint64(handle))
+}
+
+// GetTraceSchemaVersion returns gethutil.TraceSchemaVersion, the version of
+// the schema of the traces of this build.
+//export GetTraceSchemaVersion
+func GetTraceSchemaVersion() C.int {
+	return C.int(gethutil.TraceSchemaVersion)
+}
+
 //export FreeString
 func FreeString(str *C.char) {
 	C.free(unsafe.Pointer(str))
@@ -1,16 +1,67 @@
 //! Connection to external EVM tracer.
 
 use core::fmt::{Display, Formatter, Result as FmtResult};
+use serde::Deserialize;
 use std::ffi::{CStr, CString};
-use std::os::raw::c_char;
+use std::io::{self, Read};
+use std::os::raw::{c_char, c_int, c_longlong, c_ulonglong};
 
 extern "C" {
     fn CreateTrace(str: *const c_char) -> *const c_char;
+    fn CreateTraceCompressed(
+        str: *const c_char,
+        compression: c_int,
+        length: *mut usize,
+    ) -> *const c_char;
+    fn CreateTraces(str: *const c_char, workers: c_int) -> *const c_char;
+    fn StartTrace(str: *const c_char, length: *mut usize, err: *mut *const c_char) -> c_ulonglong;
+    fn ReadTraceChunk(handle: c_ulonglong, buf: *mut c_char, len: usize) -> c_longlong;
+    fn FreeTrace(handle: c_ulonglong);
+    fn NewStateHandle(str: *const c_char, err: *mut *const c_char) -> c_ulonglong;
+    fn TraceOnStateHandle(handle: c_ulonglong, str: *const c_char) -> *const c_char;
+    fn FreeStateHandle(handle: c_ulonglong);
+    fn SetGetHashCallback(callback: Option<GetHashCallback>);
+    fn GetTraceSchemaVersion() -> c_int;
     fn FreeString(str: *const c_char);
 }
 
+/// Callback writing the 32-byte hash of the block of `number` into `hash`.
+pub type GetHashCallback = extern "C" fn(number: u64, hash: *mut u8);
+
+/// Sets the callback returning the hashes of the blocks which are not in the
+/// `block_hashes` of a config, in place of its `history_hashes`, or unsets it
+/// if `None`. It applies to all the following traces, and can be called
+/// concurrently by parallel traces.
+pub fn set_get_hash_callback(callback: Option<GetHashCallback>) {
+    unsafe { SetGetHashCallback(callback) };
+}
+
+/// Version of the schema of the traces these bindings understand, mirroring
+/// `gethutil.TraceSchemaVersion`.
+pub const TRACE_SCHEMA_VERSION: u32 = 1;
+
+/// Returns the version of the schema of the traces of the linked library.
+pub fn trace_schema_version() -> u32 {
+    unsafe { GetTraceSchemaVersion() as u32 }
+}
+
+/// Checks that the linked library produces traces of
+/// [`TRACE_SCHEMA_VERSION`], so that a mismatched build is reported as such
+/// instead of as a deserialization failure.
+pub fn check_trace_schema_version() -> Result<(), Error> {
+    match trace_schema_version() {
+        TRACE_SCHEMA_VERSION => Ok(()),
+        found => Err(Error::SchemaVersionMismatch {
+            expected: TRACE_SCHEMA_VERSION,
+            found,
+        }),
+    }
+}
+
 /// Creates the trace
 pub fn trace(config: &str) -> Result<String, Error> {
+    check_trace_schema_version()?;
+
     // Create a string we can pass into Go
     let c_config = CString::new(config).expect("invalid config");
 
@@ -29,9 +80,266 @@ pub fn trace(config: &str) -> Result<String, Error> {
     unsafe { FreeString(c_result.as_ptr()) };
 
     // Return the trace
-    match result.is_empty() || result.starts_with("Failed") {
-        true => Err(Error::TracingError(result)),
-        false => Ok(result),
+    check_result(result)
+}
+
+/// Creates the traces of a JSON array of independent configs, with at most
+/// `workers` configs traced concurrently (the number of CPUs if 0). Returns a
+/// JSON array holding, for each config in order, either `{"result": [...]}`
+/// or `{"error": {"code": <code>, "message": "..."}}`.
+pub fn trace_txs(configs: &str, workers: usize) -> Result<String, Error> {
+    check_trace_schema_version()?;
+    let c_configs = CString::new(configs).expect("invalid configs");
+
+    let result = unsafe { CreateTraces(c_configs.as_ptr(), workers as c_int) };
+
+    let c_result = unsafe { CStr::from_ptr(result) };
+    let result = c_result
+        .to_str()
+        .expect("Error translating EVM traces from library")
+        .to_string();
+
+    unsafe { FreeString(c_result.as_ptr()) };
+
+    check_result(result)
+}
+
+/// Compression algorithm of a trace payload returned by [`trace_compressed`].
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Compression {
+    /// Uncompressed
+    None = 0,
+    /// Gzip
+    Gzip = 1,
+    /// Zstandard
+    Zstd = 2,
+}
+
+/// Length of the header of a trace payload, which is the magic `GTRC`, one
+/// byte of [`Compression`] and the uncompressed length as big-endian u64.
+pub const PAYLOAD_HEADER_LEN: usize = 13;
+
+/// Creates the trace and returns it as a payload compressed with
+/// `compression`, header included. Decompressing the body is left to the
+/// caller.
+pub fn trace_compressed(config: &str, compression: Compression) -> Result<Vec<u8>, Error> {
+    check_trace_schema_version()?;
+    let c_config = CString::new(config).expect("invalid config");
+
+    let mut length = 0usize;
+    let result =
+        unsafe { CreateTraceCompressed(c_config.as_ptr(), compression as c_int, &mut length) };
+
+    // Copy the payload to rust managed memory and free the Go one.
+    let payload = unsafe { std::slice::from_raw_parts(result as *const u8, length) }.to_vec();
+    unsafe { FreeString(result) };
+
+    if payload.len() < PAYLOAD_HEADER_LEN || &payload[..4] != b"GTRC" {
+        return Err(Error::TracingError(
+            "Invalid trace payload header".to_string(),
+        ));
+    }
+    // Failures are always returned uncompressed.
+    if payload[4] == Compression::None as u8 {
+        let body = &payload[PAYLOAD_HEADER_LEN..];
+        if body.is_empty() || body.starts_with(ERROR_ENVELOPE_PREFIX.as_bytes()) {
+            check_result(String::from_utf8_lossy(body).into_owned())?;
+        }
+    }
+    Ok(payload)
+}
+
+/// Reader of a trace kept in memory managed by Go, which is copied in chunks
+/// of the size of the buffers it reads into, so that large traces don't
+/// need a single allocation across the FFI. The trace is freed on drop.
+#[derive(Debug)]
+pub struct TraceReader {
+    handle: c_ulonglong,
+    len: usize,
+}
+
+impl TraceReader {
+    /// Returns the length in bytes of the whole trace.
+    pub fn len(&self) -> usize {
+        self.len
+    }
+
+    /// Returns whether the trace is empty.
+    pub fn is_empty(&self) -> bool {
+        self.len == 0
+    }
+}
+
+impl Read for TraceReader {
+    fn read(&mut self, buf: &mut [u8]) -> io::Result<usize> {
+        let n = unsafe { ReadTraceChunk(self.handle, buf.as_mut_ptr() as *mut c_char, buf.len()) };
+        match n < 0 {
+            true => Err(io::Error::new(
+                io::ErrorKind::NotFound,
+                "unknown trace handle",
+            )),
+            false => Ok(n as usize),
+        }
+    }
+}
+
+impl Drop for TraceReader {
+    fn drop(&mut self) {
+        unsafe { FreeTrace(self.handle) };
+    }
+}
+
+/// Creates the trace and returns a [`TraceReader`] of it, to read large
+/// traces in chunks instead of as a single string.
+pub fn trace_reader(config: &str) -> Result<TraceReader, Error> {
+    check_trace_schema_version()?;
+    let c_config = CString::new(config).expect("invalid config");
+
+    let mut len = 0usize;
+    let mut err = std::ptr::null();
+    let handle = unsafe { StartTrace(c_config.as_ptr(), &mut len, &mut err) };
+
+    if handle == 0 {
+        let c_err = unsafe { CStr::from_ptr(err) };
+        let err = c_err
+            .to_str()
+            .expect("Error translating EVM trace error from library")
+            .to_string();
+        unsafe { FreeString(c_err.as_ptr()) };
+        check_result(err)?;
+        return Err(Error::TracingError("Failed to start trace".to_string()));
+    }
+    Ok(TraceReader { handle, len })
+}
+
+/// State set up once from the accounts of a config, kept in memory managed
+/// by Go, on which the transactions of several configs are traced in
+/// sequence, each on the state left by the previous ones, so that big states
+/// aren't rebuilt for every transaction. The state is freed on drop.
+#[derive(Debug)]
+pub struct StateHandle {
+    handle: c_ulonglong,
+}
+
+impl StateHandle {
+    /// Sets up the state of the accounts of `config`, without tracing its
+    /// transactions.
+    pub fn new(config: &str) -> Result<StateHandle, Error> {
+        check_trace_schema_version()?;
+        let c_config = CString::new(config).expect("invalid config");
+
+        let mut err = std::ptr::null();
+        let handle = unsafe { NewStateHandle(c_config.as_ptr(), &mut err) };
+
+        if handle == 0 {
+            let c_err = unsafe { CStr::from_ptr(err) };
+            let err = c_err
+                .to_str()
+                .expect("Error translating state error from library")
+                .to_string();
+            unsafe { FreeString(c_err.as_ptr()) };
+            check_result(err)?;
+            return Err(Error::TracingError("Failed to set up state".to_string()));
+        }
+        Ok(StateHandle { handle })
+    }
+
+    /// Creates the trace of the transactions of `config`, which has no
+    /// accounts, on the state, which keeps their changes.
+    pub fn trace(&self, config: &str) -> Result<String, Error> {
+        let c_config = CString::new(config).expect("invalid config");
+
+        let result = unsafe { TraceOnStateHandle(self.handle, c_config.as_ptr()) };
+
+        let c_result = unsafe { CStr::from_ptr(result) };
+        let result = c_result
+            .to_str()
+            .expect("Error translating EVM trace from library")
+            .to_string();
+
+        unsafe { FreeString(c_result.as_ptr()) };
+
+        check_result(result)
+    }
+}
+
+impl Drop for StateHandle {
+    fn drop(&mut self) {
+        unsafe { FreeStateHandle(self.handle) };
+    }
+}
+
+/// Prefix of the error envelope `{"error": {"code": <code>, "message":
+/// "..."}}` returned by the library on failure.
+const ERROR_ENVELOPE_PREFIX: &str = r#"{"error":"#;
+
+#[derive(Deserialize)]
+struct ErrorEnvelope {
+    error: ErrorBody,
+}
+
+#[derive(Deserialize)]
+struct ErrorBody {
+    code: u32,
+    message: String,
+}
+
+/// Returns the result, or the error it holds if it is an error envelope.
+fn check_result(result: String) -> Result<String, Error> {
+    if result.is_empty() || result.starts_with("Failed") {
+        return Err(Error::TracingError(result));
+    }
+    if result.starts_with(ERROR_ENVELOPE_PREFIX) {
+        return Err(match serde_json::from_str::<ErrorEnvelope>(&result) {
+            Ok(envelope) => Error::TraceError {
+                code: ErrorCode::from(envelope.error.code),
+                message: envelope.error.message,
+            },
+            Err(_) => Error::TracingError(result),
+        });
+    }
+    Ok(result)
+}
+
+/// Stable code classifying a tracing failure, mirroring `gethutil.ErrorCode`.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum ErrorCode {
+    /// The config is malformed.
+    InvalidConfig,
+    /// A transaction doesn't cover its intrinsic gas.
+    IntrinsicGas,
+    /// A transaction nonce doesn't match its sender nonce.
+    NonceMismatch,
+    /// The execution reverted.
+    ExecutionReverted,
+    /// Unexpected failure of the library.
+    Internal,
+    /// A transaction is rejected for any other reason.
+    InvalidTransaction,
+    /// The execution halted exceptionally.
+    ExecutionHalted,
+    /// The sender can't pay for the gas or the value of a transaction.
+    InsufficientFunds,
+    /// The fee cap of a transaction is below the base fee.
+    FeeCapTooLow,
+    /// A code unknown to this version of the bindings.
+    Unknown(u32),
+}
+
+impl From<u32> for ErrorCode {
+    fn from(code: u32) -> Self {
+        match code {
+            1 => ErrorCode::InvalidConfig,
+            2 => ErrorCode::IntrinsicGas,
+            3 => ErrorCode::NonceMismatch,
+            4 => ErrorCode::ExecutionReverted,
+            5 => ErrorCode::Internal,
+            6 => ErrorCode::InvalidTransaction,
+            7 => ErrorCode::ExecutionHalted,
+            8 => ErrorCode::InsufficientFunds,
+            9 => ErrorCode::FeeCapTooLow,
+            code => ErrorCode::Unknown(code),
+        }
     }
 }
 
@@ -40,6 +348,20 @@ pub fn trace(config: &str) -> Result<String, Error> {
 pub enum Error {
     /// Error while tracing.
     TracingError(String),
+    /// Error while tracing, classified by a stable code.
+    TraceError {
+        /// Code of the error
+        code: ErrorCode,
+        /// Message of the error
+        message: String,
+    },
+    /// The linked library produces traces of another schema version.
+    SchemaVersionMismatch {
+        /// Version understood by these bindings
+        expected: u32,
+        /// Version of the library
+        found: u32,
+    },
 }
 
 impl Display for Error {
@@ -50,7 +372,11 @@ impl Display for Error {
 
 #[cfg(test)]
 mod test {
-    use crate::trace;
+    use crate::{
+        check_trace_schema_version, trace, trace_compressed, trace_reader, trace_txs, Compression,
+        Error, ErrorCode, TRACE_SCHEMA_VERSION,
+    };
+    use std::io::Read;
 
     #[test]
     fn valid_tx() {
@@ -90,6 +416,38 @@ mod test {
                     }
                 ]
             }"#,
+            // Call tx from an account with code, allowed despite EIP-3607
+            r#"{
+                "accounts": {
+                    "0x00000000000000000000000000000000000000fe": {
+                        "code": "0x00"
+                    }
+                },
+                "transactions": [
+                    {
+                        "from": "0x00000000000000000000000000000000000000fe",
+                        "to": "0x00000000000000000000000000000000000000ff",
+                        "gas_limit": "0x5208"
+                    }
+                ],
+                "allow_sender_code": true
+            }"#,
+            // Call tx with wrong nonce and insufficient balance, with sender
+            // checks skipped
+            r#"{
+                "transactions": [
+                    {
+                        "from": "0x00000000000000000000000000000000000000fe",
+                        "to": "0x00000000000000000000000000000000000000ff",
+                        "nonce": "0x5",
+                        "value": "0x100",
+                        "gas_limit": "0x5208",
+                        "gas_price": "0x77359400"
+                    }
+                ],
+                "skip_nonce_check": true,
+                "skip_balance_check": true
+            }"#,
         ] {
             assert!(trace(config).is_ok());
         }
@@ -133,4 +491,1095 @@ mod test {
             assert!(trace(config).is_err())
         }
     }
+
+    #[test]
+    fn error_codes() {
+        for (config, expected) in [
+            ("{", ErrorCode::InvalidConfig),
+            // Insufficient gas for intrinsic usage
+            (
+                r#"{
+                    "transactions": [
+                        {
+                            "from": "0x00000000000000000000000000000000000000fe",
+                            "to": "0x00000000000000000000000000000000000000ff"
+                        }
+                    ]
+                }"#,
+                ErrorCode::IntrinsicGas,
+            ),
+            // Nonce of the sender is 0
+            (
+                r#"{
+                    "transactions": [
+                        {
+                            "from": "0x00000000000000000000000000000000000000fe",
+                            "to": "0x00000000000000000000000000000000000000ff",
+                            "nonce": "0x1",
+                            "gas_limit": "0x5208"
+                        }
+                    ]
+                }"#,
+                ErrorCode::NonceMismatch,
+            ),
+            // Gas price together with a fee cap
+            (
+                r#"{
+                    "transactions": [
+                        {
+                            "from": "0x00000000000000000000000000000000000000fe",
+                            "to": "0x00000000000000000000000000000000000000ff",
+                            "gas_limit": "0x5208",
+                            "gas_price": "0x1",
+                            "gas_fee_cap": "0x1"
+                        }
+                    ]
+                }"#,
+                ErrorCode::InvalidConfig,
+            ),
+            // History hashes without a block number
+            (
+                r#"{
+                    "history_hashes": ["0x1"],
+                    "transactions": []
+                }"#,
+                ErrorCode::InvalidConfig,
+            ),
+        ] {
+            match trace(config) {
+                Err(Error::TraceError { code, .. }) => assert_eq!(code, expected),
+                result => panic!("unexpected result {:?}", result),
+            }
+        }
+    }
+
+    #[test]
+    fn rejected_tx() {
+        // Insufficient gas for intrinsic usage
+        let config = r#"{
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff"
+                }
+            ],
+            "return_rejected": true
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(r#""rejected": true"#));
+    }
+
+    #[test]
+    fn compressed_tx() {
+        // Minimal call tx with gas_limit = 21000
+        let config = r#"{
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x5208"
+                }
+            ]
+        }"#;
+        for compression in [Compression::None, Compression::Gzip, Compression::Zstd] {
+            let payload = trace_compressed(config, compression).unwrap();
+            assert_eq!(payload[4], compression as u8);
+        }
+    }
+
+    #[test]
+    fn chunked_tx() {
+        // Minimal call tx with gas_limit = 21000
+        let config = r#"{
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x5208"
+                }
+            ]
+        }"#;
+        let mut reader = trace_reader(config).unwrap();
+        let mut chunked = Vec::new();
+        let mut chunk = [0u8; 7];
+        loop {
+            let n = reader.read(&mut chunk).unwrap();
+            if n == 0 {
+                break;
+            }
+            chunked.extend_from_slice(&chunk[..n]);
+        }
+        assert_eq!(chunked.len(), reader.len());
+        assert_eq!(String::from_utf8(chunked).unwrap(), trace(config).unwrap());
+
+        assert!(trace_reader("{").is_err());
+    }
+
+    #[test]
+    fn schema_version() {
+        assert!(check_trace_schema_version().is_ok());
+
+        // Minimal call tx with gas_limit = 21000
+        let config = r#"{
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x5208"
+                }
+            ]
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(&format!(r#""version": {}"#, TRACE_SCHEMA_VERSION)));
+    }
+
+    #[test]
+    fn default_block_constants() {
+        // Minimal call tx with only the timestamp of the block set
+        let config = r#"{
+            "block_constants": {
+                "timestamp": "0x1"
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x5208"
+                }
+            ]
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(r#""block_constants.difficulty""#));
+        assert!(result.contains(r#""block_constants.gas_limit""#));
+        assert!(!result.contains(r#""block_constants.timestamp""#));
+    }
+
+    #[test]
+    fn merge_prevrandao() {
+        // Call tx storing the result of DIFFICULTY in slot 0
+        let config = |fork: &str| {
+            format!(
+                r#"{{
+                    "fork": "{}",
+                    "block_constants": {{
+                        "difficulty": "0x1",
+                        "random": "0x000000000000000000000000000000000000000000000000000000000000002a"
+                    }},
+                    "accounts": {{
+                        "0x00000000000000000000000000000000000000ff": {{
+                            "code": "0x4460005500"
+                        }}
+                    }},
+                    "transactions": [
+                        {{
+                            "from": "0x00000000000000000000000000000000000000fe",
+                            "to": "0x00000000000000000000000000000000000000ff",
+                            "gas_limit": "0x30d40"
+                        }}
+                    ]
+                }}"#,
+                fork
+            )
+        };
+        let result = trace(&config("Merge")).unwrap();
+        assert!(result.contains(&format!(r#""{:064x}": "{:064x}""#, 0, 0x2a)));
+
+        // The random is rejected before the Merge
+        match trace(&config("London")) {
+            Err(Error::TraceError { code, .. }) => assert_eq!(code, ErrorCode::InvalidConfig),
+            result => panic!("unexpected result {:?}", result),
+        }
+    }
+
+    #[test]
+    fn beacon_root() {
+        // Call tx reading the root stored in slot 0 of a beacon roots
+        // contract storing its calldata when called by the system address
+        let config = format!(
+            r#"{{
+                "fork": "Merge",
+                "block_constants": {{
+                    "parent_beacon_block_root": "0x{:064x}"
+                }},
+                "accounts": {{
+                    "0x000F3df6D732807Ef1319fB7B8bB8522d0Beac02": {{
+                        "code": "0x3373fffffffffffffffffffffffffffffffffffffffe1460255760005460005260206000f35b60003560005500"
+                    }}
+                }},
+                "transactions": [
+                    {{
+                        "from": "0x00000000000000000000000000000000000000fe",
+                        "to": "0x000F3df6D732807Ef1319fB7B8bB8522d0Beac02",
+                        "gas_limit": "0x30d40"
+                    }}
+                ]
+            }}"#,
+            0x2a
+        );
+        let result = trace(&config).unwrap();
+        assert!(result.contains(&format!(r#""returnValue": "{:064x}""#, 0x2a)));
+    }
+
+    #[test]
+    fn set_code_tx() {
+        // Call tx to an account delegated by its authorization to a contract
+        // returning 42
+        let config = r#"{
+            "fork": "Merge",
+            "accounts": {
+                "0x00000000000000000000000000000000000000bb": {
+                    "code": "0x602a60005260206000f3"
+                }
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000aa",
+                    "gas_limit": "0x30d40",
+                    "authorization_list": [
+                        {
+                            "chain_id": "0x0",
+                            "address": "0x00000000000000000000000000000000000000bb",
+                            "nonce": "0x0",
+                            "authority": "0x00000000000000000000000000000000000000aa"
+                        }
+                    ]
+                }
+            ]
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(&format!(r#""returnValue": "{:064x}""#, 42)));
+    }
+
+    #[test]
+    fn max_init_code_size() {
+        // Create tx with a 3-byte init code
+        let config = |limit: &str| {
+            format!(
+                r#"{{
+                    "transactions": [
+                        {{
+                            "from": "0x00000000000000000000000000000000000000fe",
+                            "gas_limit": "0x30d40",
+                            "call_data": "0x600000"
+                        }}
+                    ],
+                    "max_init_code_size": "{}"
+                }}"#,
+                limit
+            )
+        };
+        assert!(trace(&config("0x3")).is_ok());
+        match trace(&config("0x2")) {
+            Err(Error::TraceError { code, .. }) => assert_eq!(code, ErrorCode::InvalidTransaction),
+            result => panic!("unexpected result {:?}", result),
+        }
+    }
+
+    #[test]
+    fn created_address() {
+        // Create tx from 0xfe with nonce 0
+        let config = r#"{
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "gas_limit": "0x30d40",
+                    "call_data": "0x00"
+                }
+            ]
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(
+            result.contains(r#""createdAddress": "0xa53555c2bc3f95d43335cc88dc38e7685c7bc767""#)
+        );
+    }
+
+    #[test]
+    fn deployment() {
+        // Create tx deploying the code 0x00
+        let config = r#"{
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "gas_limit": "0x30d40",
+                    "call_data": "0x60016000f3"
+                }
+            ]
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(r#""code": "0x00""#));
+        assert!(result.contains(
+            r#""codeHash": "0xbc36789e7a1e281436464229828f817d6612f7b477d66591ff96a9e064bcc98a""#
+        ));
+        assert!(result.contains(r#""depositGas": 200"#));
+    }
+
+    #[test]
+    fn bytecodes() {
+        // Call tx running EXTCODEHASH of 0xfd
+        let config = r#"{
+            "accounts": {
+                "0x00000000000000000000000000000000000000fd": {
+                    "code": "0x6000"
+                },
+                "0x00000000000000000000000000000000000000ff": {
+                    "code": "0x60fd3f00"
+                }
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x30d40"
+                }
+            ]
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(r#": "0x60fd3f00""#));
+        assert!(result.contains(r#": "0x6000""#));
+    }
+
+    #[test]
+    fn access_list() {
+        // Call tx running SLOAD of slot 1
+        let config = r#"{
+            "accounts": {
+                "0x00000000000000000000000000000000000000ff": {
+                    "code": "0x60015400"
+                }
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x30d40"
+                }
+            ]
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(concat!(
+            "\"address\": \"0x00000000000000000000000000000000000000ff\",\n",
+            "        \"storageKeys\": [\n",
+            "          \"0x0000000000000000000000000000000000000000000000000000000000000001\"\n",
+        )));
+    }
+
+    #[test]
+    fn block_hashes() {
+        // Call tx running BLOCKHASH of block 0x100, which is after block 0
+        let config = r#"{
+            "accounts": {
+                "0x00000000000000000000000000000000000000ff": {
+                    "code": "0x6101004000"
+                }
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x30d40"
+                }
+            ]
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(r#""number": "0x100""#));
+        assert!(result.contains(r#""inWindow": false"#));
+    }
+
+    #[test]
+    fn reverted_logs() {
+        // Call tx emitting a LOG0 and reverting, which keeps the log marked
+        let config = r#"{
+            "accounts": {
+                "0x00000000000000000000000000000000000000ff": {
+                    "code": "0x60006000a060006000fd"
+                }
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x30d40"
+                }
+            ]
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(r#""callId": 1"#));
+        assert!(result.contains(r#""reverted": true"#));
+    }
+
+    #[test]
+    fn decoded() {
+        // Call tx to ping(5) emitting Ping(5), decoded by the ABI of the callee
+        let config = r#"{
+            "accounts": {
+                "0x00000000000000000000000000000000000000ff": {
+                    "code": "0x60056000527f48257dc961b6f792c2b78a080dacfed693b660960a702de21cee364e20270e2f60206000a100"
+                }
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x30d40",
+                    "call_data": "0x773acdef0000000000000000000000000000000000000000000000000000000000000005"
+                }
+            ],
+            "abis": {
+                "0x00000000000000000000000000000000000000ff": [
+                    {"type": "function", "name": "ping", "inputs": [{"name": "n", "type": "uint256"}], "outputs": []},
+                    {"type": "event", "name": "Ping", "inputs": [{"name": "n", "type": "uint256", "indexed": false}]}
+                ]
+            }
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(r#""function": "ping(uint256)""#));
+        assert!(result.contains(r#""event": "Ping(uint256)""#));
+        assert!(result.contains(r#""value": "5""#));
+    }
+
+    #[test]
+    fn labels() {
+        // Call tx to ping(5), decoded by the ABI of the callee labeled pinger
+        let config = r#"{
+            "accounts": {
+                "0x00000000000000000000000000000000000000ff": {
+                    "code": "0x00"
+                }
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x30d40",
+                    "call_data": "0x773acdef0000000000000000000000000000000000000000000000000000000000000005"
+                }
+            ],
+            "abis": {
+                "0x00000000000000000000000000000000000000ff": [
+                    {"type": "function", "name": "ping", "inputs": [{"name": "n", "type": "uint256"}], "outputs": []}
+                ]
+            },
+            "labels": {
+                "0x00000000000000000000000000000000000000ff": "pinger"
+            }
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(r#""contract": "pinger""#));
+        assert!(result.contains(r#""0x00000000000000000000000000000000000000ff": "pinger""#));
+    }
+
+    #[test]
+    fn geth_output() {
+        // Call tx running STOP, formatted like the GethExecTraces of bus-mapping
+        let config = r#"{
+            "accounts": {
+                "0x00000000000000000000000000000000000000ff": {
+                    "code": "0x00"
+                }
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x30d40"
+                }
+            ],
+            "output": "geth"
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(r#""op": "STOP""#));
+        assert!(result.contains(r#""stack": []"#));
+        assert!(!result.contains(r#""callId""#));
+        assert!(!result.contains(r#""version""#));
+    }
+
+    #[test]
+    fn parity_output() {
+        // Call tx storing 1 in slot 0, formatted like the replays of OpenEthereum
+        let config = r#"{
+            "accounts": {
+                "0x00000000000000000000000000000000000000ff": {
+                    "code": "0x600160005500"
+                }
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x30d40"
+                }
+            ],
+            "output": "parity"
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(r#""callType": "call""#));
+        assert!(result.contains(r#""traceAddress": []"#));
+        assert!(result.contains(r#""key": "0x0""#));
+        assert!(result.contains(r#""val": "0x1""#));
+        assert!(result.contains(concat!(
+            "\"0x0000000000000000000000000000000000000000000000000000000000000000\": {\n",
+            "            \"*\": {\n",
+            "              \"from\": \"0x0000000000000000000000000000000000000000000000000000000000000000\",\n",
+            "              \"to\": \"0x0000000000000000000000000000000000000000000000000000000000000001\"\n",
+        )));
+    }
+
+    #[test]
+    fn code_registry() {
+        // Call tx to a proxy sharing the code storing 1 in slot 0 by its hash
+        let config = r#"{
+            "accounts": {
+                "0x00000000000000000000000000000000000000fd": {
+                    "code_hash": "0x0dd9fc23b9e0972b48f0c93ebb805660239a90ba27a337a9f24333a8703975cd"
+                },
+                "0x00000000000000000000000000000000000000ff": {
+                    "code_hash": "0x0dd9fc23b9e0972b48f0c93ebb805660239a90ba27a337a9f24333a8703975cd"
+                }
+            },
+            "codes": {
+                "0x0dd9fc23b9e0972b48f0c93ebb805660239a90ba27a337a9f24333a8703975cd": "0x600160005500"
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x30d40"
+                }
+            ]
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(r#""op": "SSTORE""#));
+
+        // The code_hash isn't in codes
+        let config = config.replace(
+            r#""0x0dd9fc23b9e0972b48f0c93ebb805660239a90ba27a337a9f24333a8703975cd": "0x600160005500""#,
+            "",
+        );
+        assert!(trace(&config).is_err());
+    }
+
+    #[test]
+    fn account_files() {
+        // Call tx to an account storing 2 in slot 0, whose code and storage
+        // are in files
+        let dir = std::env::temp_dir().join(format!("geth-utils-{}", std::process::id()));
+        std::fs::create_dir_all(&dir).unwrap();
+        let code_file = dir.join("code.hex");
+        let storage_file = dir.join("storage.json");
+        std::fs::write(&code_file, "0x600260005500\n").unwrap();
+        std::fs::write(
+            &storage_file,
+            r#"{"0x0000000000000000000000000000000000000000000000000000000000000000": "0x0000000000000000000000000000000000000000000000000000000000000001"}"#,
+        )
+        .unwrap();
+        let config = format!(
+            r#"{{
+                "accounts": {{
+                    "0x00000000000000000000000000000000000000ff": {{
+                        "code_file": {:?},
+                        "storage_file": {:?}
+                    }}
+                }},
+                "transactions": [
+                    {{
+                        "from": "0x00000000000000000000000000000000000000fe",
+                        "to": "0x00000000000000000000000000000000000000ff",
+                        "gas_limit": "0x30d40"
+                    }}
+                ]
+            }}"#,
+            code_file.to_str().unwrap(),
+            storage_file.to_str().unwrap(),
+        );
+        let result = trace(&config).unwrap();
+        std::fs::remove_dir_all(&dir).unwrap();
+        assert!(result.contains(r#""op": "SSTORE""#));
+        // The cold SSTORE resets the nonzero slot of the storage file
+        assert!(result.contains(r#""gasCost": 5000"#));
+    }
+
+    #[test]
+    fn state_dump() {
+        // Call tx storing 1 in slot 0, with the state dumped after it
+        let config = r#"{
+            "accounts": {
+                "0x00000000000000000000000000000000000000ff": {
+                    "code": "0x600160005500"
+                }
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x30d40"
+                }
+            ],
+            "dump_state": true
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(r#""stateDump""#));
+        assert!(result.contains(r#""code": "0x600160005500""#));
+        assert!(result.contains(
+            r#""0x0000000000000000000000000000000000000000000000000000000000000000": "01""#
+        ));
+    }
+
+    #[test]
+    fn state_handle() {
+        // Call txs incrementing slot 0, traced twice on the same state
+        let state = StateHandle::new(
+            r#"{
+                "accounts": {
+                    "0x00000000000000000000000000000000000000ff": {
+                        "code": "0x600160005401600055"
+                    }
+                }
+            }"#,
+        )
+        .unwrap();
+        let config = r#"{
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x30d40"
+                }
+            ],
+            "auto_nonce": true
+        }"#;
+        let slot = "0000000000000000000000000000000000000000000000000000000000000000";
+        let first = state.trace(config).unwrap();
+        assert!(first.contains(&format!(r#""{}": "{}1""#, slot, &slot[1..])));
+        let second = state.trace(config).unwrap();
+        assert!(second.contains(&format!(r#""{}": "{}2""#, slot, &slot[1..])));
+    }
+
+    #[test]
+    fn preimages() {
+        // Call tx storing 1 in slot 0, with the preimages of the trie keys
+        let config = r#"{
+            "accounts": {
+                "0x00000000000000000000000000000000000000ff": {
+                    "code": "0x600160005500"
+                }
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x30d40"
+                }
+            ],
+            "preimages": true
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(
+            r#""0x2b7afbb14b4c902f37163b15f70fe8335dec4e26fbae4718c03f19da5aecbe8b": "0x00000000000000000000000000000000000000ff""#
+        ));
+        assert!(result.contains(
+            r#""0x290decd9548b62a8d60345a988386fc84ba6bc95484008f6362f93160ef3e563": "0x0000000000000000000000000000000000000000000000000000000000000000""#
+        ));
+    }
+
+    #[test]
+    fn trie_updates() {
+        // Call tx storing 1 in slot 0, with the updates of the state trie
+        let config = r#"{
+            "accounts": {
+                "0x00000000000000000000000000000000000000ff": {
+                    "code": "0x600160005500"
+                }
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x30d40"
+                }
+            ],
+            "trie_updates": true
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(r#""type": "storage""#));
+        assert!(result.contains(
+            r#""storagePath": "0x290decd9548b62a8d60345a988386fc84ba6bc95484008f6362f93160ef3e563""#
+        ));
+        // The sender's nonce is incremented
+        assert!(result.contains(r#""type": "nonce""#));
+    }
+
+    #[test]
+    fn transfers() {
+        // Call tx with value 0x10 calling 0xfd with value 1, with the
+        // transfers of the balances
+        let config = r#"{
+            "accounts": {
+                "0x00000000000000000000000000000000000000fe": {
+                    "balance": "0x100"
+                },
+                "0x00000000000000000000000000000000000000ff": {
+                    "code": "0x6000600060006000600160fd6000f100"
+                }
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "value": "0x10",
+                    "gas_limit": "0x30d40",
+                    "gas_price": "0x0"
+                }
+            ],
+            "transfers": true
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(r#""type": "value""#));
+        assert!(result.contains(r#""amount": "0x10""#));
+        assert!(result.contains(r#""amount": "0x1""#));
+    }
+
+    #[test]
+    fn call_gas() {
+        // Call tx calling 0xfd, which has no code, with gas 0 and value 1
+        let config = r#"{
+            "accounts": {
+                "0x00000000000000000000000000000000000000ff": {
+                    "code": "0x6000600060006000600160fd6000f100",
+                    "balance": "0x1"
+                }
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x30d40"
+                }
+            ]
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(r#""requested": 0"#));
+        // The stipend is returned unused
+        assert!(result.contains(r#""stipend": 2300"#));
+        assert!(result.contains(r#""returned": 2300"#));
+    }
+
+    #[test]
+    fn golden_vectors() {
+        // Every golden case written by cmd/golden traces through the FFI to
+        // the same bytes as its committed vector
+        let dir = std::path::Path::new(env!("CARGO_MANIFEST_DIR")).join("golden");
+        let cases: Vec<String> =
+            serde_json::from_str(&std::fs::read_to_string(dir.join("cases.json")).unwrap())
+                .unwrap();
+        assert!(!cases.is_empty());
+        for name in cases {
+            let config =
+                std::fs::read_to_string(dir.join(format!("{}.config.json", name))).unwrap();
+            let golden = std::fs::read_to_string(dir.join(format!("{}.trace.json", name))).unwrap();
+            let result = trace(&config).unwrap();
+            assert_eq!(result, golden, "golden case {}", name);
+            assert!(serde_json::from_str::<serde_json::Value>(&result).is_ok());
+        }
+    }
+
+    #[test]
+    fn gas_overrides() {
+        // Call tx adding 1 and 1 with ADD repriced to 10
+        let config = r#"{
+            "accounts": {
+                "0x00000000000000000000000000000000000000ff": {
+                    "code": "0x600160010100"
+                }
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x30d40"
+                }
+            ],
+            "gas_overrides": {
+                "ADD": 10
+            }
+        }"#;
+        let result = trace(config).unwrap();
+        let add = &result[result.find(r#""op": "ADD""#).unwrap()..];
+        assert!(add[..add.find(r#""depth""#).unwrap()].contains(r#""gasCost": 10"#));
+    }
+
+    #[test]
+    fn disabled_opcodes() {
+        // Call tx running DIFFICULTY, which is disabled
+        let config = r#"{
+            "accounts": {
+                "0x00000000000000000000000000000000000000ff": {
+                    "code": "0x4400"
+                }
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x30d40"
+                }
+            ],
+            "disabled_opcodes": ["DIFFICULTY"]
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(r#""failed": true"#));
+        assert!(result.contains(r#""errorKind": "InvalidOpcode""#));
+    }
+
+    #[test]
+    fn extra_eips() {
+        // Call tx running BASEFEE on Berlin, with or without EIP-3198
+        let config = |extra_eips: &str| {
+            format!(
+                r#"{{
+                    "fork": "Berlin",
+                    "accounts": {{
+                        "0x00000000000000000000000000000000000000ff": {{
+                            "code": "0x4800"
+                        }}
+                    }},
+                    "transactions": [
+                        {{
+                            "from": "0x00000000000000000000000000000000000000fe",
+                            "to": "0x00000000000000000000000000000000000000ff",
+                            "gas_limit": "0x30d40",
+                            "gas_price": "0x0"
+                        }}
+                    ],
+                    "extra_eips": {}
+                }}"#,
+                extra_eips
+            )
+        };
+        assert!(trace(&config("[]")).unwrap().contains(r#""failed": true"#));
+        assert!(trace(&config("[3198]"))
+            .unwrap()
+            .contains(r#""failed": false"#));
+    }
+
+    #[test]
+    fn auto_nonce_txs() {
+        // Two call txs without nonce from a sender of nonce 5
+        let config = r#"{
+            "accounts": {
+                "0x00000000000000000000000000000000000000fe": {
+                    "nonce": "0x5"
+                }
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x5208"
+                },
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x5208"
+                }
+            ],
+            "auto_nonce": true
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(r#""nonce": "0x5""#));
+        assert!(result.contains(r#""nonce": "0x6""#));
+    }
+
+    #[test]
+    fn coinbase_fee() {
+        // Normal call tx with gas_limit = 21000 and gas_price = 2 Gwei, with
+        // base_fee = 1 Gwei, paying its priority fee to a coinbase which
+        // doesn't exist yet
+        let config = r#"{
+            "block_constants": {
+                "coinbase": "0x00000000000000000000000000000000000000c0",
+                "base_fee": "0x3b9aca00"
+            },
+            "accounts": {
+                "0x00000000000000000000000000000000000000fe": {
+                    "balance": "0x2632e314a000"
+                }
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x5208",
+                    "gas_price": "0x77359400"
+                }
+            ]
+        }"#;
+        let result = trace(config).unwrap();
+        assert!(result.contains(r#""amount": "0x1319718a5000""#));
+        assert!(result.contains(r#""created": true"#));
+        assert!(result.contains(r#""burned": "0x1319718a5000""#));
+        assert!(result.contains(r#""priorityFee": "0x1319718a5000""#));
+        assert!(result.contains(r#""senderRefund": "0x0""#));
+    }
+
+    #[test]
+    fn low_fee_cap_tx() {
+        // Call tx with gas_fee_cap = 1 Gwei below base_fee = 2 Gwei
+        let config = |force: bool| {
+            format!(
+                r#"{{
+                    "block_constants": {{
+                        "base_fee": "0x77359400"
+                    }},
+                    "accounts": {{
+                        "0x00000000000000000000000000000000000000fe": {{
+                            "balance": "0x1319718a5000"
+                        }}
+                    }},
+                    "transactions": [
+                        {{
+                            "from": "0x00000000000000000000000000000000000000fe",
+                            "to": "0x00000000000000000000000000000000000000ff",
+                            "gas_limit": "0x5208",
+                            "gas_fee_cap": "0x3b9aca00",
+                            "gas_tip_cap": "0x3b9aca00"
+                        }}
+                    ],
+                    "force_low_fee_cap": {}
+                }}"#,
+                force
+            )
+        };
+        match trace(&config(false)) {
+            Err(Error::TraceError { code, .. }) => assert_eq!(code, ErrorCode::FeeCapTooLow),
+            result => panic!("unexpected result {:?}", result),
+        }
+        let result = trace(&config(true)).unwrap();
+        assert!(result.contains(r#""feeCapTooLow": true"#));
+        assert!(result.contains(r#""priorityFee": "0x0""#));
+    }
+
+    #[test]
+    fn deposit_tx() {
+        // Deposit from an account without balance minting 1 ETH and sending
+        // 0.5 ETH
+        let config = |deposit: bool| {
+            format!(
+                r#"{{
+                    "transactions": [
+                        {{
+                            "from": "0x00000000000000000000000000000000000000fe",
+                            "to": "0x00000000000000000000000000000000000000ff",
+                            "value": "0x6f05b59d3b20000",
+                            "gas_limit": "0x5208",
+                            "deposit": {},
+                            "mint": "0xde0b6b3a7640000",
+                            "source_hash": "0x0000000000000000000000000000000000000000000000000000000000000001"
+                        }}
+                    ]
+                }}"#,
+                deposit
+            )
+        };
+        let result = trace(&config(true)).unwrap();
+        assert!(result.contains(r#""failed": false"#));
+        assert!(result.contains(r#""priorityFee": "0x0""#));
+
+        // The mint is rejected on a transaction which isn't a deposit
+        match trace(&config(false)) {
+            Err(Error::TraceError { code, .. }) => assert_eq!(code, ErrorCode::InvalidConfig),
+            result => panic!("unexpected result {:?}", result),
+        }
+    }
+
+    #[test]
+    fn l1_fee_tx() {
+        // Legacy tx whose 32-byte encoding has 19 zero bytes, for an L1 data
+        // fee of 13 * 16 + 19 * 4 = 284 wei
+        let config = |balance: &str| {
+            format!(
+                r#"{{
+                    "accounts": {{
+                        "0x00000000000000000000000000000000000000fe": {{
+                            "balance": "{}"
+                        }}
+                    }},
+                    "transactions": [
+                        {{
+                            "from": "0x00000000000000000000000000000000000000fe",
+                            "to": "0x00000000000000000000000000000000000000ff",
+                            "gas_limit": "0x5208",
+                            "gas_price": "0x0"
+                        }}
+                    ],
+                    "l1_fee": {{
+                        "base_fee": "0x1",
+                        "overhead": "0x0",
+                        "scalar": "0xf4240"
+                    }}
+                }}"#,
+                balance
+            )
+        };
+        let result = trace(&config("0x200")).unwrap();
+        assert!(result.contains(r#""l1Fee": "0x11c""#));
+        match trace(&config("0x100")) {
+            Err(Error::TraceError { code, .. }) => assert_eq!(code, ErrorCode::InsufficientFunds),
+            result => panic!("unexpected result {:?}", result),
+        }
+    }
+
+    #[test]
+    fn deterministic_tx() {
+        // Call tx writing the slots 3, 2 and 1 in this order
+        let config = r#"{
+            "accounts": {
+                "0x00000000000000000000000000000000000000ff": {
+                    "code": "0x60016003556001600255600160015500"
+                }
+            },
+            "transactions": [
+                {
+                    "from": "0x00000000000000000000000000000000000000fe",
+                    "to": "0x00000000000000000000000000000000000000ff",
+                    "gas_limit": "0x30d40"
+                }
+            ]
+        }"#;
+        let result = trace(config).unwrap();
+        for _ in 0..8 {
+            assert_eq!(trace(config).unwrap(), result);
+        }
+
+        // The keys of the storage of the last step are sorted
+        let storage = &result[result.rfind(r#""storage""#).unwrap()..];
+        let slot = |n: u8| storage.find(&format!(r#""{:064x}""#, n)).unwrap();
+        assert!(slot(1) < slot(2) && slot(2) < slot(3));
+    }
+
+    #[test]
+    fn parallel_txs() {
+        let configs = r#"[
+            {
+                "transactions": [
+                    {
+                        "from": "0x00000000000000000000000000000000000000fe",
+                        "to": "0x00000000000000000000000000000000000000ff",
+                        "gas_limit": "0x5208"
+                    }
+                ]
+            },
+            {
+                "transactions": [
+                    {
+                        "from": "0x00000000000000000000000000000000000000fe",
+                        "to": "0x00000000000000000000000000000000000000ff"
+                    }
+                ]
+            }
+        ]"#;
+        let result = trace_txs(configs, 2).unwrap();
+        assert!(result.starts_with(r#"[{"result":"#));
+        assert!(result.contains(r#"{"error":"#));
+    }
 }
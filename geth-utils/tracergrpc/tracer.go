@@ -0,0 +1,302 @@
+// Package tracergrpc serves the tracing functions of gethutil over gRPC with
+// the schema of tracer.proto, so that the prover and the test tools can call
+// a long-running tracer over a socket instead of linking the library.
+//
+// The messages are encoded by hand in the protobuf wire format, rather than
+// generated by protoc, as they only have a few fields carrying JSON.
+package tracergrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/appliedzkp/zkevm-circuits/geth-utils/gethutil"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// TraceRequest is the TraceRequest of tracer.proto.
+type TraceRequest struct {
+	// Config is the JSON TraceConfig.
+	Config []byte
+}
+
+// TraceResponse is the TraceResponse of tracer.proto.
+type TraceResponse struct {
+	// Result is the JSON result, which is empty on failure.
+	Result []byte
+	// Error is set on failure.
+	Error *TraceError
+}
+
+// TraceError is the TraceError of tracer.proto, whose Code is a
+// gethutil.ErrorCode.
+type TraceError struct {
+	Code    int32
+	Message string
+}
+
+func (m *TraceRequest) marshal(b []byte) []byte {
+	return appendBytes(b, 1, m.Config)
+}
+
+func (m *TraceRequest) unmarshal(b []byte) error {
+	return consumeMessage(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if num == 1 && typ == protowire.BytesType {
+			return consumeBytes(b, &m.Config)
+		}
+		return 0
+	})
+}
+
+func (m *TraceResponse) marshal(b []byte) []byte {
+	b = appendBytes(b, 1, m.Result)
+	if m.Error != nil {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.Error.marshal(nil))
+	}
+	return b
+}
+
+func (m *TraceResponse) unmarshal(b []byte) error {
+	return consumeMessage(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return consumeBytes(b, &m.Result)
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			m.Error = new(TraceError)
+			if err := m.Error.unmarshal(v); err != nil {
+				return -1
+			}
+			return n
+		}
+		return 0
+	})
+}
+
+func (m *TraceError) marshal(b []byte) []byte {
+	if m.Code != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(m.Code))
+	}
+	return appendBytes(b, 2, []byte(m.Message))
+}
+
+func (m *TraceError) unmarshal(b []byte) error {
+	return consumeMessage(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			m.Code = int32(v)
+			return n
+		case num == 2 && typ == protowire.BytesType:
+			var message []byte
+			n := consumeBytes(b, &message)
+			m.Message = string(message)
+			return n
+		}
+		return 0
+	})
+}
+
+// appendBytes appends the bytes field num of value v to b, unless v is empty
+// like in proto3.
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// consumeBytes sets v to a copy of the bytes value at the start of b, and
+// returns its length, or a negative protowire error.
+func consumeBytes(b []byte, v *[]byte) int {
+	value, n := protowire.ConsumeBytes(b)
+	if n >= 0 {
+		*v = append([]byte(nil), value...)
+	}
+	return n
+}
+
+// consumeMessage passes the number, the type and the rest of b from the value
+// of each field of the message b to field, which returns the length of the
+// value, a negative protowire error, or 0 to skip an unknown field.
+func consumeMessage(b []byte, field func(num protowire.Number, typ protowire.Type, b []byte) int) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if n = field(num, typ, b); n == 0 {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// message is a message of tracer.proto.
+type message interface {
+	marshal(b []byte) []byte
+	unmarshal(b []byte) error
+}
+
+// Codec is the encoding.Codec of the messages of tracer.proto, which must be
+// forced on the servers and the calls of the Tracer service, see NewServer
+// and TracerClient.
+var Codec codec
+
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("tracergrpc: unexpected message %T", v)
+	}
+	return m.marshal(nil), nil
+}
+
+func (codec) Unmarshal(b []byte, v interface{}) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("tracergrpc: unexpected message %T", v)
+	}
+	return m.unmarshal(b)
+}
+
+// Name is the name of the codec of protobuf, whose wire format it encodes.
+func (codec) Name() string { return "proto" }
+
+// TracerServer is the server API of the Tracer service.
+type TracerServer interface {
+	TraceTx(ctx context.Context, req *TraceRequest) (*TraceResponse, error)
+	TraceBlock(ctx context.Context, req *TraceRequest) (*TraceResponse, error)
+}
+
+// Tracer implements TracerServer with gethutil. The failures of the traces
+// are returned in the TraceError of their responses, like by CreateTrace.
+type Tracer struct{}
+
+// TraceTx traces the transactions of the config of req until ctx is done,
+// see gethutil.TraceContext, and returns the results in the output of the
+// config, see gethutil.FormatResults.
+func (Tracer) TraceTx(ctx context.Context, req *TraceRequest) (*TraceResponse, error) {
+	var config gethutil.TraceConfig
+	if err := json.Unmarshal(req.Config, &config); err != nil {
+		return errorResponse(gethutil.NewTraceError(gethutil.ErrCodeInvalidConfig, err, "Failed to unmarshal config, err: %v", err)), nil
+	}
+	results, err := gethutil.TraceContext(ctx, config)
+	if err != nil {
+		return errorResponse(err), nil
+	}
+	formatted := gethutil.FormatResults(config, results)
+	var result []byte
+	if results, ok := formatted.([]*gethutil.ExecutionResult); ok {
+		var buf bytes.Buffer
+		err = gethutil.WriteResults(&buf, results, "")
+		result = buf.Bytes()
+	} else {
+		result, err = json.Marshal(formatted)
+	}
+	if err != nil {
+		return errorResponse(gethutil.NewTraceError(gethutil.ErrCodeInternal, err, "Failed to marshal []ExecutionResult, err: %v", err)), nil
+	}
+	return &TraceResponse{Result: result}, nil
+}
+
+// TraceBlock traces the transactions of the config of req as a block, see
+// gethutil.TraceBlock.
+func (Tracer) TraceBlock(ctx context.Context, req *TraceRequest) (*TraceResponse, error) {
+	var config gethutil.TraceConfig
+	if err := json.Unmarshal(req.Config, &config); err != nil {
+		return errorResponse(gethutil.NewTraceError(gethutil.ErrCodeInvalidConfig, err, "Failed to unmarshal config, err: %v", err)), nil
+	}
+	block, err := gethutil.TraceBlock(config)
+	if err != nil {
+		return errorResponse(err), nil
+	}
+	result, err := json.Marshal(block)
+	if err != nil {
+		return errorResponse(gethutil.NewTraceError(gethutil.ErrCodeInternal, err, "Failed to marshal BlockTraceResult, err: %v", err)), nil
+	}
+	return &TraceResponse{Result: result}, nil
+}
+
+func errorResponse(err error) *TraceResponse {
+	traceErr := gethutil.AsTraceError(err)
+	return &TraceResponse{Error: &TraceError{Code: int32(traceErr.Code), Message: traceErr.Message}}
+}
+
+// NewServer returns a gRPC server of the Tracer service implemented by srv,
+// with Codec forced.
+func NewServer(srv TracerServer, opts ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(append(opts, grpc.ForceServerCodec(Codec))...)
+	server.RegisterService(&serviceDesc, srv)
+	return server
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "gethutil.Tracer",
+	HandlerType: (*TracerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "TraceTx", Handler: unaryHandler("TraceTx", TracerServer.TraceTx)},
+		{MethodName: "TraceBlock", Handler: unaryHandler("TraceBlock", TracerServer.TraceBlock)},
+	},
+	Metadata: "tracer.proto",
+}
+
+// unaryHandler returns the handler of the method name calling method.
+func unaryHandler(name string, method func(TracerServer, context.Context, *TraceRequest) (*TraceResponse, error)) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := new(TraceRequest)
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return method(srv.(TracerServer), ctx, req)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/gethutil.Tracer/" + name}
+		return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return method(srv.(TracerServer), ctx, req.(*TraceRequest))
+		})
+	}
+}
+
+// TracerClient is a client of the Tracer service.
+type TracerClient struct {
+	conn grpc.ClientConnInterface
+}
+
+// NewTracerClient returns a client of the Tracer service on conn.
+func NewTracerClient(conn grpc.ClientConnInterface) *TracerClient {
+	return &TracerClient{conn: conn}
+}
+
+// TraceTx calls the method TraceTx of the Tracer service.
+func (c *TracerClient) TraceTx(ctx context.Context, req *TraceRequest, opts ...grpc.CallOption) (*TraceResponse, error) {
+	return c.invoke(ctx, "TraceTx", req, opts)
+}
+
+// TraceBlock calls the method TraceBlock of the Tracer service.
+func (c *TracerClient) TraceBlock(ctx context.Context, req *TraceRequest, opts ...grpc.CallOption) (*TraceResponse, error) {
+	return c.invoke(ctx, "TraceBlock", req, opts)
+}
+
+func (c *TracerClient) invoke(ctx context.Context, name string, req *TraceRequest, opts []grpc.CallOption) (*TraceResponse, error) {
+	resp := new(TraceResponse)
+	if err := c.conn.Invoke(ctx, "/gethutil.Tracer/"+name, req, resp, append(opts, grpc.ForceCodec(Codec))...); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
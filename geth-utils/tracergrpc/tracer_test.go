@@ -0,0 +1,90 @@
+package tracergrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/appliedzkp/zkevm-circuits/geth-utils/gethutil"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	resp := &TraceResponse{Result: []byte(`[]`), Error: &TraceError{Code: -1, Message: "failed"}}
+	encoded, err := Codec.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Unknown fields are skipped.
+	encoded = protowire.AppendTag(encoded, 15, protowire.VarintType)
+	encoded = protowire.AppendVarint(encoded, 1)
+	decoded := new(TraceResponse)
+	if err := Codec.Unmarshal(encoded, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, resp) {
+		t.Fatalf("got %+v, want %+v", decoded, resp)
+	}
+	if err := Codec.Unmarshal(encoded[:len(encoded)-1], decoded); err == nil {
+		t.Fatal("truncated message decoded")
+	}
+}
+
+// dialTracer serves a Tracer on a local port and returns a client of it.
+func dialTracer(t *testing.T) *TracerClient {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(Tracer{})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewTracerClient(conn)
+}
+
+func TestTraceTx(t *testing.T) {
+	client := dialTracer(t)
+	config := gethutil.GoldenCases()[0].Config
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.TraceTx(context.Background(), &TraceRequest{Config: encoded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != nil {
+		t.Fatalf("error: %+v", resp.Error)
+	}
+	results, err := gethutil.Trace(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	if err := gethutil.WriteResults(&want, results, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(resp.Result, want.Bytes()) {
+		t.Fatalf("result:\ngot  %s\nwant %s", resp.Result, want.Bytes())
+	}
+}
+
+func TestTraceTxInvalidConfig(t *testing.T) {
+	client := dialTracer(t)
+	resp, err := client.TraceTx(context.Background(), &TraceRequest{Config: []byte(`{`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error == nil || resp.Error.Code != int32(gethutil.ErrCodeInvalidConfig) || len(resp.Result) != 0 {
+		t.Fatalf("got %+v, want an invalid config error", resp)
+	}
+}